@@ -10,12 +10,15 @@ import (
 	"icapeg/icap"
 	"icapeg/logging"
 	"icapeg/service"
+	"icapeg/service/services-utilities/ContentTypes"
+	general_functions "icapeg/service/services-utilities/general-functions"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ICAPRequest struct is used to encapsulate important information of the ICAP request like method name, etc
@@ -182,12 +185,28 @@ func (i *ICAPRequest) RequestProcessing(xICAPMetadata string) {
 	//for reqmod and respmod
 	default:
 		logging.Logger.Debug(utils.PrepareLogMsg(xICAPMetadata, "Response or Request mode"))
+		i.startAudit(xICAPMetadata)
+		defer logging.FinishAudit(xICAPMetadata)
 		i.generalReqHeaders = i.LogICAPReqHeaders()
 		i.RespAndReqMods(partial, xICAPMetadata)
 	}
 
 }
 
+// startAudit creates the audit record of the ICAP transaction
+func (i *ICAPRequest) startAudit(xICAPMetadata string) {
+	record := logging.StartAudit(xICAPMetadata, i.methodName, i.serviceName)
+	if i.req.Request != nil && i.req.Request.URL != nil {
+		url := *i.req.Request.URL
+		if url.Host == "" {
+			url.Host = i.req.Request.Host
+		}
+		record.SetHTTPMessage(i.req.Header.Get(utils.ClientIPHeader), i.req.Request.Method, url.String())
+	} else {
+		record.SetHTTPMessage(i.req.Header.Get(utils.ClientIPHeader), "", "")
+	}
+}
+
 func (i *ICAPRequest) HostHeader() {
 	if i.methodName == "REQMOD" {
 		i.req.Request.Header.Set("Host", i.req.Request.Host)
@@ -214,18 +233,58 @@ func (i *ICAPRequest) RespAndReqMods(partial bool, xICAPMetadata string) {
 	//initialize the service by creating instance from the required service
 	logging.Logger.Debug(utils.PrepareLogMsg(xICAPMetadata,
 		"initialize the service by creating instance from the required service"))
-	requiredService := service.GetService(i.vendor, i.serviceName, i.methodName,
-		&http_message.HttpMsg{Request: i.req.Request, Response: i.req.Response}, xICAPMetadata)
+	//the JSON payloads which have several files are processed once per file,
+	//the first file which the service doesn't return 204 No modifications for decides the ICAP response
+	//the payload is parsed once and its files are passed to the service one by one
+	filesCount := 1
+	var body []byte
+	var reqContentType ContentTypes.ContentType
+	var jsonFile *ContentTypes.JSONFile
+	if !partial && i.methodName == utils.ICAPModeReq && service.ScansBody(i.vendor) {
+		body, _ = ioutil.ReadAll(i.req.Request.Body)
+		reqContentType = ContentTypes.ParseJSONFile(i.req.Request.Header.Get("Content-Type"), body)
+		if jsonFile, _ = reqContentType.(*ContentTypes.JSONFile); jsonFile != nil {
+			filesCount = jsonFile.FilesCount()
+		}
+	}
 
-	logging.Logger.Debug(utils.PrepareLogMsg(xICAPMetadata,
-		"calling Processing func to process the http message which encapsulated inside the ICAP request"))
-	//calling Processing func to process the http message which encapsulated inside the ICAP request
-	// send request to services
-	///////////////// start service ////////////////////////////////////////////////////////////////////
+	var IcapStatusCode int
+	var httpMsg interface{}
+	var serviceHeaders map[string]string
+	var httpMshHeadersBeforeProcessing, httpMshHeadersAfterProcessing, vendorMsgs map[string]interface{}
+	if i.appCfg.JSONMaxFiles > 0 && filesCount > i.appCfg.JSONMaxFiles {
+		IcapStatusCode, httpMsg = i.tooManyFiles(filesCount, xICAPMetadata)
+		filesCount = 0
+	}
+	for fileIndex := 0; fileIndex < filesCount; fileIndex++ {
+		if body != nil {
+			i.req.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+		msg := &http_message.HttpMsg{Request: i.req.Request, Response: i.req.Response, ContentType: reqContentType}
+		if jsonFile != nil {
+			msg.ContentType = jsonFile.WithFile(fileIndex)
+		}
+		if filesCount > 1 {
+			logging.Logger.Debug(utils.PrepareLogMsg(xICAPMetadata, "processing the file "+
+				strconv.Itoa(fileIndex+1)+" of "+strconv.Itoa(filesCount)+" files of the JSON payload"))
+		}
+		requiredService := service.GetService(i.vendor, i.serviceName, i.methodName, msg, xICAPMetadata)
 
-	//icap.Request.Response
-	IcapStatusCode, httpMsg, serviceHeaders, httpMshHeadersBeforeProcessing, httpMshHeadersAfterProcessing,
-		vendorMsgs := requiredService.Processing(partial, i.req.Header)
+		logging.Logger.Debug(utils.PrepareLogMsg(xICAPMetadata,
+			"calling Processing func to process the http message which encapsulated inside the ICAP request"))
+		//calling Processing func to process the http message which encapsulated inside the ICAP request
+		// send request to services
+		///////////////// start service ////////////////////////////////////////////////////////////////////
+
+		//icap.Request.Response
+		processingStart := time.Now()
+		IcapStatusCode, httpMsg, serviceHeaders, httpMshHeadersBeforeProcessing, httpMshHeadersAfterProcessing,
+			vendorMsgs = requiredService.Processing(partial, i.req.Header)
+		logging.Audit(xICAPMetadata).StageDone("processing", processingStart)
+		if IcapStatusCode != utils.NoModificationStatusCodeStr {
+			break
+		}
+	}
 
 	// adding the headers which the service wants to add them in the ICAP response
 	logging.Logger.Debug(utils.PrepareLogMsg(xICAPMetadata,
@@ -242,6 +301,9 @@ func (i *ICAPRequest) RespAndReqMods(partial bool, xICAPMetadata string) {
 		"checking if shadow service mode is enabled to add logs instead of returning another"))
 	if i.isShadowServiceEnabled {
 		//add logs here
+		if IcapStatusCode != utils.Continue {
+			logging.Audit(xICAPMetadata).SetICAPStatus(IcapStatusCode)
+		}
 		return
 	}
 
@@ -257,7 +319,9 @@ func (i *ICAPRequest) RespAndReqMods(partial bool, xICAPMetadata string) {
 			i.serviceName+" returned ICAP response with status code "+strconv.Itoa(utils.Continue)))
 		//in case the service returned 100 continue
 		//we will get the rest of the body from the client
+		previewStart := time.Now()
 		httpMsgBody := i.preview(xICAPMetadata)
+		logging.Audit(xICAPMetadata).StageDone("preview", previewStart)
 		i.methodName = i.req.Method
 		if i.req.Method == utils.ICAPModeReq {
 			i.req.Request.Body = io.NopCloser(bytes.NewBuffer(httpMsgBody.Bytes()))
@@ -275,7 +339,13 @@ func (i *ICAPRequest) RespAndReqMods(partial bool, xICAPMetadata string) {
 	case utils.NoModificationStatusCodeStr:
 		logging.Logger.Debug(utils.PrepareLogMsg(xICAPMetadata,
 			i.serviceName+" returned ICAP response with status code "+strconv.Itoa(utils.NoModificationStatusCodeStr)))
-		if i.Is204Allowed {
+		//the request is returned if its URL was changed (ex: the warn token was removed)
+		//or if the content policy redacted its body
+		if req, ok := httpMsg.(*http.Request); ok && i.methodName == utils.ICAPModeReq &&
+			logging.Audit(xICAPMetadata).Redacted {
+			IcapStatusCode = utils.OkStatusCodeStr
+			i.w.WriteHeader(utils.OkStatusCodeStr, req, true)
+		} else if i.Is204Allowed && !i.isReqURLChanged() {
 			i.w.WriteHeader(utils.NoModificationStatusCodeStr, nil, false)
 		} else {
 
@@ -303,6 +373,9 @@ func (i *ICAPRequest) RespAndReqMods(partial bool, xICAPMetadata string) {
 			i.serviceName+" returned ICAP response with status code "+strconv.Itoa(utils.BadRequestStatusCodeStr)))
 		i.w.WriteHeader(IcapStatusCode, httpMsg, true)
 	}
+	if IcapStatusCode != utils.Continue {
+		logging.Audit(xICAPMetadata).SetICAPStatus(IcapStatusCode)
+	}
 	i.allHeaders(IcapStatusCode, httpMshHeadersBeforeProcessing, httpMshHeadersAfterProcessing, vendorMsgs, xICAPMetadata)
 }
 
@@ -336,7 +409,7 @@ func (i *ICAPRequest) addHeadersToLogs(xICAPMetadata string) {
 		res := key + " : "
 		innerRes := ""
 		for i := 0; i < len(element); i++ {
-			innerRes += element[i]
+			innerRes += logging.RedactHeader(key, element[i])
 			if i != len(element)-1 {
 				innerRes += ", "
 			}
@@ -347,6 +420,40 @@ func (i *ICAPRequest) addHeadersToLogs(xICAPMetadata string) {
 	}
 }
 
+// tooManyFiles applies app.json_max_files_action on the JSON payloads which have more files than
+// app.json_max_files, they're rejected with the block page or passed without processing them
+func (i *ICAPRequest) tooManyFiles(filesCount int, xICAPMetadata string) (int, interface{}) {
+	logging.Logger.Debug(utils.PrepareLogMsg(xICAPMetadata, "the JSON payload has "+strconv.Itoa(filesCount)+
+		" files which are more than json_max_files, the action is "+i.appCfg.JSONMaxFilesAction))
+	if i.appCfg.JSONMaxFilesAction == utils.BypassExts {
+		logging.Audit(xICAPMetadata).SetDecision(logging.DecisionBypass)
+		logging.Audit(xICAPMetadata).SetVerdict(logging.VerdictUnscanned, "")
+		return utils.NoModificationStatusCodeStr, nil
+	}
+	logging.Audit(xICAPMetadata).SetDecision(logging.DecisionReject)
+	logging.Audit(xICAPMetadata).SetVerdict(logging.VerdictBlocked, "")
+	generalFunc := general_functions.NewGeneralFunc(&http_message.HttpMsg{Request: i.req.Request}, xICAPMetadata)
+	exceptionPagePath := utils.BlockPagePath
+	if exceptionPage := i.appCfg.ServicesInstances[i.serviceName].ExceptionPage; exceptionPage != "" {
+		exceptionPagePath = exceptionPage
+	}
+	errPage, contentType := generalFunc.GenBlockPage(exceptionPagePath, utils.ErrPageReasonFileRejected,
+		i.serviceName, "", i.req.Request.RequestURI, "", xICAPMetadata)
+	httpResp := generalFunc.ErrPageResp(http.StatusForbidden, errPage.Len(), contentType)
+	httpResp.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+	return utils.OkStatusCodeStr, httpResp
+}
+
+// isReqURLChanged checks if the service changed the URL of the http request in REQMOD,
+// in this case the modified request is returned instead of 204 No modifications
+func (i *ICAPRequest) isReqURLChanged() bool {
+	if i.methodName != utils.ICAPModeReq || i.req.Request == nil || i.req.OrgRequest == nil ||
+		i.req.Request == i.req.OrgRequest || i.req.Request.URL == nil || i.req.OrgRequest.URL == nil {
+		return false
+	}
+	return i.req.Request.URL.RawQuery != i.req.OrgRequest.URL.RawQuery
+}
+
 // isServiceExists is a func to make sure that service which required in ICAP
 // request is existing in the config.go file
 func (i *ICAPRequest) isServiceExists(xICAPMetadata string) bool {
@@ -502,6 +609,7 @@ func (i *ICAPRequest) preview(xICAPMetadata string) *bytes.Buffer {
 	return buf
 }
 
+// LogICAPReqHeaders returns the headers of the ICAP request for logging, sensitive headers are redacted
 func (i *ICAPRequest) LogICAPReqHeaders() map[string]interface{} {
 	reqHeaders := make(map[string]interface{})
 	reqHeaders["ICAP-Requested-URL"] = "icap://" + i.req.URL.Host + "/" + i.serviceName
@@ -513,11 +621,12 @@ func (i *ICAPRequest) LogICAPReqHeaders() map[string]interface{} {
 				values += ", "
 			}
 		}
-		reqHeaders[key] = value
+		reqHeaders[key] = logging.RedactHeaderValues(key, value)
 	}
 	return reqHeaders
 }
 
+// LogICAPResHeaders returns the headers of the ICAP response for logging, sensitive headers are redacted
 func (i *ICAPRequest) LogICAPResHeaders(statusCode int) map[string]interface{} {
 	respHeaders := make(map[string]interface{})
 	respHeaders["ICAP-Response-Status-Code"] = statusCode
@@ -529,7 +638,7 @@ func (i *ICAPRequest) LogICAPResHeaders(statusCode int) map[string]interface{} {
 				values += ", "
 			}
 		}
-		respHeaders[key] = value
+		respHeaders[key] = logging.RedactHeaderValues(key, value)
 	}
 	return respHeaders
 }
@@ -2,9 +2,11 @@ package config
 
 import (
 	"fmt"
+	utils "icapeg/consts"
 	"icapeg/logging"
 	"icapeg/readValues"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -18,6 +20,7 @@ type serviceIcapInfo struct {
 	ShadowService  bool
 	PreviewEnabled bool
 	PreviewBytes   string
+	ExceptionPage  string
 }
 
 // AppConfig represents the app configuration
@@ -32,10 +35,72 @@ type AppConfig struct {
 	DebuggingHeaders   bool
 	Services           []string
 	ServicesInstances  map[string]*serviceIcapInfo
+	JSONMaxFiles       int
+	JSONMaxFilesAction string
 }
 
+// the default limit of the files of a JSON payload, the payloads which have more files are rejected
+const defaultJSONMaxFiles = 20
+
 var AppCfg AppConfig
 
+// readLogConfig reads the configuration of the log sinks from the optional [logging] section,
+// if the section doesn't exist, logs are written to ./logs/logs.json file
+func readLogConfig() logging.LogConfig {
+	logCfg := logging.LogConfig{
+		Level:              AppCfg.LogLevel,
+		WriteLogsToConsole: AppCfg.WriteLogsToConsole,
+		File:               logging.DefaultLogFile,
+		SyslogFacility:     logging.DefaultSyslogFacility,
+	}
+	optionalString := func(key string, value *string) {
+		if readValues.IsSecExists("logging." + key) {
+			*value = readValues.ReadValuesString("logging." + key)
+		}
+	}
+	optionalString("file", &logCfg.File)
+	optionalString("file_level", &logCfg.FileLevel)
+	optionalString("stdout_level", &logCfg.StdoutLevel)
+	optionalString("syslog_address", &logCfg.SyslogAddress)
+	optionalString("syslog_level", &logCfg.SyslogLevel)
+	optionalString("syslog_tag", &logCfg.SyslogTag)
+	if readValues.IsSecExists("logging.max_size") {
+		logCfg.MaxSize = int64(readValues.ReadValuesInt("logging.max_size")) * 1024 * 1024
+	}
+	if readValues.IsSecExists("logging.max_age") {
+		logCfg.MaxAge = readValues.ReadValuesDuration("logging.max_age") * 24 * time.Hour
+	}
+	if readValues.IsSecExists("logging.max_backups") {
+		logCfg.MaxBackups = readValues.ReadValuesInt("logging.max_backups")
+	}
+	if readValues.IsSecExists("logging.stdout_json") {
+		logCfg.StdoutJSON = readValues.ReadValuesBool("logging.stdout_json")
+	}
+	if readValues.IsSecExists("logging.syslog_facility") {
+		logCfg.SyslogFacility = readValues.ReadValuesInt("logging.syslog_facility")
+	}
+	return logCfg
+}
+
+// readRedactConfig reads the redaction of the logged headers from the optional [logging] section,
+// if redact_headers isn't set, the headers which have credentials are masked
+func readRedactConfig() logging.RedactConfig {
+	redactCfg := logging.RedactConfig{Headers: logging.DefaultRedactHeaders, Mode: logging.RedactModeMask}
+	if readValues.IsSecExists("logging.redact_headers") {
+		redactCfg.Headers = readValues.ReadValuesSlice("logging.redact_headers")
+	}
+	if readValues.IsSecExists("logging.redact_value_patterns") {
+		redactCfg.ValuePatterns = readValues.ReadValuesSlice("logging.redact_value_patterns")
+	}
+	if readValues.IsSecExists("logging.redact_mode") {
+		redactCfg.Mode = readValues.ReadValuesString("logging.redact_mode")
+	}
+	if readValues.IsSecExists("logging.redact_hash_key") {
+		redactCfg.HashKey = readValues.ReadValuesString("logging.redact_hash_key")
+	}
+	return redactCfg
+}
+
 // Init initializes the configuration
 func Init() {
 	viper.SetConfigName("config")
@@ -53,9 +118,56 @@ func Init() {
 		WriteLogsToConsole: readValues.ReadValuesBool("app.write_logs_to_console"),
 		DebuggingHeaders:   readValues.ReadValuesBool("app.debugging_headers"),
 		Services:           readValues.ReadValuesSlice("app.services"),
+		JSONMaxFiles:       defaultJSONMaxFiles,
+		JSONMaxFilesAction: utils.RejectExts,
+	}
+	if readValues.IsSecExists("app.json_max_files") {
+		AppCfg.JSONMaxFiles = readValues.ReadValuesInt("app.json_max_files")
+	}
+	if readValues.IsSecExists("app.json_max_files_action") {
+		AppCfg.JSONMaxFilesAction = readValues.ReadValuesString("app.json_max_files_action")
+	}
+	logging.InitializeLogger(readLogConfig())
+	if err := logging.InitializeRedaction(readRedactConfig()); err != nil {
+		logging.Logger.Fatal("redact_value_patterns in config.toml file is not valid: " + err.Error())
+		fmt.Println("redact_value_patterns in config.toml file is not valid: " + err.Error())
+		os.Exit(1)
 	}
-	logging.InitializeLogger(AppCfg.LogLevel, AppCfg.WriteLogsToConsole)
 	logging.Logger.Info("Reading config.toml file")
+	if AppCfg.JSONMaxFiles < 0 || (AppCfg.JSONMaxFilesAction != utils.RejectExts &&
+		AppCfg.JSONMaxFilesAction != utils.BypassExts) {
+		logging.Logger.Fatal("json_max_files should be 0 or more and json_max_files_action should be " +
+			utils.RejectExts + " or " + utils.BypassExts)
+		fmt.Println("json_max_files should be 0 or more and json_max_files_action should be " +
+			utils.RejectExts + " or " + utils.BypassExts)
+		os.Exit(1)
+	}
+	if readValues.IsSecExists("audit") {
+		logging.InitializeAuditLogger(logging.AuditConfig{
+			Enabled:    readValues.ReadValuesBool("audit.enabled"),
+			Path:       readValues.ReadValuesString("audit.path"),
+			MaxSize:    int64(readValues.ReadValuesInt("audit.max_size")) * 1024 * 1024,
+			MaxAge:     readValues.ReadValuesDuration("audit.max_age") * 24 * time.Hour,
+			MaxBackups: readValues.ReadValuesInt("audit.max_backups"),
+		})
+	}
+	if readValues.IsSecExists("security_events") && readValues.ReadValuesBool("security_events.enabled") {
+		eventsCfg := logging.EventsConfig{
+			Enabled: true,
+			Format:  readValues.ReadValuesString("security_events.format"),
+			Output:  readValues.ReadValuesString("security_events.output"),
+		}
+		if eventsCfg.Output == logging.EventOutputFile {
+			eventsCfg.Path = readValues.ReadValuesString("security_events.path")
+		} else {
+			eventsCfg.Address = readValues.ReadValuesString("security_events.address")
+		}
+		if err := logging.InitializeSecurityEvents(eventsCfg); err != nil {
+			logging.Logger.Fatal("security_events section in config.toml file is not valid: " + err.Error())
+			fmt.Println("security_events section in config.toml file is not valid: " + err.Error())
+			os.Exit(1)
+		}
+	}
 
 	//this loop to make sure that all services in the array of services has sections in the config file and from request mode and response mode
 	//there is one at least from them are enabled in every service
@@ -148,6 +260,25 @@ func Init() {
 				os.Exit(1)
 			}
 		}
+		//warn
+		//warn_extensions array is optional and asterisk isn't allowed in it
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			warn := readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+			for i := 0; i < len(warn); i++ {
+				if warn[i] == "*" {
+					logging.Logger.Fatal("warn_extensions array can't have an asterisk \"*\"")
+					fmt.Println("warn_extensions array can't have an asterisk \"*\"")
+					os.Exit(1)
+				}
+				if ext[warn[i]] == false {
+					ext[warn[i]] = true
+				} else {
+					logging.Logger.Fatal("This extension \"" + warn[i] + "\" is stored in multiple arrays")
+					fmt.Println("This extension \"" + warn[i] + "\" is stored in multiple arrays")
+					os.Exit(1)
+				}
+			}
+		}
 		if asterisks != 1 {
 			logging.Logger.Fatal("There is no \"*\" stored in any extension arrays")
 			fmt.Println("There is no \"*\" stored in any extension arrays")
@@ -164,6 +295,9 @@ func Init() {
 			PreviewBytes:   readValues.ReadValuesString(serviceName + ".preview_bytes"),
 			PreviewEnabled: readValues.ReadValuesBool(serviceName + ".preview_enabled"),
 		}
+		if readValues.IsSecExists(serviceName + ".exception_page") {
+			AppCfg.ServicesInstances[serviceName].ExceptionPage = readValues.ReadValuesString(serviceName + ".exception_page")
+		}
 	}
 }
 
@@ -31,13 +31,24 @@ const (
 	ContentLength                     = "Content-Length"
 	ContentType                       = "Content-Type"
 	HTMLContentType                   = "text/html"
+	JSONContentType                   = "application/json"
+	TextContentType                   = "text/plain"
 	ProcessExts                       = "process"
 	RejectExts                        = "reject"
 	BypassExts                        = "bypass"
+	WarnExts                          = "warn"
 	BlockPagePath                     = "block-page.html"
+	WarnPagePath                      = "warn-page.html"
+	WarnTokenParam                    = "icapeg_proceed"
+	ClientIPHeader                    = "X-Client-IP"
 	ErrPageReasonFileRejected         = "fileRejected"
 	ErrPageReasonMaxFileExceeded      = "maxFileSizeExceeded"
 	ErrPageReasonFileIsNotSafe        = "fileIsNotSafe"
+	ErrPageReasonRiskyContent         = "riskyContent"
+	ErrPageReasonURLBlocked           = "urlBlocked"
+	ErrPageReasonActiveContent        = "activeContent"
+	ErrPageReasonFileIsEncrypted      = "fileIsEncrypted"
+	ErrPageReasonSensitiveContent     = "sensitiveContent"
 	ICAPRequestIdLen                  = 20
 	IdentifierString                  = "abcdefghijklmnopqrstuvwxyz0123456789"
 )
@@ -2,6 +2,7 @@ package http_message
 
 import (
 	"icapeg/logging"
+	"icapeg/service/services-utilities/ContentTypes"
 	"net/http"
 )
 
@@ -10,6 +11,9 @@ import (
 type HttpMsg struct {
 	Request  *http.Request
 	Response *http.Response
+	// ContentType is the parsed body of the http request if the body has several files which are processed
+	// one by one (ex: JSON payloads), the services parse the body if it's nil
+	ContentType ContentTypes.ContentType
 }
 
 // NewHttpMsg is a func used for creating an instance from HttpMsg struct
@@ -3,6 +3,7 @@ package icapclient
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -78,6 +79,10 @@ func (c *Client) DoRemaining(req *Request) (*Response, error) {
 		data = []byte(ds)
 	}
 
+	if !strings.HasSuffix(string(data), DoubleCRLF) { // the last chunk must be followed by an empty line to end the body
+		data = append(data, CRLF...)
+	}
+
 	if err := c.scktDriver.Send(data); err != nil {
 		return nil, err
 	}
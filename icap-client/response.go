@@ -2,8 +2,11 @@ package icapclient
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
+	"io"
 	"net/http"
+	"net/http/httputil"
 	"strconv"
 	"strings"
 )
@@ -16,6 +19,9 @@ type Response struct {
 	Header          http.Header
 	ContentRequest  *http.Request
 	ContentResponse *http.Response
+	// Body is the decoded body of the encapsulated HTTP message, it's nil if the message has no body.
+	// The bodies of ContentRequest and ContentResponse are the chunked data as it's received
+	Body []byte
 }
 
 var (
@@ -42,6 +48,12 @@ func ReadResponse(b *bufio.Reader) (*Response, error) {
 		Header: make(map[string][]string),
 	}
 
+	raw, err := io.ReadAll(b)
+	if err != nil {
+		return nil, err
+	}
+	b = bufio.NewReader(bytes.NewReader(raw))
+
 	scheme := ""
 	httpMsg := ""
 	for currentMsg, err := b.ReadString('\n'); err == nil || currentMsg != ""; currentMsg, err = b.ReadString('\n') { // keep reading the buffer message which is the http response message
@@ -118,6 +130,31 @@ func ReadResponse(b *bufio.Reader) (*Response, error) {
 
 	}
 
+	resp.Body = encapsulatedBody(raw, resp.Header.Get(EncapsulatedHeader))
+
 	return resp, nil
 
 }
+
+// encapsulatedBody decodes the chunked body of the encapsulated HTTP message using the body offset
+// of the Encapsulated header, the offset starts after the ICAP headers
+func encapsulatedBody(raw []byte, encapsulated string) []byte {
+	headerEnd := bytes.Index(raw, []byte(DoubleCRLF))
+	if headerEnd == -1 {
+		return nil
+	}
+	for _, entity := range strings.Split(encapsulated, ",") {
+		name, offset, found := strings.Cut(strings.TrimSpace(entity), "=")
+		if !found || !strings.HasSuffix(name, "-body") || name == "null-body" {
+			continue
+		}
+		off, err := strconv.Atoi(offset)
+		start := headerEnd + len(DoubleCRLF) + off
+		if err != nil || start > len(raw) {
+			return nil
+		}
+		body, _ := io.ReadAll(httputil.NewChunkedReader(bytes.NewReader(raw[start:])))
+		return body
+	}
+	return nil
+}
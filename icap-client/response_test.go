@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -205,4 +206,27 @@ func TestResponse(t *testing.T) {
 
 	})
 
+	t.Run("ReadResponse decoded body", func(t *testing.T) {
+		httpRespStr := "HTTP/1.1 403 Forbidden\r\n" +
+			"Content-Type: text/plain\r\n\r\n"
+		respStr := "ICAP/1.0 200 OK\r\n" +
+			"ISTag: \"W3E4R7U9-L2E4-2\"\r\n" +
+			"Encapsulated: res-hdr=0, res-body=" + strconv.Itoa(len(httpRespStr)) + "\r\n\r\n" +
+			httpRespStr +
+			"b\r\n  Blocked\r\n\r\n" +
+			"3\r\n!!!\r\n" +
+			"0; ieof\r\n\r\n"
+
+		resp, err := ReadResponse(bufio.NewReader(strings.NewReader(respStr)))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if string(resp.Body) != "  Blocked\r\n!!!" {
+			t.Errorf("Wanted the decoded body %q, got: %q", "  Blocked\r\n!!!", resp.Body)
+		}
+		if resp.ContentResponse == nil || resp.ContentResponse.StatusCode != http.StatusForbidden {
+			t.Errorf("Wanted the encapsulated http response, got: %v", resp.ContentResponse)
+		}
+	})
+
 }
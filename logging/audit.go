@@ -0,0 +1,208 @@
+package logging
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// AuditConfig is the configuration of the audit log which is read from [audit] section
+type AuditConfig struct {
+	Enabled    bool
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// AuditRecord is the audit record of an ICAP transaction, every transaction has one record
+// which is written as a JSON line to the audit log when the transaction is finished
+type AuditRecord struct {
+	Timestamp     time.Time          `json:"timestamp"`
+	XICAPMetadata string             `json:"X-ICAP-Metadata"`
+	ClientIP      string             `json:"client_ip,omitempty"`
+	ICAPMethod    string             `json:"icap_method"`
+	Service       string             `json:"service"`
+	HTTPMethod    string             `json:"http_method,omitempty"`
+	URL           string             `json:"url,omitempty"`
+	ContentType   string             `json:"content_type,omitempty"`
+	DetectedType  string             `json:"detected_type,omitempty"`
+	Executable    string             `json:"executable,omitempty"`
+	Size          int                `json:"size"`
+	Hashes        map[string]string  `json:"hashes,omitempty"`
+	Decision      string             `json:"policy_decision,omitempty"`
+	Verdict       string             `json:"verdict,omitempty"`
+	ThreatName    string             `json:"threat_name,omitempty"`
+	WarnOverride  bool               `json:"warn_override,omitempty"`
+	Redacted      bool               `json:"redacted,omitempty"`
+	ICAPStatus    int                `json:"icap_status"`
+	Latency       map[string]float64 `json:"latency_ms"`
+	mu            sync.Mutex
+}
+
+// the policy decisions of the audit records
+const (
+	DecisionProcess         = "process"
+	DecisionBypass          = "bypass"
+	DecisionReject          = "reject"
+	DecisionWarn            = "warn"
+	DecisionWarnOverride    = "warn_override"
+	DecisionMaxSizeExceeded = "max_file_size_exceeded"
+	DecisionRedact          = "redact"
+)
+
+// the verdicts of the audit records
+const (
+	VerdictClean     = "clean"
+	VerdictMalicious = "malicious"
+	VerdictBlocked   = "blocked"
+	VerdictWarned    = "warned"
+	VerdictAllowed   = "allowed"
+	VerdictError     = "error"
+	// VerdictUnscanned is the verdict of the files which are allowed because the scanner failed
+	VerdictUnscanned = "unscanned"
+)
+
+var auditWriter *RotatingFile
+
+// audits stores the records of the running ICAP transactions by their X-ICAP-Metadata
+var audits sync.Map
+
+// InitializeAuditLogger opens the audit log, it's a JSON-lines file which is separate from the
+// debug log and it has its own rotation, so its records don't depend on the log level
+func InitializeAuditLogger(cfg AuditConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	writer, err := NewRotatingFile(cfg.Path, cfg.MaxSize, cfg.MaxAge, cfg.MaxBackups)
+	if err != nil {
+		Logger.Error("couldn't open the audit log " + cfg.Path + ": " + err.Error())
+		return
+	}
+	auditWriter = writer
+}
+
+// StartAudit creates the audit record of an ICAP transaction
+func StartAudit(xICAPMetadata, icapMethod, service string) *AuditRecord {
+	record := &AuditRecord{
+		Timestamp:     time.Now().UTC(),
+		XICAPMetadata: xICAPMetadata,
+		ICAPMethod:    icapMethod,
+		Service:       service,
+		Hashes:        make(map[string]string),
+		Latency:       make(map[string]float64),
+	}
+	audits.Store(xICAPMetadata, record)
+	return record
+}
+
+// Audit returns the audit record of an ICAP transaction, if the transaction has no record,
+// it returns a record which is never written
+func Audit(xICAPMetadata string) *AuditRecord {
+	if record, ok := audits.Load(xICAPMetadata); ok {
+		return record.(*AuditRecord)
+	}
+	return &AuditRecord{Hashes: make(map[string]string), Latency: make(map[string]float64)}
+}
+
+// FinishAudit writes the audit record of an ICAP transaction to the audit log and
+// queues its security event if the HTTP message is blocked, warned or unscanned
+func FinishAudit(xICAPMetadata string) {
+	value, ok := audits.LoadAndDelete(xICAPMetadata)
+	if !ok {
+		return
+	}
+	record := value.(*AuditRecord)
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	record.Latency["total"] = milliseconds(time.Since(record.Timestamp))
+	writeSecurityEvent(record)
+	if auditWriter == nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		Logger.Error("couldn't marshal the audit record: " + err.Error())
+		return
+	}
+	if _, err = auditWriter.Write(append(line, '\n')); err != nil {
+		Logger.Error("couldn't write the audit record: " + err.Error())
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// SetHTTPMessage sets the client IP, the HTTP method and the URL of the HTTP message
+func (r *AuditRecord) SetHTTPMessage(clientIP, httpMethod, url string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ClientIP, r.HTTPMethod, r.URL = clientIP, httpMethod, url
+}
+
+// SetFile sets the information of the body of the HTTP message
+func (r *AuditRecord) SetFile(contentType, detectedType string, size int, sha256 string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ContentType, r.DetectedType, r.Size = contentType, detectedType, size
+	if sha256 != "" {
+		r.Hashes["sha256"] = sha256
+	}
+}
+
+// SetExecutable sets the description of the executable or the script which the body of the HTTP message is
+func (r *AuditRecord) SetExecutable(executable string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Executable = executable
+}
+
+// SetDecision sets the policy decision which the service applied on the HTTP message
+func (r *AuditRecord) SetDecision(decision string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Decision = decision
+}
+
+// SetWarnOverride records that the client proceeded to the URL after a warning, it's kept
+// even if the policy decision changes after it
+func (r *AuditRecord) SetWarnOverride() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.WarnOverride = true
+}
+
+// SetRedacted records that the content policy redacted the body of the HTTP request,
+// the redacted request is returned instead of 204 No modifications
+func (r *AuditRecord) SetRedacted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Redacted = true
+}
+
+// SetVerdict sets the verdict of the service and the name of the threat if there is one
+func (r *AuditRecord) SetVerdict(verdict, threatName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Verdict, r.ThreatName = verdict, threatName
+}
+
+// SetICAPStatus sets the status code of the ICAP response, if the status is an error
+// and the service didn't set a verdict, the verdict is set to error
+func (r *AuditRecord) SetICAPStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ICAPStatus = status
+	if status >= 400 && r.Verdict == "" {
+		r.Verdict = VerdictError
+	}
+}
+
+// StageDone records the latency of a processing stage which started at start,
+// if the stage runs more than one time, its latencies are summed
+func (r *AuditRecord) StageDone(stage string, start time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Latency[stage] += milliseconds(time.Since(start))
+}
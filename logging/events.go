@@ -0,0 +1,289 @@
+package logging
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the formats of the security events
+const (
+	EventFormatCEF  = "cef"
+	EventFormatLEEF = "leef"
+)
+
+// the outputs of the security events
+const (
+	EventOutputFile   = "file"
+	EventOutputSyslog = "syslog"
+	EventOutputTCP    = "tcp"
+)
+
+// the fields of the header of the security events
+const (
+	eventVendor  = "ICAPeg"
+	eventProduct = "ICAPeg"
+	eventVersion = "1.0"
+)
+
+// EventsConfig is the configuration of the security events which is read from [security_events] section
+type EventsConfig struct {
+	Enabled bool
+	Format  string
+	Output  string
+	Path    string
+	Address string
+}
+
+// eventWriter writes formatted security events to one of the outputs
+type eventWriter interface {
+	writeEvent(severity int, event string) error
+}
+
+// eventsQueueSize is the number of the security events which can wait for the worker,
+// the events are dropped when the queue is full
+const eventsQueueSize = 1024
+
+// securityEvent is a formatted security event which is queued for the worker
+type securityEvent struct {
+	severity int
+	event    string
+}
+
+var eventsFormat string
+var events eventWriter
+var eventsQueue chan securityEvent
+
+// InitializeSecurityEvents opens the output of the security events, every ICAP transaction which is
+// blocked or warned is written as a CEF or LEEF record when its audit record is finished
+func InitializeSecurityEvents(cfg EventsConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Format != EventFormatCEF && cfg.Format != EventFormatLEEF {
+		return errors.New("the format of security events should be cef or leef")
+	}
+	var err error
+	switch cfg.Output {
+	case EventOutputFile:
+		var file *RotatingFile
+		if file, err = NewRotatingFile(cfg.Path, 0, 0, 0); err == nil {
+			events = &fileEventWriter{file: file}
+		}
+	case EventOutputSyslog:
+		var writer *SyslogWriter
+		if writer, err = NewSyslogWriter(cfg.Address, "icapeg"); err == nil {
+			events = &syslogEventWriter{writer: writer}
+		}
+	case EventOutputTCP:
+		events = &tcpEventWriter{address: cfg.Address}
+	default:
+		return errors.New("the output of security events should be file, syslog or tcp")
+	}
+	if err != nil {
+		return err
+	}
+	eventsFormat = cfg.Format
+	startSecurityEvents(events)
+	return nil
+}
+
+// startSecurityEvents starts the worker which writes the queued security events, so a slow
+// or unavailable output (ex: a SIEM which is down) doesn't hold the ICAP transactions
+func startSecurityEvents(writer eventWriter) {
+	queue := make(chan securityEvent, eventsQueueSize)
+	eventsQueue = queue
+	go func() {
+		for e := range queue {
+			if err := writer.writeEvent(e.severity, e.event); err != nil {
+				Logger.Error("couldn't write the security event: " + err.Error())
+			}
+		}
+	}()
+}
+
+// eventSeverity returns the severity of the event of an audit record (0-10), records which are
+// neither blocked, warned nor unscanned have no event
+func eventSeverity(record *AuditRecord) (int, bool) {
+	switch record.Verdict {
+	case VerdictMalicious:
+		return 10, true
+	case VerdictBlocked:
+		return 5, true
+	case VerdictWarned:
+		return 3, true
+	case VerdictUnscanned:
+		return 2, true
+	}
+	return 0, false
+}
+
+// eventAction returns the action which the service took on the HTTP message
+func eventAction(record *AuditRecord) string {
+	switch record.Verdict {
+	case VerdictWarned:
+		return "warn"
+	case VerdictUnscanned:
+		return "allow"
+	}
+	return "block"
+}
+
+// eventID identifies the type of the event, it's malicious for detections and unscanned for the files
+// which the scanner failed to scan, otherwise the policy decision
+func eventID(record *AuditRecord) string {
+	if record.Verdict == VerdictMalicious || record.Verdict == VerdictUnscanned {
+		return record.Verdict
+	}
+	if record.Decision != "" {
+		return record.Decision
+	}
+	return record.Verdict
+}
+
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ")
+var cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`)
+
+// FormatCEF formats the audit record as an ArcSight CEF record
+func FormatCEF(record *AuditRecord) string {
+	severity, _ := eventSeverity(record)
+	name := "ICAPeg " + eventAction(record) + " " + record.Verdict
+	if record.ThreatName != "" {
+		name += ": " + record.ThreatName
+	}
+	header := []string{"CEF:0", eventVendor, eventProduct, eventVersion, eventID(record), name, strconv.Itoa(severity)}
+	for i := 1; i < len(header); i++ {
+		header[i] = cefHeaderEscaper.Replace(header[i])
+	}
+	ext := []string{
+		"rt=" + strconv.FormatInt(record.Timestamp.UnixMilli(), 10),
+		"act=" + eventAction(record),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+	add("src", record.ClientIP)
+	add("request", record.URL)
+	add("requestMethod", record.HTTPMethod)
+	add("fileHash", record.Hashes["sha256"])
+	add("fileType", record.DetectedType)
+	add("cs1Label", "threatName")
+	add("cs1", record.ThreatName)
+	add("cs2Label", "service")
+	add("cs2", record.Service)
+	add("cs3Label", "X-ICAP-Metadata")
+	add("cs3", record.XICAPMetadata)
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+var leefHeaderEscaper = strings.NewReplacer("|", " ", "\n", " ", "\r", " ")
+var leefValueEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// FormatLEEF formats the audit record as a QRadar LEEF 1.0 record whose attributes are separated by tabs
+func FormatLEEF(record *AuditRecord) string {
+	severity, _ := eventSeverity(record)
+	header := []string{"LEEF:1.0", eventVendor, eventProduct, eventVersion, leefHeaderEscaper.Replace(eventID(record))}
+	attrs := []string{
+		"devTime=" + strconv.FormatInt(record.Timestamp.UnixMilli(), 10),
+		"devTimeFormat=epoch",
+		"sev=" + strconv.Itoa(severity),
+		"cat=" + record.Verdict,
+		"action=" + eventAction(record),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			attrs = append(attrs, key+"="+leefValueEscaper.Replace(value))
+		}
+	}
+	add("src", record.ClientIP)
+	add("url", record.URL)
+	add("fileHash", record.Hashes["sha256"])
+	add("threatName", record.ThreatName)
+	add("service", record.Service)
+	add("X-ICAP-Metadata", record.XICAPMetadata)
+	return strings.Join(header, "|") + "|" + strings.Join(attrs, "\t")
+}
+
+// writeSecurityEvent queues the event of the audit record if it's blocked, warned or unscanned,
+// it never blocks, if the queue is full, the event is dropped
+func writeSecurityEvent(record *AuditRecord) {
+	severity, ok := eventSeverity(record)
+	if events == nil || eventsQueue == nil || !ok {
+		return
+	}
+	event := FormatCEF(record)
+	if eventsFormat == EventFormatLEEF {
+		event = FormatLEEF(record)
+	}
+	select {
+	case eventsQueue <- securityEvent{severity: severity, event: event}:
+	default:
+		Logger.Error("the security events queue is full, the event of " + record.XICAPMetadata + " is dropped")
+	}
+}
+
+type fileEventWriter struct {
+	file *RotatingFile
+}
+
+func (w *fileEventWriter) writeEvent(_ int, event string) error {
+	_, err := w.file.Write([]byte(event + "\n"))
+	return err
+}
+
+type syslogEventWriter struct {
+	writer *SyslogWriter
+}
+
+func (w *syslogEventWriter) writeEvent(severity int, event string) error {
+	syslogSev := syslogInfo
+	switch {
+	case severity >= 8:
+		syslogSev = syslogCritical
+	case severity >= 5:
+		syslogSev = syslogWarning
+	}
+	return w.writer.WriteMessage(DefaultSyslogFacility, syslogSev, "-", event)
+}
+
+// tcpEventWriter sends newline-delimited events to a TCP endpoint, it connects lazily
+// and reconnects once if sending fails, so a SIEM restart doesn't stop the events
+type tcpEventWriter struct {
+	address string
+	mu      sync.Mutex
+	conn    net.Conn
+}
+
+const tcpEventTimeout = 2 * time.Second
+
+func (w *tcpEventWriter) send(line []byte) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout("tcp", w.address, tcpEventTimeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(tcpEventTimeout))
+	_, err := w.conn.Write(line)
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *tcpEventWriter) writeEvent(_ int, event string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	line := []byte(event + "\n")
+	if err := w.send(line); err != nil {
+		return w.send(line)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func testRecord() *AuditRecord {
+	return &AuditRecord{
+		Timestamp:  time.Unix(1700000000, 0),
+		ClientIP:   "10.0.0.7",
+		Service:    "clamav",
+		URL:        "http://example.com/a=b|c",
+		Hashes:     map[string]string{"sha256": "abc"},
+		Decision:   DecisionProcess,
+		Verdict:    VerdictMalicious,
+		ThreatName: "Eicar-Signature",
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	cef := FormatCEF(testRecord())
+	expected := []string{"CEF:0|ICAPeg|ICAPeg|1.0|malicious|ICAPeg block malicious: Eicar-Signature|10|",
+		"src=10.0.0.7", `request=http://example.com/a\=b|c`, "fileHash=abc", "cs1=Eicar-Signature", "act=block"}
+	for _, part := range expected {
+		if !strings.Contains(cef, part) {
+			t.Errorf("expected %q in %q", part, cef)
+		}
+	}
+}
+
+func TestFormatCEFUnscanned(t *testing.T) {
+	record := testRecord()
+	record.Verdict, record.ThreatName = VerdictUnscanned, ""
+	cef := FormatCEF(record)
+	if !strings.HasPrefix(cef, "CEF:0|ICAPeg|ICAPeg|1.0|unscanned|ICAPeg allow unscanned|2|") || !strings.Contains(cef, "act=allow") {
+		t.Errorf("unexpected CEF record %q", cef)
+	}
+}
+
+func TestFormatLEEF(t *testing.T) {
+	leef := FormatLEEF(testRecord())
+	if !strings.HasPrefix(leef, "LEEF:1.0|ICAPeg|ICAPeg|1.0|malicious|") ||
+		!strings.Contains(leef, "\tsrc=10.0.0.7\t") || !strings.Contains(leef, "\tthreatName=Eicar-Signature") {
+		t.Errorf("unexpected LEEF record %q", leef)
+	}
+}
+
+func TestSecurityEventsOverTCP(t *testing.T) {
+	Logger = zap.NewNop()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if err = InitializeSecurityEvents(EventsConfig{Enabled: true, Format: EventFormatCEF,
+		Output: EventOutputTCP, Address: listener.Addr().String()}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { events = nil }()
+
+	clean := testRecord()
+	clean.Verdict = VerdictClean
+	writeSecurityEvent(clean)
+	writeSecurityEvent(testRecord())
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(line, "CEF:0|") || !strings.Contains(line, "cs1=Eicar-Signature") {
+		t.Errorf("unexpected event %q", line)
+	}
+}
@@ -1,34 +1,89 @@
 package logging
 
 import (
+	"fmt"
+	"os"
+	"time"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"os"
 )
 
 var Logger *zap.Logger
 
-func InitializeLogger(logLevel string, writeLogsToConsole bool) {
+// LogConfig is the configuration of the log sinks which is read from [app] and [logging] sections,
+// every sink has its own level and an empty level means the level of app.log_level
+type LogConfig struct {
+	Level              string
+	WriteLogsToConsole bool
+	File               string
+	FileLevel          string
+	MaxSize            int64
+	MaxAge             time.Duration
+	MaxBackups         int
+	StdoutJSON         bool
+	StdoutLevel        string
+	SyslogAddress      string
+	SyslogLevel        string
+	SyslogFacility     int
+	SyslogTag          string
+}
+
+// DefaultLogFile is the log file which is used when [logging] section doesn't set another one
+const DefaultLogFile = "./logs/logs.json"
+
+// sinkLevel returns the level of a sink, if the level isn't valid, the default level is returned
+func sinkLevel(level string, defaultLevel zapcore.Level) zapcore.Level {
+	if level == "" {
+		return defaultLevel
+	}
+	l, err := zapcore.ParseLevel(level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid log level \""+level+"\", "+defaultLevel.String()+" is used")
+		return defaultLevel
+	}
+	return l
+}
+
+func InitializeLogger(cfg LogConfig) {
 	config := zap.NewProductionEncoderConfig()
 	config.EncodeTime = zapcore.ISO8601TimeEncoder
-	fileEncoder := zapcore.NewJSONEncoder(config)
-	os.Mkdir("./logs", os.ModePerm)
-
-	logFile, _ := os.OpenFile("logs/logs.json", os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
-	writer := zapcore.AddSync(logFile)
-	defaultLogLevel, _ := zapcore.ParseLevel(logLevel)
-	var core zapcore.Core
-	if writeLogsToConsole {
+	defaultLogLevel := sinkLevel(cfg.Level, zapcore.InfoLevel)
+	var cores []zapcore.Core
+	var errs []error
+
+	if cfg.File != "" {
+		logFile, err := NewRotatingFile(cfg.File, cfg.MaxSize, cfg.MaxAge, cfg.MaxBackups)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't open the log file %s: %w", cfg.File, err))
+		} else {
+			cores = append(cores, zapcore.NewCore(zapcore.NewJSONEncoder(config), logFile,
+				sinkLevel(cfg.FileLevel, defaultLogLevel)))
+		}
+	}
+	if cfg.SyslogAddress != "" {
+		writer, err := NewSyslogWriter(cfg.SyslogAddress, cfg.SyslogTag)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't connect to syslog %s: %w", cfg.SyslogAddress, err))
+		} else {
+			cores = append(cores, newSyslogCore(zapcore.NewJSONEncoder(config), writer, cfg.SyslogFacility,
+				sinkLevel(cfg.SyslogLevel, defaultLogLevel)))
+		}
+	}
+	if cfg.StdoutJSON || (len(errs) > 0 && len(cores) == 0) {
+		// logs are written to stdout as JSON if the other sinks couldn't be opened,
+		// for example in read-only container filesystems, so they don't go nowhere
+		cores = append(cores, zapcore.NewCore(zapcore.NewJSONEncoder(config), zapcore.Lock(os.Stdout),
+			sinkLevel(cfg.StdoutLevel, defaultLogLevel)))
+	}
+	if cfg.WriteLogsToConsole {
 		consoleEncoder := zapcore.NewConsoleEncoder(config)
-		core = zapcore.NewTee(
-			zapcore.NewCore(fileEncoder, writer, defaultLogLevel),
-			zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), defaultLogLevel),
-		)
-	} else {
-		core = zapcore.NewTee(
-			zapcore.NewCore(fileEncoder, writer, defaultLogLevel),
-		)
+		cores = append(cores, zapcore.NewCore(consoleEncoder, zapcore.Lock(os.Stdout), defaultLogLevel))
 	}
 
-	Logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	Logger = zap.New(zapcore.NewTee(cores...), zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err.Error())
+		Logger.Error(err.Error())
+	}
 }
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"sync"
+)
+
+// the redaction modes, mask replaces the sensitive values by RedactedValue and hash replaces them by
+// their keyed hash, so values can still be correlated across log records without being exposed
+const (
+	RedactModeMask = "mask"
+	RedactModeHash = "hash"
+)
+
+// RedactedValue replaces the sensitive values in mask mode
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactHeaders are the headers which have credentials, they're redacted unless
+// [logging] section sets another list
+var DefaultRedactHeaders = []string{"Cookie", "Set-Cookie", "Authorization", "Proxy-Authorization", "X-Authenticated-User"}
+
+// RedactConfig is the configuration of the redaction of the logged headers
+type RedactConfig struct {
+	Headers       []string
+	ValuePatterns []string
+	Mode          string
+	HashKey       string
+}
+
+type redactor struct {
+	headers  map[string]bool
+	patterns []*regexp.Regexp
+	hash     bool
+	hashKey  []byte
+}
+
+var redactMu sync.RWMutex
+var currentRedactor = newRedactor(RedactConfig{Headers: DefaultRedactHeaders})
+
+func newRedactor(cfg RedactConfig) *redactor {
+	r := &redactor{headers: make(map[string]bool), hash: cfg.Mode == RedactModeHash, hashKey: []byte(cfg.HashKey)}
+	for _, header := range cfg.Headers {
+		r.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, pattern := range cfg.ValuePatterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(pattern))
+	}
+	if r.hash && len(r.hashKey) == 0 {
+		r.hashKey = make([]byte, 32)
+		rand.Read(r.hashKey)
+	}
+	return r
+}
+
+// InitializeRedaction sets the redaction of the logged headers, it returns an error
+// if a value pattern isn't a valid regular expression
+func InitializeRedaction(cfg RedactConfig) error {
+	for _, pattern := range cfg.ValuePatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+	r := newRedactor(cfg)
+	redactMu.Lock()
+	currentRedactor = r
+	redactMu.Unlock()
+	return nil
+}
+
+func (r *redactor) replacement(value string) string {
+	if !r.hash {
+		return RedactedValue
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// RedactHeader returns the value of a header as it should be logged, the value is replaced if the header is
+// one of the redacted headers, otherwise the parts of the value which match the value patterns are replaced
+func RedactHeader(name, value string) string {
+	redactMu.RLock()
+	r := currentRedactor
+	redactMu.RUnlock()
+	if r.headers[http.CanonicalHeaderKey(name)] {
+		return r.replacement(value)
+	}
+	for _, pattern := range r.patterns {
+		value = pattern.ReplaceAllStringFunc(value, r.replacement)
+	}
+	return value
+}
+
+// RedactHeaderValues is RedactHeader for all the values of a header
+func RedactHeaderValues(name string, values []string) []string {
+	redacted := make([]string, len(values))
+	for i, value := range values {
+		redacted[i] = RedactHeader(name, value)
+	}
+	return redacted
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactHeader(t *testing.T) {
+	defer InitializeRedaction(RedactConfig{Headers: DefaultRedactHeaders})
+
+	if got := RedactHeader("cookie", "session=abc"); got != RedactedValue {
+		t.Errorf("expected the cookie to be masked, got %q", got)
+	}
+	if got := RedactHeader("Accept", "text/html"); got != "text/html" {
+		t.Errorf("expected Accept not to be redacted, got %q", got)
+	}
+
+	err := InitializeRedaction(RedactConfig{Headers: []string{"Authorization"},
+		ValuePatterns: []string{`token=[^&\s]+`}, Mode: RedactModeHash, HashKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := RedactHeader("Authorization", "Bearer x"), RedactHeader("Authorization", "Bearer x")
+	if first != second || !strings.HasPrefix(first, "hmac-sha256:") || strings.Contains(first, "Bearer") {
+		t.Errorf("expected the same keyed hash for the same value, got %q and %q", first, second)
+	}
+	if got := RedactHeader("Referer", "http://example.com/?token=secret&a=b"); strings.Contains(got, "secret") ||
+		!strings.HasSuffix(got, "&a=b") {
+		t.Errorf("expected only the token to be redacted, got %q", got)
+	}
+	if err = InitializeRedaction(RedactConfig{ValuePatterns: []string{"("}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the format of the time which is added to the names of rotated files
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFile is a log file which is rotated when its size exceeds MaxSize,
+// rotated files are named by the rotation time (ex: logs-2006-01-02T15-04-05.000.json)
+// and they're deleted when they're older than MaxAge or when there are more than MaxBackups of them
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+}
+
+// NewRotatingFile opens the log file for appending and creates its directory if it doesn't exist,
+// zero values of maxSize, maxAge and maxBackups mean unlimited
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{Path: path, MaxSize: maxSize, MaxAge: maxAge, MaxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// Write writes p to the log file after rotating it if p makes its size exceed MaxSize,
+// if the rotation fails, p is still written to the log file and the rotation error is returned
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rotateErr error
+	if r.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxSize {
+		rotateErr = r.rotate()
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Sync commits the content of the log file to the disk
+func (r *RotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Sync()
+}
+
+// Close closes the log file
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return r.reopen(err)
+	}
+	ext := filepath.Ext(r.Path)
+	backup := strings.TrimSuffix(r.Path, ext) + "-" + time.Now().Format(backupTimeFormat) + ext
+	if err := os.Rename(r.Path, backup); err != nil {
+		return r.reopen(err)
+	}
+	if err := r.open(); err != nil {
+		return r.reopen(err)
+	}
+	r.prune()
+	return nil
+}
+
+// reopen opens the log file again for appending after a failed rotation, so the next writes
+// don't fail because the file is closed, it returns the error of the rotation
+func (r *RotatingFile) reopen(err error) error {
+	r.open()
+	return err
+}
+
+// prune deletes the rotated files which exceed the retention limits
+func (r *RotatingFile) prune() {
+	ext := filepath.Ext(r.Path)
+	backups, err := filepath.Glob(strings.TrimSuffix(r.Path, ext) + "-*" + ext)
+	if err != nil {
+		return
+	}
+	// the names have the rotation time, so sorting them puts the newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i, backup := range backups {
+		expired := false
+		if r.MaxAge > 0 {
+			if info, err := os.Stat(backup); err == nil && time.Since(info.ModTime()) > r.MaxAge {
+				expired = true
+			}
+		}
+		if expired || (r.MaxBackups > 0 && i >= r.MaxBackups) {
+			os.Remove(backup)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.json")
+	r, err := NewRotatingFile(path, 10, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, line := range []string{"0123456\n", "0123456\n", "0123456\n"} {
+		if _, err = r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "audit-*.json"))
+	if len(backups) != 1 {
+		t.Errorf("expected 1 backup, got %d", len(backups))
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "0123456\n" {
+		t.Errorf("unexpected content of the current file %q", content)
+	}
+}
+
+func TestRotatingFileReopensAfterFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.json")
+	r, err := NewRotatingFile(path, 10, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Write([]byte("0123456\n"))
+	// the rename of the rotation fails because the file doesn't exist anymore
+	os.Remove(path)
+	if _, err = r.Write([]byte("abcdefg\n")); err == nil {
+		t.Error("expected the rotation error")
+	}
+	if _, err = r.Write([]byte("h\n")); err != nil {
+		t.Fatalf("expected the file to be reopened, got %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "abcdefg\nh\n" {
+		t.Errorf("unexpected content of the reopened file %q", content)
+	}
+}
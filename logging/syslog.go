@@ -0,0 +1,170 @@
+package logging
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultSyslogFacility is the local0 facility
+const DefaultSyslogFacility = 16
+
+// syslog severities of RFC 5424
+const (
+	syslogEmergency = 0
+	syslogCritical  = 2
+	syslogError     = 3
+	syslogWarning   = 4
+	syslogInfo      = 6
+	syslogDebug     = 7
+)
+
+// SyslogWriter sends RFC 5424 messages to a syslog server over a Unix or UDP socket,
+// the address is written as unix:///dev/log or udp://host:514
+type SyslogWriter struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+	mu       sync.Mutex
+	conn     net.Conn
+}
+
+// NewSyslogWriter connects to the syslog server
+func NewSyslogWriter(address, tag string) (*SyslogWriter, error) {
+	w := &SyslogWriter{tag: tag}
+	if w.tag == "" {
+		w.tag = "icapeg"
+	}
+	switch {
+	case strings.HasPrefix(address, "unix://"):
+		w.network, w.address = "unixgram", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "udp://"):
+		w.network, w.address = "udp", strings.TrimPrefix(address, "udp://")
+	case strings.HasPrefix(address, "tcp://"):
+		w.network, w.address = "tcp", strings.TrimPrefix(address, "tcp://")
+	default:
+		return nil, errors.New("syslog address should start with unix://, udp:// or tcp://")
+	}
+	w.hostname, _ = os.Hostname()
+	if w.hostname == "" {
+		w.hostname = "-"
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *SyslogWriter) connect() error {
+	conn, err := net.Dial(w.network, w.address)
+	if err != nil && w.network == "unixgram" {
+		// some syslog daemons listen on a stream socket
+		conn, err = net.Dial("unix", w.address)
+	}
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// WriteMessage sends a message with the priority of the facility and the severity,
+// it reconnects once if sending fails
+func (w *SyslogWriter) WriteMessage(facility, severity int, msgID, msg string) error {
+	line := "<" + strconv.Itoa(facility*8+severity) + ">1 " + time.Now().Format(time.RFC3339Nano) + " " +
+		w.hostname + " " + w.tag + " " + strconv.Itoa(os.Getpid()) + " " + msgID + " - " + msg
+	if w.network == "tcp" {
+		// octet counting framing of RFC 6587
+		line = strconv.Itoa(len(line)) + " " + line
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		if _, err := w.conn.Write([]byte(line)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+	}
+	if err := w.connect(); err != nil {
+		w.conn = nil
+		return err
+	}
+	_, err := w.conn.Write([]byte(line))
+	return err
+}
+
+// Close closes the connection to the syslog server
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
+
+// syslogSeverity maps zap levels to syslog severities
+func syslogSeverity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return syslogDebug
+	case zapcore.InfoLevel:
+		return syslogInfo
+	case zapcore.WarnLevel:
+		return syslogWarning
+	case zapcore.ErrorLevel:
+		return syslogError
+	case zapcore.DPanicLevel, zapcore.PanicLevel:
+		return syslogCritical
+	default:
+		return syslogEmergency
+	}
+}
+
+// syslogCore is a zap core which sends every entry as a syslog message with the severity of its level
+type syslogCore struct {
+	zapcore.LevelEnabler
+	encoder  zapcore.Encoder
+	writer   *SyslogWriter
+	facility int
+}
+
+func newSyslogCore(encoder zapcore.Encoder, writer *SyslogWriter, facility int, level zapcore.LevelEnabler) zapcore.Core {
+	return &syslogCore{LevelEnabler: level, encoder: encoder, writer: writer, facility: facility}
+}
+
+func (c *syslogCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.encoder = c.encoder.Clone()
+	for _, field := range fields {
+		field.AddTo(clone.encoder)
+	}
+	return &clone
+}
+
+func (c *syslogCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *syslogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+	return c.writer.WriteMessage(c.facility, syslogSeverity(entry.Level), "-", strings.TrimSuffix(buf.String(), "\n"))
+}
+
+func (c *syslogCore) Sync() error {
+	return nil
+}
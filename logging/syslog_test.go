@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSyslogCore(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	writer, err := NewSyslogWriter("udp://"+server.LocalAddr().String(), "icapeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	logger := zap.New(newSyslogCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), writer,
+		DefaultSyslogFacility, zapcore.InfoLevel))
+	logger.Debug("filtered by the level of the sink")
+	logger.Warn("file is not safe")
+
+	buf := make([]byte, 1024)
+	n, _, err := server.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// local0.warning = 16*8+4
+	if !strings.HasPrefix(msg, "<132>1 ") || !strings.Contains(msg, " icapeg ") || !strings.Contains(msg, "file is not safe") {
+		t.Errorf("unexpected syslog message %q", msg)
+	}
+}
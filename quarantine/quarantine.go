@@ -0,0 +1,320 @@
+package quarantine
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"icapeg/logging"
+	"icapeg/readValues"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// the extensions of the files of a quarantine entry
+const (
+	bodyExt     = ".bin"
+	metadataExt = ".json"
+)
+
+// ErrNotFound is returned when there is no quarantine entry for the required hash
+var ErrNotFound = errors.New("quarantine entry not found")
+
+var sha256Pattern = regexp.MustCompile("^[a-f0-9]{64}$")
+
+// Metadata describes a quarantined file, it's stored as a JSON file next to the encrypted body
+type Metadata struct {
+	SHA256        string    `json:"sha256"`
+	URL           string    `json:"url"`
+	ClientIP      string    `json:"client_ip"`
+	Service       string    `json:"service"`
+	ThreatName    string    `json:"threat_name"`
+	Time          time.Time `json:"time"`
+	XICAPMetadata string    `json:"X-ICAP-Metadata"`
+	Size          int       `json:"size"`
+}
+
+// Quarantine represents the quarantine store configuration which is read from [quarantine] section
+type Quarantine struct {
+	Enabled     bool
+	Dir         string
+	key         []byte
+	MaxSize     int64
+	MaxAge      time.Duration
+	ZipPassword string
+	AdminToken  string
+	mu          sync.Mutex
+}
+
+var doOnce sync.Once
+var quarantineConfig *Quarantine
+
+// Init reads the optional [quarantine] section of config.toml file, the quarantine is disabled if
+// the section doesn't exist or the key is empty, the key is hashed by SHA-256 to be used as an AES-256 key
+func Init() *Quarantine {
+	doOnce.Do(func() {
+		quarantineConfig = &Quarantine{}
+		if !readValues.IsSecExists("quarantine") || !readValues.ReadValuesBool("quarantine.enabled") {
+			return
+		}
+		//the files aren't quarantined without a key instead of being encrypted with a well-known one
+		if readValues.ReadValuesString("quarantine.key") == "" {
+			logging.Logger.Error("quarantine key is empty, the quarantine is disabled")
+			return
+		}
+		key := sha256.Sum256([]byte(readValues.ReadValuesString("quarantine.key")))
+		quarantineConfig = &Quarantine{
+			Enabled:     true,
+			Dir:         readValues.ReadValuesString("quarantine.dir"),
+			key:         key[:],
+			MaxSize:     int64(readValues.ReadValuesInt("quarantine.max_size")),
+			MaxAge:      readValues.ReadValuesDuration("quarantine.max_age") * time.Hour,
+			ZipPassword: readValues.ReadValuesString("quarantine.zip_password"),
+			AdminToken:  readValues.ReadValuesString("quarantine.admin_token"),
+		}
+		if err := os.MkdirAll(quarantineConfig.Dir, 0700); err != nil {
+			logging.Logger.Error("couldn't create the quarantine directory: " + err.Error())
+			quarantineConfig.Enabled = false
+			return
+		}
+		go quarantineConfig.retentionLoop()
+	})
+	return quarantineConfig
+}
+
+// Store encrypts the body of a blocked HTTP message and writes it to the quarantine directory
+// named by its SHA-256 hash next to its metadata
+func Store(body []byte, metadata Metadata) error {
+	q := Init()
+	if !q.Enabled {
+		return nil
+	}
+	hash := sha256.Sum256(body)
+	metadata.SHA256 = hex.EncodeToString(hash[:])
+	metadata.Size = len(body)
+	if metadata.Time.IsZero() {
+		metadata.Time = time.Now().UTC()
+	}
+	encrypted, err := q.encrypt(body)
+	if err != nil {
+		return err
+	}
+	metadataJSON, err := jsonIndent(&metadata)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err = os.WriteFile(q.path(metadata.SHA256, bodyExt), encrypted, 0600); err != nil {
+		return err
+	}
+	if err = os.WriteFile(q.path(metadata.SHA256, metadataExt), metadataJSON, 0600); err != nil {
+		return err
+	}
+	q.enforceRetention()
+	return nil
+}
+
+// List returns the metadata of all quarantine entries, the newest first
+func List() ([]Metadata, error) {
+	q := Init()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.list()
+}
+
+// Get returns the decrypted body and the metadata of a quarantine entry
+func Get(sha256Hash string) ([]byte, *Metadata, error) {
+	q := Init()
+	if !sha256Pattern.MatchString(sha256Hash) {
+		return nil, nil, ErrNotFound
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	metadata, err := q.readMetadata(sha256Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := os.ReadFile(q.path(sha256Hash, bodyExt))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := q.decrypt(encrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, metadata, nil
+}
+
+// Purge deletes a quarantine entry
+func Purge(sha256Hash string) error {
+	q := Init()
+	if !sha256Pattern.MatchString(sha256Hash) {
+		return ErrNotFound
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := os.Stat(q.path(sha256Hash, metadataExt)); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return q.remove(sha256Hash)
+}
+
+// PurgeAll deletes all quarantine entries, it returns how many entries were deleted
+func PurgeAll() (int, error) {
+	q := Init()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries, err := q.list()
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if err = q.remove(entry.SHA256); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+func jsonIndent(metadata *Metadata) ([]byte, error) {
+	return json.MarshalIndent(metadata, "", "  ")
+}
+
+func (q *Quarantine) path(sha256Hash, ext string) string {
+	return filepath.Join(q.Dir, sha256Hash+ext)
+}
+
+func (q *Quarantine) remove(sha256Hash string) error {
+	if err := os.Remove(q.path(sha256Hash, bodyExt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(q.path(sha256Hash, metadataExt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (q *Quarantine) readMetadata(sha256Hash string) (*Metadata, error) {
+	content, err := os.ReadFile(q.path(sha256Hash, metadataExt))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	metadata := &Metadata{}
+	if err = json.Unmarshal(content, metadata); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (q *Quarantine) list() ([]Metadata, error) {
+	if !q.Enabled {
+		return []Metadata{}, nil
+	}
+	files, err := filepath.Glob(filepath.Join(q.Dir, "*"+metadataExt))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Metadata, 0, len(files))
+	for _, file := range files {
+		sha256Hash := filepath.Base(file[:len(file)-len(metadataExt)])
+		if !sha256Pattern.MatchString(sha256Hash) {
+			continue
+		}
+		metadata, err := q.readMetadata(sha256Hash)
+		if err != nil {
+			logging.Logger.Error("couldn't read the quarantine entry " + sha256Hash + ": " + err.Error())
+			continue
+		}
+		entries = append(entries, *metadata)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+	return entries, nil
+}
+
+// enforceRetention deletes the entries which are older than max_age and then the oldest
+// entries until the total size of the quarantine is not greater than max_size
+func (q *Quarantine) enforceRetention() {
+	entries, err := q.list()
+	if err != nil {
+		logging.Logger.Error("couldn't apply the quarantine retention: " + err.Error())
+		return
+	}
+	var total int64
+	for _, entry := range entries {
+		total += int64(entry.Size)
+	}
+	// entries are sorted from the newest to the oldest
+	for i := len(entries) - 1; i >= 0; i-- {
+		expired := q.MaxAge > 0 && time.Since(entries[i].Time) > q.MaxAge
+		exceeded := q.MaxSize > 0 && total > q.MaxSize
+		if !expired && !exceeded {
+			continue
+		}
+		if err = q.remove(entries[i].SHA256); err != nil {
+			logging.Logger.Error("couldn't delete the quarantine entry " + entries[i].SHA256 + ": " + err.Error())
+			continue
+		}
+		total -= int64(entries[i].Size)
+		logging.Logger.Info("quarantine entry " + entries[i].SHA256 + " is deleted by the retention policy")
+	}
+}
+
+// retentionLoop applies the retention policy periodically, so expired entries are deleted
+// even if no new files are quarantined
+func (q *Quarantine) retentionLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		q.mu.Lock()
+		q.enforceRetention()
+		q.mu.Unlock()
+	}
+}
+
+// encrypt encrypts the body with AES-256-GCM, the nonce is prepended to the cipher text
+func (q *Quarantine) encrypt(body []byte) ([]byte, error) {
+	block, err := aes.NewCipher(q.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, body, nil), nil
+}
+
+func (q *Quarantine) decrypt(encrypted []byte) ([]byte, error) {
+	block, err := aes.NewCipher(q.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) < gcm.NonceSize() {
+		return nil, errors.New("quarantine entry is corrupted")
+	}
+	nonce, cipherText := encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, cipherText, nil)
+}
@@ -0,0 +1,106 @@
+package quarantine
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"icapeg/logging"
+	"io"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func testQuarantine(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	key := sha256.Sum256([]byte("secret"))
+	doOnce.Do(func() {})
+	quarantineConfig = &Quarantine{Enabled: true, Dir: t.TempDir(), key: key[:], ZipPassword: "infected"}
+}
+
+func TestStoreAndPurge(t *testing.T) {
+	testQuarantine(t)
+	body := []byte("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*")
+	if err := Store(body, Metadata{URL: "http://example.com/eicar.com", Service: "clamav"}); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(body)
+	sha256Hash := hex.EncodeToString(hash[:])
+	got, metadata, err := Get(sha256Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, body) || metadata.URL != "http://example.com/eicar.com" || metadata.Size != len(body) {
+		t.Errorf("unexpected quarantine entry %+v", metadata)
+	}
+	if _, _, err = Get("../" + sha256Hash); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for an invalid hash, got %v", err)
+	}
+	if err = Purge(sha256Hash); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := List(); len(entries) != 0 {
+		t.Errorf("expected no entries after purge, got %d", len(entries))
+	}
+}
+
+func TestRetention(t *testing.T) {
+	testQuarantine(t)
+	quarantineConfig.MaxSize = 10
+	old := Metadata{Time: time.Now().Add(-time.Hour)}
+	if err := Store([]byte("0123456789"), old); err != nil {
+		t.Fatal(err)
+	}
+	if err := Store([]byte("abcdef"), Metadata{}); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := List()
+	if len(entries) != 1 || entries[0].Size != 6 {
+		t.Errorf("expected the oldest entry to be deleted, got %+v", entries)
+	}
+}
+
+// zipCryptoDecrypt is the inverse of zipCryptoWriter.encrypt
+func zipCryptoDecrypt(password string, data []byte) []byte {
+	z := newZipCryptoWriter(password)
+	out := make([]byte, len(data))
+	for i, c := range data {
+		temp := uint16(z.keys[2] | 2)
+		out[i] = c ^ byte((uint32(temp)*uint32(temp^1))>>8)
+		z.updateKeys(out[i])
+	}
+	return out
+}
+
+func TestPasswordZip(t *testing.T) {
+	content := []byte("malicious content")
+	var archive bytes.Buffer
+	if err := writePasswordZip(&archive, "infected", time.Now(), zipFile{name: "sample.bin", content: content}); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := reader.File[0]
+	if file.Flags&0x1 == 0 {
+		t.Fatal("the file is not flagged as encrypted")
+	}
+	raw, _ := file.OpenRaw()
+	encrypted, _ := io.ReadAll(raw)
+	decrypted := zipCryptoDecrypt("infected", encrypted)
+	if decrypted[11] != byte(file.CRC32>>24) {
+		t.Fatal("the password check byte doesn't match")
+	}
+	plain, err := io.ReadAll(flate.NewReader(bytes.NewReader(decrypted[12:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, content) || crc32.ChecksumIEEE(plain) != file.CRC32 {
+		t.Errorf("unexpected content %q", plain)
+	}
+}
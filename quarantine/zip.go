@@ -0,0 +1,114 @@
+package quarantine
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// zipCryptoWriter encrypts data with the traditional PKWARE encryption (ZipCrypto), it's weak,
+// but it's the one every archive tool can open, which is what analysts need for malware samples
+type zipCryptoWriter struct {
+	keys [3]uint32
+}
+
+func newZipCryptoWriter(password string) *zipCryptoWriter {
+	z := &zipCryptoWriter{keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for _, b := range []byte(password) {
+		z.updateKeys(b)
+	}
+	return z
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ (crc >> 8)
+}
+
+func (z *zipCryptoWriter) updateKeys(b byte) {
+	z.keys[0] = crc32Update(z.keys[0], b)
+	z.keys[1] = (z.keys[1]+z.keys[0]&0xff)*134775813 + 1
+	z.keys[2] = crc32Update(z.keys[2], byte(z.keys[1]>>24))
+}
+
+func (z *zipCryptoWriter) encrypt(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		temp := uint16(z.keys[2] | 2)
+		out[i] = b ^ byte((uint32(temp)*uint32(temp^1))>>8)
+		z.updateKeys(b)
+	}
+	return out
+}
+
+// zipFile is a file which is added to a password protected zip archive
+type zipFile struct {
+	name    string
+	content []byte
+}
+
+// writePasswordZip writes a zip archive whose files are deflated and encrypted with the password
+func writePasswordZip(w io.Writer, password string, modified time.Time, files ...zipFile) error {
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		var compressed bytes.Buffer
+		deflater, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+		if err != nil {
+			return err
+		}
+		if _, err = deflater.Write(file.content); err != nil {
+			return err
+		}
+		if err = deflater.Close(); err != nil {
+			return err
+		}
+		crc := crc32.ChecksumIEEE(file.content)
+
+		// the encryption header is 11 random bytes followed by the high byte of the CRC
+		// which archive tools use for checking the password
+		header := make([]byte, 12)
+		if _, err = io.ReadFull(rand.Reader, header[:11]); err != nil {
+			return err
+		}
+		header[11] = byte(crc >> 24)
+		encrypter := newZipCryptoWriter(password)
+		encrypted := append(encrypter.encrypt(header), encrypter.encrypt(compressed.Bytes())...)
+
+		fileHeader := &zip.FileHeader{
+			Name:               file.name,
+			Method:             zip.Deflate,
+			Flags:              0x1,
+			Modified:           modified,
+			CRC32:              crc,
+			CompressedSize64:   uint64(len(encrypted)),
+			UncompressedSize64: uint64(len(file.content)),
+		}
+		fw, err := archive.CreateRaw(fileHeader)
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(encrypted); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Download writes a quarantine entry to w as a zip archive which is protected by the configured
+// zip password, the archive has the quarantined file and its metadata
+func Download(w io.Writer, sha256Hash string) error {
+	body, metadata, err := Get(sha256Hash)
+	if err != nil {
+		return err
+	}
+	metadataJSON, err := jsonIndent(metadata)
+	if err != nil {
+		return err
+	}
+	return writePasswordZip(w, Init().ZipPassword, metadata.Time,
+		zipFile{name: sha256Hash + bodyExt, content: body},
+		zipFile{name: sha256Hash + metadataExt, content: metadataJSON})
+}
@@ -15,6 +15,12 @@ func ReadIntFromEnv(varName string) int {
 	return result
 }
 
+//ReadFloatFromEnv is used to get float64 value from env vars
+func ReadFloatFromEnv(varName string) float64 {
+	result, _ := strconv.ParseFloat(os.Getenv(varName), 64)
+	return result
+}
+
 //ReadStringFromEnv is used to get string value from env vars
 func ReadStringFromEnv(varName string) string {
 	return os.Getenv(varName)
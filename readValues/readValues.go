@@ -54,6 +54,28 @@ func ReadValuesString(varName string) string {
 	return result
 }
 
+// ReadValuesFloat is used to get the float64 value of from toml or from env vars
+//if it found the value of var in the toml value starts with "$_", it calls ReadFloatFromEnv which
+//retrieves th e value from env vars of the machine
+func ReadValuesFloat(varName string) float64 {
+
+	if err := viper.ReadInConfig(); err != nil {
+		log.Fatal(err.Error())
+	}
+	var result float64
+	tempName := viper.GetString(varName)
+	if strings.Index(tempName, "$_") == 0 {
+		result = ReadFloatFromEnv(tempName[2:len(tempName)])
+	} else {
+		if !viper.IsSet(varName) {
+			fmt.Println(varName + " doesn't exist in config.go file")
+			os.Exit(1)
+		}
+		result = viper.GetFloat64(varName)
+	}
+	return result
+}
+
 // ReadValuesBool is used to get the bool value of from toml or from env vars
 //if it found the value of var in the toml value starts with "$_", it calls ReadIntFromEnv which
 //retrieves th e value from env vars of the machine
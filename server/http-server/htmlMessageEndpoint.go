@@ -1,9 +1,7 @@
 package http_server
 
 import (
-	"bytes"
 	"encoding/json"
-	"html/template"
 	utils "icapeg/consts"
 	general_functions "icapeg/service/services-utilities/general-functions"
 	"net/http"
@@ -11,16 +9,16 @@ import (
 
 func HtmlMessage(w http.ResponseWriter, r *http.Request) {
 
-	htmlTmpl, _ := template.ParseFiles(utils.BlockPagePath)
-	htmlErrPage := &bytes.Buffer{}
 	var errPageStruct general_functions.ErrorPage
 	_ = json.NewDecoder(r.Body).Decode(&errPageStruct)
-	if errPageStruct.ExceptionPage != "" {
-		tmpl, err := template.ParseFiles(utils.BlockPagePath)
-		if err == nil {
-			htmlTmpl = tmpl
-		}
+	errPageStruct.Locale = general_functions.NegotiateLocale(r.Header.Get("Accept-Language"))
+	errPageStruct.Message = ""
+	format := general_functions.NegotiateBlockPageFormat(r.Header.Get("Accept"))
+	htmlPath := utils.BlockPagePath
+	if errPageStruct.Reason == utils.ErrPageReasonRiskyContent {
+		htmlPath = utils.WarnPagePath
 	}
-	htmlTmpl.Execute(htmlErrPage, &errPageStruct)
-	w.Write(htmlErrPage.Bytes())
+	errPage, contentType := general_functions.RenderBlockPage(&errPageStruct, format, htmlPath)
+	w.Header().Set(utils.ContentType, contentType)
+	w.Write(errPage.Bytes())
 }
@@ -0,0 +1,67 @@
+package http_server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/quarantine"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// QuarantinePath is the path of the quarantine admin endpoints
+const QuarantinePath = "/admin/quarantine"
+
+// Quarantine is the handler of the quarantine admin endpoints, they're authorized by the admin token
+// of [quarantine] section which is sent as a bearer token:
+//
+//	GET    /admin/quarantine          lists the quarantine entries
+//	DELETE /admin/quarantine          purges all the entries
+//	GET    /admin/quarantine/<sha256> downloads an entry in a zip archive protected by the zip password
+//	DELETE /admin/quarantine/<sha256> purges an entry
+func Quarantine(w http.ResponseWriter, r *http.Request) {
+	adminToken := quarantine.Init().AdminToken
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	sha256Hash := strings.Trim(strings.TrimPrefix(r.URL.Path, QuarantinePath), "/")
+	var err error
+	switch {
+	case r.Method == http.MethodGet && sha256Hash == "":
+		var entries []quarantine.Metadata
+		if entries, err = quarantine.List(); err == nil {
+			w.Header().Set(utils.ContentType, utils.JSONContentType)
+			err = json.NewEncoder(w).Encode(entries)
+		}
+	case r.Method == http.MethodGet:
+		if _, _, err = quarantine.Get(sha256Hash); err == nil {
+			w.Header().Set(utils.ContentType, "application/zip")
+			w.Header().Set("Content-Disposition", "attachment; filename=\""+sha256Hash+".zip\"")
+			err = quarantine.Download(w, sha256Hash)
+		}
+	case r.Method == http.MethodDelete && sha256Hash == "":
+		var purged int
+		if purged, err = quarantine.PurgeAll(); err == nil {
+			logging.Logger.Info("the quarantine is purged by an admin, entries: " + strconv.Itoa(purged))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case r.Method == http.MethodDelete:
+		if err = quarantine.Purge(sha256Hash); err == nil {
+			logging.Logger.Info("the quarantine entry " + sha256Hash + " is purged by an admin")
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err == quarantine.ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else if err != nil {
+		logging.Logger.Error("quarantine admin endpoint error: " + err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
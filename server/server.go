@@ -3,7 +3,9 @@ package server
 import (
 	"fmt"
 	"icapeg/logging"
+	"icapeg/quarantine"
 	http_server "icapeg/server/http-server"
+	"icapeg/webhook"
 	"net/http"
 	"os"
 	"os/signal"
@@ -24,10 +26,15 @@ func StartServer() error {
 	// and there, the request will be filtered to check if the service exists or not
 
 	config.Init()
+	webhook.Init()
 
 	//HTTP server
 	htmlWebServer := http.NewServeMux()
 	htmlWebServer.HandleFunc("/service/message", http_server.HtmlMessage)
+	if quarantine.Init().Enabled {
+		htmlWebServer.HandleFunc(http_server.QuarantinePath, http_server.Quarantine)
+		htmlWebServer.HandleFunc(http_server.QuarantinePath+"/", http_server.Quarantine)
+	}
 	go func() {
 		http.ListenAndServe(":8081", htmlWebServer)
 	}()
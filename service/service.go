@@ -3,17 +3,41 @@ package service
 import (
 	http_message "icapeg/http-message"
 	"icapeg/logging"
+	"icapeg/readValues"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"icapeg/service/services/activecontent"
 	"icapeg/service/services/clamav"
 	"icapeg/service/services/clhashlookup"
+	"icapeg/service/services/cloudmersive"
+	"icapeg/service/services/command"
 	"icapeg/service/services/echo"
+	"icapeg/service/services/hashlist"
+	"icapeg/service/services/headers"
+	"icapeg/service/services/htmlrewrite"
+	icap_upstream "icapeg/service/services/icap-upstream"
+	"icapeg/service/services/rest"
+	"icapeg/service/services/rewrite"
+	"icapeg/service/services/urlfilter"
+	"icapeg/service/services/virustotal"
 	"net/textproto"
 )
 
 // Vendors names
 const (
-	VendorEcho       = "echo"
-	VendorClamav     = "clamav"
-	VendorHashlookup = "clhashlookup"
+	VendorEcho          = "echo"
+	VendorClamav        = "clamav"
+	VendorHashlookup    = "clhashlookup"
+	VendorRest          = "rest"
+	VendorVirusTotal    = "virustotal"
+	VendorCloudmersive  = "cloudmersive"
+	VendorIcapUpstream  = "icap_upstream"
+	VendorCommand       = "command"
+	VendorHashlist      = "hashlist"
+	VendorUrlfilter     = "urlfilter"
+	VendorActivecontent = "activecontent"
+	VendorHtmlrewrite   = "htmlrewrite"
+	VendorHeaders       = "headers"
+	VendorRewrite       = "rewrite"
 )
 
 type (
@@ -36,14 +60,53 @@ func GetService(vendor, serviceName, methodName string, httpMsg *http_message.Ht
 		return clhashlookup.NewHashlookupService(serviceName, methodName, httpMsg, xICAPMetadata)
 	case VendorClamav:
 		return clamav.NewClamavService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorRest:
+		return rest.NewRestService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorVirusTotal:
+		return virustotal.NewVirusTotalService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorCloudmersive:
+		return cloudmersive.NewCloudmersiveService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorIcapUpstream:
+		return icap_upstream.NewIcapUpstreamService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorCommand:
+		return command.NewCommandService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorHashlist:
+		return hashlist.NewHashlistService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorUrlfilter:
+		return urlfilter.NewUrlfilterService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorActivecontent:
+		return activecontent.NewActivecontentService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorHtmlrewrite:
+		return htmlrewrite.NewHtmlrewriteService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorHeaders:
+		return headers.NewHeadersService(serviceName, methodName, httpMsg, xICAPMetadata)
+	case VendorRewrite:
+		return rewrite.NewRewriteService(serviceName, methodName, httpMsg, xICAPMetadata)
 
 	}
 	return nil
 }
 
+// ScansBody checks if the services of the vendor process the body of the http request,
+// the services which only check the URL or the headers don't need the files of the JSON payloads
+func ScansBody(vendor string) bool {
+	switch vendor {
+	case VendorUrlfilter, VendorHtmlrewrite, VendorHeaders, VendorRewrite:
+		return false
+	}
+	return true
+}
+
 // InitServiceConfig is used to load the services configuration
 func InitServiceConfig(vendor, serviceName string) {
 	logging.Logger.Info("loading all the services configuration")
+	general_functions.InitBlockPages(serviceName)
+	general_functions.InitExecutableRules(serviceName)
+	general_functions.InitFileNamePolicy(serviceName)
+	if !ScansBody(vendor) && readValues.IsSecExists(serviceName+".content_policy") {
+		logging.Logger.Fatal(serviceName + ".content_policy isn't supported by " + vendor + " services")
+	}
+	general_functions.InitContentPolicy(serviceName)
 	switch vendor {
 	case VendorEcho:
 		echo.InitEchoConfig(serviceName)
@@ -51,5 +114,27 @@ func InitServiceConfig(vendor, serviceName string) {
 		clhashlookup.InitHashlookupConfig(serviceName)
 	case VendorClamav:
 		clamav.InitClamavConfig(serviceName)
+	case VendorRest:
+		rest.InitRestConfig(serviceName)
+	case VendorVirusTotal:
+		virustotal.InitVirusTotalConfig(serviceName)
+	case VendorCloudmersive:
+		cloudmersive.InitCloudmersiveConfig(serviceName)
+	case VendorIcapUpstream:
+		icap_upstream.InitIcapUpstreamConfig(serviceName)
+	case VendorCommand:
+		command.InitCommandConfig(serviceName)
+	case VendorHashlist:
+		hashlist.InitHashlistConfig(serviceName)
+	case VendorUrlfilter:
+		urlfilter.InitUrlfilterConfig(serviceName)
+	case VendorActivecontent:
+		activecontent.InitActivecontentConfig(serviceName)
+	case VendorHtmlrewrite:
+		htmlrewrite.InitHtmlrewriteConfig(serviceName)
+	case VendorHeaders:
+		headers.InitHeadersConfig(serviceName)
+	case VendorRewrite:
+		rewrite.InitRewriteConfig(serviceName)
 	}
 }
@@ -2,7 +2,6 @@ package ContentTypes
 
 import (
 	"bytes"
-	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -22,24 +21,14 @@ func GetContentType(req *http.Request) ContentType {
 	// if the content-type string has "multipart/", the func will return a new instance from MultipartForm struct
 	if strings.HasPrefix(contentType, "multipart/") {
 		return NewMultipartForm(ParsingRequest(req))
-	} else if strings.HasPrefix(contentType, "application/json") {
+	} else if isJSON(contentType) {
+		body, _ := ioutil.ReadAll(req.Body)
+		return ParseJSONFile(contentType, body)
+	} else if strings.HasPrefix(strings.ToLower(contentType), "application/x-www-form-urlencoded") {
 
-		//in this case there are two odds
-		//first is that file encoded in base64 and second is that file is actually a JSON file,
-		//so we convert the JSON file to a map
-		var data map[string]interface{}
+		//the fields of the form are exposed to the services which can change them one by one
 		body, _ := ioutil.ReadAll(req.Body)
-		_ = json.Unmarshal(body, &data)
-
-		//checking if there is key equals "Base64", the file would be encoded
-		// if no, the file is a norma JSON file
-		_, found := data["Base64"]
-		if found {
-			return NewEncodedFile(data)
-		} else {
-			j, _ := json.Marshal(data)
-			return NewRegularFile(bytes.NewBuffer(j), false)
-		}
+		return NewURLEncodedForm(body)
 	}
 
 	//if this code be reached, the file will be a normal file
@@ -47,3 +36,25 @@ func GetContentType(req *http.Request) ContentType {
 	io.Copy(buf, req.Body)
 	return NewRegularFile(buf, false)
 }
+
+// ParseJSONFile parses the body of the http request if it's JSON, nil is returned for the other bodies
+// in this case there are two odds
+// first is that the payload has files encoded in base64 at the JSON paths of app.json_file_paths,
+// a *JSONFile is returned and its files are processed one by one with JSONFile.WithFile
+// and second is that the file is actually a JSON file, in both cases the payload isn't changed
+func ParseJSONFile(contentType string, body []byte) ContentType {
+	if !isJSON(contentType) {
+		return nil
+	}
+	if jsonFile := NewJSONFile(body); jsonFile != nil {
+		return jsonFile
+	}
+	//the buffer doesn't share the body because the services change the file in its place
+	return NewRegularFile(bytes.NewBuffer(append([]byte(nil), body...)), false)
+}
+
+// isJSON checks if the content-type is JSON (ex: application/json, application/vnd.api+json)
+func isJSON(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,207 @@
+package ContentTypes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"icapeg/readValues"
+	json_path "icapeg/service/services-utilities/json-path"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultJSONFilePaths is the JSON path of the base64 file when app.json_file_paths isn't set
+var defaultJSONFilePaths = []string{"Base64"}
+
+var jsonPathsOnce sync.Once
+var jsonFilePaths []string
+
+// base64Encodings are the encodings which the files in JSON payloads may be encoded with
+var base64Encodings = []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding,
+	base64.RawURLEncoding}
+
+// encodedFile is a base64 file in a JSON payload, start and end are the offsets of
+// its JSON string (quotes included) in the body
+type encodedFile struct {
+	start    int
+	end      int
+	prefix   string
+	encoding *base64.Encoding
+	content  []byte
+}
+
+// JSONFile is a JSON payload which has base64 files at the JSON paths of app.json_file_paths,
+// one of its files is processed and the rest of the payload is kept as it is
+type JSONFile struct {
+	body  []byte
+	files []encodedFile
+	index int
+}
+
+// GetFileFromRequest is used for getting the decoded file of the JSON payload which is processed
+func (j JSONFile) GetFileFromRequest() *bytes.Buffer {
+	return bytes.NewBuffer(j.files[j.index].content)
+}
+
+// BodyAfterScanning is used for returning the JSON payload to be written in the http request body,
+// the original payload is returned if the file didn't change, otherwise the file is encoded again
+// and its JSON string is replaced in the original payload
+func (j JSONFile) BodyAfterScanning(bodyByte []byte) string {
+	file := j.files[j.index]
+	if bytes.Equal(bodyByte, file.content) {
+		return string(j.body)
+	}
+	encoded, _ := json.Marshal(file.prefix + file.encoding.EncodeToString(bodyByte))
+	return string(j.body[:file.start]) + string(encoded) + string(j.body[file.end:])
+}
+
+// FilesCount returns the number of the base64 files in the JSON payload
+func (j JSONFile) FilesCount() int {
+	return len(j.files)
+}
+
+// WithFile returns the JSON payload with another file to be processed, the payload isn't parsed again
+func (j JSONFile) WithFile(index int) *JSONFile {
+	if index < 0 || index >= len(j.files) {
+		index = 0
+	}
+	j.index = index
+	return &j
+}
+
+// NewJSONFile is used for returning a new instance from JSONFile struct, nil is returned if the body
+// isn't valid JSON or it doesn't have files, the first file is processed
+func NewJSONFile(body []byte) *JSONFile {
+	files := findEncodedFiles(body, readJSONFilePaths())
+	if len(files) == 0 {
+		return nil
+	}
+	return &JSONFile{body: body, files: files}
+}
+
+// readJSONFilePaths reads the optional app.json_file_paths variable
+func readJSONFilePaths() []string {
+	jsonPathsOnce.Do(func() {
+		jsonFilePaths = defaultJSONFilePaths
+		if readValues.IsSecExists("app.json_file_paths") {
+			jsonFilePaths = readValues.ReadValuesSlice("app.json_file_paths")
+		}
+	})
+	return jsonFilePaths
+}
+
+// jsonFrame is an object or an array which the JSON decoder is inside
+type jsonFrame struct {
+	array       bool
+	index       int
+	key         string
+	keyExpected bool
+}
+
+// findEncodedFiles walks the tokens of the JSON body and returns the base64 strings whose keys match one
+// of the paths, the strings of an array which matches a path are files too, nothing is returned if the
+// body isn't valid JSON
+func findEncodedFiles(body []byte, paths []string) []encodedFile {
+	if len(paths) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	var stack []*jsonFrame
+	var files []encodedFile
+	for {
+		offset := int(dec.InputOffset())
+		token, err := dec.Token()
+		if err != nil {
+			if err == io.EOF && len(stack) == 0 {
+				return files
+			}
+			return nil
+		}
+		var top *jsonFrame
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+		if top != nil && top.keyExpected {
+			if key, ok := token.(string); ok {
+				top.key = key
+				top.keyExpected = false
+				continue
+			}
+		}
+		switch t := token.(type) {
+		case json.Delim:
+			switch t {
+			case '{':
+				stack = append(stack, &jsonFrame{keyExpected: true})
+				continue
+			case '[':
+				stack = append(stack, &jsonFrame{array: true})
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		case string:
+			if !matchesAnyPath(paths, stack) {
+				break
+			}
+			if file, ok := decodeEncodedFile(t); ok {
+				file.start = offset + bytes.IndexByte(body[offset:], '"')
+				file.end = int(dec.InputOffset())
+				files = append(files, file)
+			}
+		}
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+			if top.array {
+				top.index++
+			} else {
+				top.keyExpected = true
+			}
+		}
+	}
+}
+
+// matchesAnyPath checks if the value which the decoder is at matches one of the paths
+func matchesAnyPath(paths []string, stack []*jsonFrame) bool {
+	keys := make([]string, len(stack))
+	for i, frame := range stack {
+		if frame.array {
+			keys[i] = strconv.Itoa(frame.index)
+		} else {
+			keys[i] = frame.key
+		}
+	}
+	inArray := len(stack) > 0 && stack[len(stack)-1].array
+	for _, path := range paths {
+		if json_path.Match(path, keys) || (inArray && json_path.Match(path, keys[:len(keys)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeEncodedFile decodes a base64 string, the data URLs (ex: data:application/pdf;base64,JVBERi0=)
+// keep their prefix when the file is encoded again
+func decodeEncodedFile(value string) (encodedFile, bool) {
+	file := encodedFile{}
+	if strings.HasPrefix(value, "data:") {
+		i := strings.Index(value, ";base64,")
+		if i == -1 {
+			return file, false
+		}
+		file.prefix = value[:i+len(";base64,")]
+		value = value[len(file.prefix):]
+	}
+	if value == "" {
+		return file, false
+	}
+	for _, encoding := range base64Encodings {
+		if content, err := encoding.DecodeString(value); err == nil {
+			file.encoding = encoding
+			file.content = content
+			return file, true
+		}
+	}
+	return file, false
+}
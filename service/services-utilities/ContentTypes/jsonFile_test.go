@@ -0,0 +1,51 @@
+package ContentTypes
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFindEncodedFiles(t *testing.T) {
+	body := []byte(`{"id": 12345678901234567890, "Base64": "` + base64.StdEncoding.EncodeToString([]byte("top")) + `",
+		"message": {"attachments": [{"name": "a.pdf", "content": "data:application/pdf;base64,` +
+		base64.StdEncoding.EncodeToString([]byte("%PDF")) + `"}, {"content": "bm90IGEgZmlsZQ"}]},
+		"files": ["` + base64.StdEncoding.EncodeToString([]byte("first")) + `", "second?"]}`)
+	paths := []string{"Base64", "message.attachments[*].content", "files"}
+	var got []string
+	for _, file := range findEncodedFiles(body, paths) {
+		got = append(got, string(file.content))
+	}
+	if expected := "top,%PDF,not a file,first"; strings.Join(got, ",") != expected {
+		t.Errorf("expected %q, got %q", expected, strings.Join(got, ","))
+	}
+	if files := findEncodedFiles([]byte(`{"Base64": "dG9w"`), paths); files != nil {
+		t.Errorf("expected no files in invalid JSON, got %d", len(files))
+	}
+}
+
+func TestJSONFileBodyAfterScanning(t *testing.T) {
+	body := `{ "b": 1.000000000000000001, "files" : [ "` + base64.StdEncoding.EncodeToString([]byte("one")) +
+		`", "data:text/plain;base64,` + base64.StdEncoding.EncodeToString([]byte("two")) + `" ] }`
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/api", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if contentType, ok := ParseJSONFile(req.Header.Get("Content-Type"), []byte(body)).(RegularFile); !ok ||
+		contentType.Buf.String() != body {
+		t.Errorf("expected the JSON file without files with the default paths, got %T", contentType)
+	}
+
+	files := findEncodedFiles([]byte(body), []string{"files"})
+	j := JSONFile{body: []byte(body), files: files}.WithFile(1)
+	if got := j.GetFileFromRequest().String(); got != "two" {
+		t.Errorf("expected the second file, got %q", got)
+	}
+	if got := j.BodyAfterScanning([]byte("two")); got != body {
+		t.Errorf("expected the original body, got %s", got)
+	}
+	expected := strings.Replace(body, base64.StdEncoding.EncodeToString([]byte("two")),
+		base64.StdEncoding.EncodeToString([]byte("2")), 1)
+	if got := j.BodyAfterScanning([]byte("2")); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
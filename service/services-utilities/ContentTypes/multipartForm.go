@@ -25,6 +25,11 @@ func (m MultipartForm) GetFileFromRequest() *bytes.Buffer {
 	return bytes.NewBuffer(m.theFile.Content)
 }
 
+// FileName returns the name of the file part of the multipart form
+func (m MultipartForm) FileName() string {
+	return m.theFile.FileName
+}
+
 // ParsingRequest is utility function to GetFileFromRequest function, and it's used for helping functions which are outside the pkg
 // to initialize a new instance from MultipartForm struct
 func ParsingRequest(req *http.Request) ([]FormPart, FormPart, string) {
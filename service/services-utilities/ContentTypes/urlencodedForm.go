@@ -0,0 +1,86 @@
+package ContentTypes
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+)
+
+// FormField is a field of an application/x-www-form-urlencoded form, Name and Value are decoded
+type FormField struct {
+	Name    string
+	Value   string
+	raw     string
+	changed bool
+}
+
+// URLEncodedForm is an application/x-www-form-urlencoded form, the services can match its fields
+// and change their values, the fields which didn't change keep their original encoding
+type URLEncodedForm struct {
+	body   []byte
+	fields []FormField
+}
+
+// GetFileFromRequest is used for getting the body of the form as it is
+func (u *URLEncodedForm) GetFileFromRequest() *bytes.Buffer {
+	return bytes.NewBuffer(u.body)
+}
+
+// Fields returns the fields of the form in their order
+func (u *URLEncodedForm) Fields() []FormField {
+	fields := make([]FormField, len(u.fields))
+	copy(fields, u.fields)
+	return fields
+}
+
+// SetValue changes the value of the field at the index (ex: to redact it), the other fields aren't changed
+func (u *URLEncodedForm) SetValue(index int, value string) {
+	if index < 0 || index >= len(u.fields) || u.fields[index].Value == value {
+		return
+	}
+	u.fields[index].Value = value
+	u.fields[index].changed = true
+}
+
+// BodyAfterScanning is used for returning the form to be written in the http request body, the fields
+// keep their order and only the changed fields are encoded again, if the service replaced the whole
+// body, the new body is returned as it is
+func (u *URLEncodedForm) BodyAfterScanning(bodyByte []byte) string {
+	if !bytes.Equal(bodyByte, u.body) {
+		return string(bodyByte)
+	}
+	parts := make([]string, len(u.fields))
+	changed := false
+	for i, field := range u.fields {
+		parts[i] = field.raw
+		if field.changed {
+			parts[i] = url.QueryEscape(field.Name) + "=" + url.QueryEscape(field.Value)
+			changed = true
+		}
+	}
+	if !changed {
+		return string(u.body)
+	}
+	return strings.Join(parts, "&")
+}
+
+// NewURLEncodedForm is used for returning a new instance from URLEncodedForm struct, the fields
+// which can't be decoded keep their raw name and value
+func NewURLEncodedForm(body []byte) *URLEncodedForm {
+	u := &URLEncodedForm{body: body}
+	if len(body) == 0 {
+		return u
+	}
+	for _, raw := range strings.Split(string(body), "&") {
+		name, value, _ := strings.Cut(raw, "=")
+		field := FormField{Name: name, Value: value, raw: raw}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			field.Name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			field.Value = unescaped
+		}
+		u.fields = append(u.fields, field)
+	}
+	return u
+}
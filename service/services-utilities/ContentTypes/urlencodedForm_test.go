@@ -0,0 +1,38 @@
+package ContentTypes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestURLEncodedForm(t *testing.T) {
+	body := "user=j%2Edoe&card=4111+1111+1111+1111&note=a%20b&flag&bad=%zz"
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+	form, ok := GetContentType(req).(*URLEncodedForm)
+	if !ok {
+		t.Fatal("expected a URLEncodedForm")
+	}
+	fields := form.Fields()
+	var got []string
+	for _, field := range fields {
+		got = append(got, field.Name+"="+field.Value)
+	}
+	if expected := "user=j.doe,card=4111 1111 1111 1111,note=a b,flag=,bad=%zz"; strings.Join(got, ",") != expected {
+		t.Errorf("expected %q, got %q", expected, strings.Join(got, ","))
+	}
+
+	scanned := form.GetFileFromRequest().Bytes()
+	if after := form.BodyAfterScanning(scanned); after != body {
+		t.Errorf("expected the original body, got %q", after)
+	}
+	form.SetValue(1, "[REDACTED]")
+	expected := "user=j%2Edoe&card=%5BREDACTED%5D&note=a%20b&flag&bad=%zz"
+	if after := form.BodyAfterScanning(scanned); after != expected {
+		t.Errorf("expected %q, got %q", expected, after)
+	}
+	if after := form.BodyAfterScanning([]byte("<html>blocked</html>")); after != "<html>blocked</html>" {
+		t.Errorf("expected the new body, got %q", after)
+	}
+}
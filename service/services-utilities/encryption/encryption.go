@@ -0,0 +1,111 @@
+package encryption
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"icapeg/service/services-utilities/magic"
+	"icapeg/service/services-utilities/ole2"
+	"regexp"
+)
+
+// the types of the encrypted files which can be detected
+const (
+	TypeZip        = "zip"
+	TypePDF        = "pdf"
+	TypeOOXML      = "ooxml"
+	TypeWord       = "doc"
+	TypeExcel      = "xls"
+	TypePowerPoint = "ppt"
+)
+
+// pdfEncrypt matches the /Encrypt entry of the trailer, /EncryptMetadata of the encryption dictionary doesn't match
+var pdfEncrypt = regexp.MustCompile(`/Encrypt(?:[^A-Za-z0-9#]|$)`)
+
+// the records of the Excel workbook stream (BIFF8) which are used to find the FILEPASS record
+const (
+	biffEOF      = 0x000A
+	biffFilePass = 0x002F
+	// maxBIFFRecords limits the records which are read before the FILEPASS record, it follows the BOF record
+	maxBIFFRecords = 1024
+)
+
+// Detect returns the type of the file if it's encrypted (ex: a zip archive which has encrypted entries,
+// a PDF which has an encryption dictionary or an office document which is protected by a password),
+// it returns an empty string if the file isn't encrypted, the type of the file is detected by its content
+func Detect(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, magic.Zip):
+		return detectZip(data)
+	case bytes.HasPrefix(data, ole2.Magic):
+		return detectOLE2(data)
+	case magic.IsPDF(data):
+		if pdfEncrypt.Match(data) {
+			return TypePDF, nil
+		}
+	}
+	return "", nil
+}
+
+// detectZip checks the encryption flag of the entries of the zip archive, the OOXML documents which are
+// protected by a password aren't zip archives, they're OLE2 compound files
+func detectZip(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range archive.File {
+		if file.Flags&0x1 != 0 {
+			return TypeZip, nil
+		}
+	}
+	return "", nil
+}
+
+// detectOLE2 looks for the streams of the encrypted OOXML documents and for the encryption flags of
+// the Word, Excel and PowerPoint binary documents
+func detectOLE2(data []byte) (string, error) {
+	file, err := ole2.Open(data)
+	if err != nil {
+		return "", err
+	}
+	if file.Has("EncryptionInfo") && file.Has("EncryptedPackage") {
+		return TypeOOXML, nil
+	}
+	if file.Has("EncryptedSummary") {
+		return TypePowerPoint, nil
+	}
+	if file.Has("WordDocument") {
+		// the fEncrypted flag of the FIB which is at the start of the WordDocument stream
+		fib, err := file.Stream("WordDocument")
+		if len(fib) >= 12 && binary.LittleEndian.Uint16(fib[0x0A:])&0x0100 != 0 {
+			return TypeWord, nil
+		}
+		return "", err
+	}
+	for _, name := range []string{"Workbook", "Book"} {
+		if !file.Has(name) {
+			continue
+		}
+		workbook, err := file.Stream(name)
+		if hasFilePass(workbook) {
+			return TypeExcel, nil
+		}
+		return "", err
+	}
+	return "", nil
+}
+
+// hasFilePass reads the records of the workbook globals substream until the FILEPASS or the EOF record
+func hasFilePass(workbook []byte) bool {
+	for i, offset := 0, 0; i < maxBIFFRecords && offset+4 <= len(workbook); i++ {
+		switch binary.LittleEndian.Uint16(workbook[offset:]) {
+		case biffFilePass:
+			return true
+		case biffEOF:
+			return false
+		}
+		offset += 4 + int(binary.LittleEndian.Uint16(workbook[offset+2:]))
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package encryption
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"icapeg/service/services-utilities/ole2"
+	"testing"
+	"unicode/utf16"
+)
+
+func zipFile(t *testing.T, flags uint16) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "secret.txt", Flags: flags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("x"))
+	w.Close()
+	return buf.Bytes()
+}
+
+// compoundFile builds a compound file which has a FAT sector, a directory sector and a stream of 4096 bytes
+// (the mini stream cutoff) with the content, the other entries are storages
+func compoundFile(stream string, content []byte, names ...string) []byte {
+	const sectors = 4096 / 512
+	data := make([]byte, (3+sectors)*512)
+	copy(data, ole2.Magic)
+	binary.LittleEndian.PutUint16(data[0x1E:], 9)
+	binary.LittleEndian.PutUint32(data[0x2C:], 1)
+	binary.LittleEndian.PutUint32(data[0x30:], 1)
+	binary.LittleEndian.PutUint32(data[0x38:], 4096)
+	binary.LittleEndian.PutUint32(data[0x3C:], 0xFFFFFFFE)
+	binary.LittleEndian.PutUint32(data[0x44:], 0xFFFFFFFE)
+	for i := 0; i < 109; i++ {
+		binary.LittleEndian.PutUint32(data[0x4C+4*i:], 0xFFFFFFFF)
+	}
+	binary.LittleEndian.PutUint32(data[0x4C:], 0)
+	fat := data[512:1024]
+	binary.LittleEndian.PutUint32(fat[0:], 0xFFFFFFFD)
+	binary.LittleEndian.PutUint32(fat[4:], 0xFFFFFFFE)
+	for i := 2; i < 2+sectors; i++ {
+		binary.LittleEndian.PutUint32(fat[4*i:], uint32(i+1))
+	}
+	binary.LittleEndian.PutUint32(fat[4*(1+sectors):], 0xFFFFFFFE)
+	copy(data[3*512:], content)
+
+	dir := data[1024:1536]
+	for i, name := range append([]string{"Root Entry", stream}, names...) {
+		entry := dir[128*i:]
+		units := utf16.Encode([]rune(name))
+		for j, u := range units {
+			binary.LittleEndian.PutUint16(entry[2*j:], u)
+		}
+		binary.LittleEndian.PutUint16(entry[64:], uint16(2*len(units)+2))
+		switch i {
+		case 0:
+			entry[66] = ole2.TypeRoot
+			binary.LittleEndian.PutUint32(entry[116:], 0xFFFFFFFE)
+		case 1:
+			entry[66] = ole2.TypeStream
+			binary.LittleEndian.PutUint32(entry[116:], 2)
+			binary.LittleEndian.PutUint32(entry[120:], 4096)
+		default:
+			entry[66] = ole2.TypeStorage
+		}
+	}
+	return data
+}
+
+// biffRecords builds the records of a workbook stream which starts with the BOF record
+func biffRecords(types ...uint16) []byte {
+	var buf bytes.Buffer
+	for _, t := range append([]uint16{0x0809}, types...) {
+		binary.Write(&buf, binary.LittleEndian, [2]uint16{t, 2})
+		buf.Write([]byte{0, 0})
+	}
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	encryptedFIB := make([]byte, 12)
+	binary.LittleEndian.PutUint16(encryptedFIB[0x0A:], 0x0100)
+
+	for name, test := range map[string]struct {
+		data     []byte
+		expected string
+	}{
+		"encrypted zip":          {zipFile(t, 0x1), TypeZip},
+		"zip":                    {zipFile(t, 0), ""},
+		"encrypted pdf":          {[]byte("%PDF-1.7\ntrailer\n<</Root 1 0 R/Encrypt 5 0 R>>\n"), TypePDF},
+		"pdf with metadata flag": {[]byte("%PDF-1.7\n1 0 obj <</EncryptMetadata false>>\n"), ""},
+		"pdf":                    {[]byte("%PDF-1.7\n1 0 obj <</Type/Catalog>>\n"), ""},
+		"encrypted docx":         {compoundFile("EncryptionInfo", nil, "EncryptedPackage"), TypeOOXML},
+		"encrypted doc":          {compoundFile("WordDocument", encryptedFIB), TypeWord},
+		"doc":                    {compoundFile("WordDocument", make([]byte, 12)), ""},
+		"encrypted xls":          {compoundFile("Workbook", biffRecords(0x00E1, biffFilePass, biffEOF)), TypeExcel},
+		"xls with a late record": {compoundFile("Workbook", biffRecords(biffEOF, biffFilePass)), ""},
+		"encrypted ppt":          {compoundFile("PowerPoint Document", nil, "EncryptedSummary"), TypePowerPoint},
+		"text file":              {[]byte("hello"), ""},
+	} {
+		fileType, err := Detect(test.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		if fileType != test.expected {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, fileType)
+		}
+	}
+}
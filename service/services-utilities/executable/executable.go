@@ -0,0 +1,249 @@
+package executable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path"
+	"strings"
+)
+
+// the types of the detected files
+const (
+	TypePE     = "pe"
+	TypeELF    = "elf"
+	TypeMachO  = "macho"
+	TypeLNK    = "lnk"
+	TypeScript = "script"
+)
+
+// the types of the detected scripts
+const (
+	ScriptShell      = "shell"
+	ScriptPython     = "python"
+	ScriptPerl       = "perl"
+	ScriptRuby       = "ruby"
+	ScriptNode       = "node"
+	ScriptPowerShell = "powershell"
+	ScriptHTA        = "hta"
+	ScriptJScript    = "jscript"
+	ScriptVBScript   = "vbscript"
+)
+
+// maxScriptScan is the size of the start of a text file which is searched for the script indicators
+const maxScriptScan = 64 * 1024
+
+// Info is the information of an executable or a script
+type Info struct {
+	Type       string
+	Arch       string
+	Signed     bool
+	ScriptType string
+	Extension  string
+}
+
+// String returns a short description of the executable (ex: "pe x64 unsigned", "script powershell")
+func (i *Info) String() string {
+	switch i.Type {
+	case TypeScript:
+		return i.Type + " " + i.ScriptType
+	case TypePE:
+		if i.Signed {
+			return i.Type + " " + i.Arch + " signed"
+		}
+		return i.Type + " " + i.Arch + " unsigned"
+	}
+	return strings.TrimSpace(i.Type + " " + i.Arch)
+}
+
+var peMachines = map[uint16]string{0x14c: "x86", 0x8664: "x64", 0x1c0: "arm", 0x1c4: "arm", 0xaa64: "arm64", 0x200: "ia64"}
+
+var elfMachines = map[uint16]string{3: "x86", 62: "x64", 40: "arm", 183: "arm64", 8: "mips", 20: "ppc", 21: "ppc64", 243: "riscv"}
+
+var machOCPUs = map[uint32]string{7: "x86", 0x01000007: "x64", 12: "arm", 0x0100000c: "arm64", 18: "ppc", 0x01000012: "ppc64"}
+
+var lnkHeader = []byte{0x4C, 0, 0, 0, 0x01, 0x14, 0x02, 0, 0, 0, 0, 0, 0xC0, 0, 0, 0, 0, 0, 0, 0x46}
+
+// shebangInterpreters maps the interpreters of the shebang line to the script types and their extensions
+var shebangInterpreters = map[string][2]string{
+	"sh": {ScriptShell, "sh"}, "bash": {ScriptShell, "sh"}, "dash": {ScriptShell, "sh"}, "zsh": {ScriptShell, "sh"},
+	"ksh": {ScriptShell, "sh"}, "csh": {ScriptShell, "sh"}, "tcsh": {ScriptShell, "sh"}, "ash": {ScriptShell, "sh"},
+	"python": {ScriptPython, "py"}, "perl": {ScriptPerl, "pl"}, "ruby": {ScriptRuby, "rb"}, "node": {ScriptNode, "js"},
+	"pwsh": {ScriptPowerShell, "ps1"}, "powershell": {ScriptPowerShell, "ps1"},
+}
+
+// the indicators of the scripts, they're matched in lower case
+var (
+	powerShellIndicators = []string{"invoke-expression", "iex(", "iex (", "new-object ", "-encodedcommand",
+		"start-process", "downloadstring(", "invoke-webrequest", "set-executionpolicy", "write-host", "$env:",
+		"[system.", "[convert]::", "param(", "get-childitem", "-erroraction"}
+	vbScriptIndicators = []string{"createobject(", "wscript.", "on error resume next", "dim ", "end sub", "end function",
+		"msgbox ", "set "}
+	wshIndicators = []string{"wscript.", "shell.application", "scripting.filesystemobject", "adodb.stream"}
+)
+
+// Detect parses the headers of PE, ELF and Mach-O executables and LNK files, and looks for the shebang line
+// and the indicators of PowerShell, HTA, JScript and VBScript in the text files, it returns nil if the data
+// isn't an executable nor a script
+func Detect(data []byte) *Info {
+	switch {
+	case bytes.HasPrefix(data, []byte("MZ")):
+		return detectPE(data)
+	case bytes.HasPrefix(data, []byte("\x7FELF")):
+		return detectELF(data)
+	case bytes.HasPrefix(data, lnkHeader):
+		return &Info{Type: TypeLNK, Extension: "lnk"}
+	}
+	if info := detectMachO(data); info != nil {
+		return info
+	}
+	return detectScript(data)
+}
+
+// detectPE parses the COFF header for the architecture and the optional header for the security
+// directory which has the Authenticode signature, the DLLs have the dll extension
+func detectPE(data []byte) *Info {
+	if len(data) < 0x40 {
+		return nil
+	}
+	offset := int(binary.LittleEndian.Uint32(data[0x3C:]))
+	if offset < 0 || offset+24 > len(data) || !bytes.Equal(data[offset:offset+4], []byte("PE\x00\x00")) {
+		return nil
+	}
+	coff := data[offset+4:]
+	info := &Info{Type: TypePE, Arch: peMachines[binary.LittleEndian.Uint16(coff)], Extension: "exe"}
+	if info.Arch == "" {
+		info.Arch = "unknown"
+	}
+	if binary.LittleEndian.Uint16(coff[18:])&0x2000 != 0 {
+		info.Extension = "dll"
+	}
+	optionalSize := int(binary.LittleEndian.Uint16(coff[16:]))
+	optional := coff[20:]
+	if optionalSize < 2 || optionalSize > len(optional) {
+		return info
+	}
+	optional = optional[:optionalSize]
+	// the count of the data directories and the directories offsets depend on PE32 or PE32+
+	countOffset, dirsOffset := 92, 96
+	if binary.LittleEndian.Uint16(optional) == 0x20b {
+		countOffset, dirsOffset = 108, 112
+	}
+	const securityDir = 4
+	if countOffset+4 > len(optional) || binary.LittleEndian.Uint32(optional[countOffset:]) <= securityDir {
+		return info
+	}
+	dir := dirsOffset + securityDir*8
+	if dir+8 <= len(optional) {
+		info.Signed = binary.LittleEndian.Uint32(optional[dir:]) != 0 && binary.LittleEndian.Uint32(optional[dir+4:]) != 0
+	}
+	return info
+}
+
+// detectELF reads the machine of the ELF header in the byte order of the file
+func detectELF(data []byte) *Info {
+	if len(data) < 20 {
+		return nil
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if data[5] == 2 {
+		order = binary.BigEndian
+	}
+	info := &Info{Type: TypeELF, Arch: elfMachines[order.Uint16(data[18:])], Extension: "elf"}
+	if info.Arch == "" {
+		info.Arch = "unknown"
+	}
+	return info
+}
+
+// detectMachO reads the CPU type of the Mach-O header, the universal binaries have more than one architecture,
+// they have the same magic of the Java classes which are told apart by the count of the architectures
+func detectMachO(data []byte) *Info {
+	if len(data) < 8 {
+		return nil
+	}
+	switch magic := binary.BigEndian.Uint32(data); magic {
+	case 0xFEEDFACE, 0xFEEDFACF:
+		return machOInfo(binary.BigEndian.Uint32(data[4:]))
+	case 0xCEFAEDFE, 0xCFFAEDFE:
+		return machOInfo(binary.LittleEndian.Uint32(data[4:]))
+	case 0xCAFEBABE, 0xCAFEBABF:
+		if count := binary.BigEndian.Uint32(data[4:]); count > 0 && count < 20 {
+			return &Info{Type: TypeMachO, Arch: "universal", Extension: "macho"}
+		}
+	}
+	return nil
+}
+
+func machOInfo(cpu uint32) *Info {
+	info := &Info{Type: TypeMachO, Arch: machOCPUs[cpu], Extension: "macho"}
+	if info.Arch == "" {
+		info.Arch = "unknown"
+	}
+	return info
+}
+
+// detectScript looks for the shebang line or the indicators of the scripts in the start of a text file
+func detectScript(data []byte) *Info {
+	if len(data) > maxScriptScan {
+		data = data[:maxScriptScan]
+	}
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	if len(data) == 0 || bytes.IndexByte(data, 0) >= 0 {
+		return nil
+	}
+	if bytes.HasPrefix(data, []byte("#!")) {
+		return shebangScript(data)
+	}
+	text := strings.ToLower(string(data))
+	if strings.Contains(text, "<hta:application") {
+		return &Info{Type: TypeScript, ScriptType: ScriptHTA, Extension: "hta"}
+	}
+	if strings.Contains(text, "<html") || strings.Contains(text, "<script") {
+		return nil
+	}
+	if count(text, powerShellIndicators) >= 2 {
+		return &Info{Type: TypeScript, ScriptType: ScriptPowerShell, Extension: "ps1"}
+	}
+	// the browsers scripts create ActiveX objects too (ex: XMLHTTP), so the Windows Script Host objects are required
+	if strings.Contains(text, "new activexobject(") && count(text, wshIndicators) >= 1 {
+		return &Info{Type: TypeScript, ScriptType: ScriptJScript, Extension: "js"}
+	}
+	if strings.Contains(text, "createobject(") && count(text, vbScriptIndicators) >= 3 {
+		return &Info{Type: TypeScript, ScriptType: ScriptVBScript, Extension: "vbs"}
+	}
+	return nil
+}
+
+// shebangScript returns the script type of the interpreter of the shebang line,
+// "/usr/bin/env python3" and "/bin/bash -e" are supported
+func shebangScript(data []byte) *Info {
+	line, _, _ := bytes.Cut(data[2:], []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return &Info{Type: TypeScript, ScriptType: ScriptShell, Extension: "sh"}
+	}
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = path.Base(field)
+				break
+			}
+		}
+	}
+	name := strings.TrimRight(interpreter, "0123456789.")
+	if script, ok := shebangInterpreters[name]; ok {
+		return &Info{Type: TypeScript, ScriptType: script[0], Extension: script[1]}
+	}
+	return &Info{Type: TypeScript, ScriptType: name, Extension: "sh"}
+}
+
+func count(text string, indicators []string) int {
+	found := 0
+	for _, indicator := range indicators {
+		if strings.Contains(text, indicator) {
+			found++
+		}
+	}
+	return found
+}
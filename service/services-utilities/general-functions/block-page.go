@@ -0,0 +1,307 @@
+package general_functions
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/readValues"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	textTemplate "text/template"
+)
+
+// the formats which a block page can be rendered in
+const (
+	BlockPageFormatHTML = "html"
+	BlockPageFormatJSON = "json"
+	BlockPageFormatText = "text"
+)
+
+var blockPageFormats = []string{BlockPageFormatHTML, BlockPageFormatJSON, BlockPageFormatText}
+
+var blockPageReasons = []string{utils.ErrPageReasonFileRejected, utils.ErrPageReasonMaxFileExceeded,
+	utils.ErrPageReasonFileIsNotSafe, utils.ErrPageReasonRiskyContent, utils.ErrPageReasonURLBlocked,
+	utils.ErrPageReasonActiveContent, utils.ErrPageReasonFileIsEncrypted, utils.ErrPageReasonSensitiveContent}
+
+var blockPageContentTypes = map[string]string{
+	BlockPageFormatHTML: utils.HTMLContentType,
+	BlockPageFormatJSON: utils.JSONContentType,
+	BlockPageFormatText: utils.TextContentType,
+}
+
+// blockPageMediaTypes maps the media types of the Accept header to the block page formats
+var blockPageMediaTypes = map[string]string{
+	"text/html":             BlockPageFormatHTML,
+	"application/xhtml+xml": BlockPageFormatHTML,
+	"application/json":      BlockPageFormatJSON,
+	"text/json":             BlockPageFormatJSON,
+	"text/plain":            BlockPageFormatText,
+}
+
+var blockPagesMu sync.RWMutex
+
+// blockPages stores the block page templates paths of every service,
+// the key of the inner map is the format (ex: "json") or the format and the reason (ex: "json_fileIsNotSafe")
+var blockPages = make(map[string]map[string]string)
+
+// InitBlockPages loads the block page templates of a service from the optional
+// [<service>.block_pages] section in config.toml file, it loads them only one time
+func InitBlockPages(serviceName string) {
+	blockPagesMu.Lock()
+	defer blockPagesMu.Unlock()
+	if _, loaded := blockPages[serviceName]; loaded {
+		return
+	}
+	logging.Logger.Debug("loading " + serviceName + " service block pages templates")
+	templates := make(map[string]string)
+	if readValues.IsSecExists(serviceName + ".block_pages") {
+		for _, format := range blockPageFormats {
+			keys := []string{format}
+			for _, reason := range blockPageReasons {
+				keys = append(keys, format+"_"+reason)
+			}
+			for _, key := range keys {
+				varName := serviceName + ".block_pages." + key
+				if readValues.IsSecExists(varName) {
+					if path := readValues.ReadValuesString(varName); path != "" {
+						templates[key] = path
+					}
+				}
+			}
+		}
+	}
+	blockPages[serviceName] = templates
+}
+
+// blockPageTemplate returns the template path of the service for a specific format and reason,
+// it returns an empty string if the service doesn't have a template for them
+func blockPageTemplate(serviceName, format, reason string) string {
+	blockPagesMu.RLock()
+	defer blockPagesMu.RUnlock()
+	templates := blockPages[serviceName]
+	if path, ok := templates[format+"_"+reason]; ok {
+		return path
+	}
+	return templates[format]
+}
+
+// NegotiateBlockPageFormat chooses the block page format (html, json or text) depending on
+// the Accept header of the HTTP request, html is returned if the client accepts all of them equally
+func NegotiateBlockPageFormat(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return BlockPageFormatHTML
+	}
+	// the quality of every format and how specific the media range which decided it is
+	// 0: */*, 1: type/*, 2: type/subtype
+	quality := make(map[string]float64)
+	specificity := make(map[string]int)
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qValue, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qValue, 64); err != nil {
+				continue
+			}
+		}
+		for _, format := range blockPageFormats {
+			level := -1
+			switch {
+			case mediaType == "*/*":
+				level = 0
+			case strings.HasSuffix(mediaType, "/*"):
+				for mt, f := range blockPageMediaTypes {
+					if f == format && strings.HasPrefix(mt, strings.TrimSuffix(mediaType, "*")) {
+						level = 1
+					}
+				}
+			case blockPageMediaTypes[mediaType] == format:
+				level = 2
+			}
+			if level < 0 {
+				continue
+			}
+			if s, ok := specificity[format]; !ok || level > s || (level == s && q > quality[format]) {
+				specificity[format] = level
+				quality[format] = q
+			}
+		}
+	}
+	chosen, chosenQuality := BlockPageFormatHTML, 0.0
+	for _, format := range blockPageFormats {
+		if quality[format] > chosenQuality {
+			chosen, chosenQuality = format, quality[format]
+		}
+	}
+	return chosen
+}
+
+// fallbackBlockPage is the html block page used when neither the template of the service
+// nor the default block page can be rendered
+const fallbackBlockPage = `<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head><meta charset="utf-8"><title>{{t "title"}}</title></head>
+<body>
+<h1>{{reasonText .Reason}}</h1>
+<p>{{reasonMessage .Reason}}</p>
+<p><strong>{{t "requestedURL"}}: </strong>{{.RequestedURL}}</p>
+<p><strong>{{t "serviceName"}}: </strong>{{.ServiceName}}</p>
+<p><strong>{{t "fileHash"}}: </strong>{{.IdentifierId}}</p>
+{{if .ThreatName}}<p><strong>{{t "threatName"}}: </strong>{{.ThreatName}}</p>{{end}}
+</body>
+</html>
+`
+
+// defaultTextBlockPage is the template used for plain text block pages
+// when the service doesn't configure its own one
+const defaultTextBlockPage = `{{t "blocked"}}
+{{reasonText .Reason}}: {{reasonMessage .Reason}}
+{{t "serviceName"}}: {{.ServiceName}}
+{{t "requestedURL"}}: {{.RequestedURL}}
+{{t "fileHash"}}: {{.IdentifierId}}
+{{t "fileSize"}}: {{.Size}}
+{{if .ThreatName}}{{t "threatName"}}: {{.ThreatName}}
+{{end}}X-ICAP-Metadata: {{.XICAPMetadata}}
+`
+
+// executeHtmlTemplate renders an html template file with the functions of the locale of the block page
+func executeHtmlTemplate(path string, errPage *ErrorPage) (*bytes.Buffer, error) {
+	tmpl, err := template.New(filepath.Base(path)).Funcs(blockPageFuncs(errPage.Locale)).ParseFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	page := &bytes.Buffer{}
+	if err = tmpl.Execute(page, errPage); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// executeTextTemplate renders a text template file with the functions of the locale of the block page,
+// the fields and the translations are escaped as JSON strings in the json templates
+// (ex: "url": "{{.RequestedURL}}" is valid JSON whatever the URL has)
+func executeTextTemplate(path, format string, errPage *ErrorPage) (*bytes.Buffer, error) {
+	funcs := blockPageFuncs(errPage.Locale)
+	data := errPage
+	if format == BlockPageFormatJSON {
+		for name, fn := range funcs {
+			fn := fn.(func(string) string)
+			funcs[name] = func(s string) string { return jsonEscape(fn(s)) }
+		}
+		escaped := *errPage
+		for _, field := range []*string{&escaped.Reason, &escaped.ServiceName, &escaped.RequestedURL,
+			&escaped.IdentifierId, &escaped.ExceptionPage, &escaped.Size, &escaped.ThreatName,
+			&escaped.XICAPMetadata, &escaped.Locale, &escaped.Message, &escaped.ProceedURL} {
+			*field = jsonEscape(*field)
+		}
+		data = &escaped
+	}
+	tmpl, err := textTemplate.New(filepath.Base(path)).Funcs(funcs).ParseFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	page := &bytes.Buffer{}
+	if err = tmpl.Execute(page, data); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// jsonEscape returns the string escaped as the content of a JSON string, without the quotes
+func jsonEscape(s string) string {
+	escaped, _ := json.Marshal(s)
+	return string(escaped[1 : len(escaped)-1])
+}
+
+// RenderBlockPage renders the block page of a specific format in the locale of errPage, the html format
+// falls back to htmlPath (the exception page of the service) if the service doesn't have an html template
+// for the reason of blocking, a template which can't be parsed or executed is replaced with the default
+// block page of the format, it returns the page and its content type
+func RenderBlockPage(errPage *ErrorPage, format, htmlPath string) (*bytes.Buffer, string) {
+	if errPage.Locale == "" {
+		errPage.Locale = NegotiateLocale("")
+	}
+	if errPage.Message == "" {
+		errPage.Message = ReasonMessage(errPage.Locale, errPage.Reason)
+	}
+	path := blockPageTemplate(errPage.ServiceName, format, errPage.Reason)
+	switch format {
+	case BlockPageFormatJSON, BlockPageFormatText:
+		if path != "" {
+			page, err := executeTextTemplate(localizedPath(path, errPage.Locale), format, errPage)
+			if err == nil {
+				return page, blockPageContentTypes[format]
+			}
+			logging.Logger.Error(utils.PrepareLogMsg(errPage.XICAPMetadata,
+				format+" block page template couldn't be rendered and replaced with the default one: "+err.Error()))
+		}
+		page := &bytes.Buffer{}
+		if format == BlockPageFormatJSON {
+			body, _ := json.Marshal(errPage)
+			page.Write(body)
+			return page, blockPageContentTypes[format]
+		}
+		tmpl := textTemplate.Must(textTemplate.New(format).Funcs(blockPageFuncs(errPage.Locale)).Parse(defaultTextBlockPage))
+		tmpl.Execute(page, errPage)
+		return page, blockPageContentTypes[format]
+	}
+	if path == "" {
+		path = htmlPath
+	}
+	if path == "" {
+		path = utils.BlockPagePath
+	}
+	page, err := executeHtmlTemplate(localizedPath(path, errPage.Locale), errPage)
+	if err == nil {
+		return page, utils.HTMLContentType
+	}
+	logging.Logger.Error(utils.PrepareLogMsg(errPage.XICAPMetadata,
+		"exception page couldn't be rendered and replaced with default page: "+err.Error()))
+	if path != utils.BlockPagePath {
+		page, err = executeHtmlTemplate(localizedPath(utils.BlockPagePath, errPage.Locale), errPage)
+		if err == nil {
+			return page, utils.HTMLContentType
+		}
+		logging.Logger.Error(utils.PrepareLogMsg(errPage.XICAPMetadata,
+			"default block page couldn't be rendered: "+err.Error()))
+	}
+	page = &bytes.Buffer{}
+	tmpl := template.Must(template.New("fallback").Funcs(blockPageFuncs(errPage.Locale)).Parse(fallbackBlockPage))
+	tmpl.Execute(page, errPage)
+	return page, utils.HTMLContentType
+}
+
+// GenBlockPage is a func used for generating a block page in the format which the HTTP client
+// accepts (html, json or plain text), it returns the page and its content type
+func (f *GeneralFunc) GenBlockPage(path, reason, serviceName, identifierId, reqUrl string, fileSize string,
+	xICAPMetadata string) (*bytes.Buffer, string) {
+	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata, "preparing a block page"))
+	accept, acceptLanguage := "", ""
+	if f.httpMsg.Request != nil {
+		accept = f.httpMsg.Request.Header.Get("Accept")
+		acceptLanguage = f.httpMsg.Request.Header.Get("Accept-Language")
+	}
+	format := NegotiateBlockPageFormat(accept)
+	locale := NegotiateLocale(acceptLanguage)
+	logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "block page format is "+format+
+		" and its locale is "+locale))
+	errPage := &ErrorPage{
+		Reason:        reason,
+		ServiceName:   serviceName,
+		RequestedURL:  reqUrl,
+		IdentifierId:  identifierId,
+		Size:          fileSize,
+		ThreatName:    logging.Audit(f.xICAPMetadata).ThreatName,
+		XICAPMetadata: xICAPMetadata,
+		Locale:        locale,
+	}
+	f.notifyBlock(*errPage)
+	return RenderBlockPage(errPage, format, path)
+}
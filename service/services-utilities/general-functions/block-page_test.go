@@ -0,0 +1,47 @@
+package general_functions
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNegotiateBlockPageFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", BlockPageFormatHTML},
+		{"*/*", BlockPageFormatHTML},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", BlockPageFormatHTML},
+		{"application/json", BlockPageFormatJSON},
+		{"application/json, text/plain;q=0.5", BlockPageFormatJSON},
+		{"text/plain", BlockPageFormatText},
+		{"text/*;q=0.5, application/json;q=0.4", BlockPageFormatHTML},
+		{"text/html;q=0.1, application/*", BlockPageFormatJSON},
+		{"image/png", BlockPageFormatHTML},
+	}
+	for _, tt := range tests {
+		if got := NegotiateBlockPageFormat(tt.accept); got != tt.want {
+			t.Errorf("NegotiateBlockPageFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestJSONBlockPageTemplateEscaping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "block-page.json")
+	os.WriteFile(path, []byte(`{"reason": "{{reasonText .Reason}}", "url": "{{.RequestedURL}}", "threat": "{{.ThreatName}}"}`), 0644)
+	page, err := executeTextTemplate(path, BlockPageFormatJSON, &ErrorPage{Reason: "fileIsNotSafe",
+		RequestedURL: `http://example.com/a"b\c`, ThreatName: "Eicar \"test\"\n", Locale: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]string
+	if err := json.Unmarshal(page.Bytes(), &doc); err != nil {
+		t.Fatalf("expected valid JSON, got %s: %v", page.String(), err)
+	}
+	if doc["url"] != `http://example.com/a"b\c` || doc["threat"] != "Eicar \"test\"\n" {
+		t.Errorf("expected the original values, got %v", doc)
+	}
+}
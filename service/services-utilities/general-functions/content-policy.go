@@ -0,0 +1,197 @@
+package general_functions
+
+import (
+	"bytes"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/readValues"
+	"icapeg/service/services-utilities/ContentTypes"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ContentPolicyRedact is the action of the content policy which replaces the matched content, the other
+// actions are process (the match is only logged) and reject
+const ContentPolicyRedact = "redact"
+
+const defaultRedactReplacement = "[REDACTED]"
+
+// ContentPolicy is the policy of the content of the request bodies of a service, the fields of the
+// application/x-www-form-urlencoded forms and the text bodies are matched with its keywords and patterns
+type ContentPolicy struct {
+	Keywords    []string
+	Patterns    []*regexp.Regexp
+	Fields      []string
+	Action      string
+	Replacement string
+	// keywordPatterns are the case insensitive patterns of the keywords which are used to redact them
+	keywordPatterns []*regexp.Regexp
+}
+
+var contentPoliciesMu sync.RWMutex
+
+// contentPolicies stores the content policy of every service which has one
+var contentPolicies = make(map[string]*ContentPolicy)
+
+// InitContentPolicy loads the content policy of a service from the optional [<service>.content_policy]
+// section in config.toml file, it loads it only one time
+func InitContentPolicy(serviceName string) {
+	contentPoliciesMu.Lock()
+	defer contentPoliciesMu.Unlock()
+	if _, loaded := contentPolicies[serviceName]; loaded {
+		return
+	}
+	section := serviceName + ".content_policy."
+	if !readValues.IsSecExists(serviceName + ".content_policy") {
+		contentPolicies[serviceName] = nil
+		return
+	}
+	logging.Logger.Debug("loading " + serviceName + " service content policy")
+	p := &ContentPolicy{Action: ContentPolicyRedact, Replacement: defaultRedactReplacement}
+	if readValues.IsSecExists(section + "keywords") {
+		for _, keyword := range readValues.ReadValuesSlice(section + "keywords") {
+			if keyword != "" {
+				p.Keywords = append(p.Keywords, strings.ToLower(keyword))
+			}
+		}
+		p.compileKeywords()
+	}
+	if readValues.IsSecExists(section + "patterns") {
+		for _, pattern := range readValues.ReadValuesSlice(section + "patterns") {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				logging.Logger.Fatal(section + "patterns has an invalid pattern: " + err.Error())
+			}
+			p.Patterns = append(p.Patterns, re)
+		}
+	}
+	if readValues.IsSecExists(section + "fields") {
+		p.Fields = readValues.ReadValuesSlice(section + "fields")
+	}
+	if readValues.IsSecExists(section + "action") {
+		p.Action = readValues.ReadValuesString(section + "action")
+	}
+	if p.Action != utils.ProcessExts && p.Action != utils.RejectExts && p.Action != ContentPolicyRedact {
+		logging.Logger.Fatal(section + "action should be " + utils.ProcessExts + ", " + utils.RejectExts +
+			" or " + ContentPolicyRedact)
+	}
+	if readValues.IsSecExists(section + "replacement") {
+		p.Replacement = readValues.ReadValuesString(section + "replacement")
+	}
+	contentPolicies[serviceName] = p
+}
+
+// compileKeywords compiles the case insensitive patterns of the keywords once
+func (p *ContentPolicy) compileKeywords() {
+	p.keywordPatterns = nil
+	for _, keyword := range p.Keywords {
+		p.keywordPatterns = append(p.keywordPatterns, regexp.MustCompile("(?i)"+regexp.QuoteMeta(keyword)))
+	}
+}
+
+// Match returns the first keyword or pattern which the text has, the keywords are matched case insensitively
+func (p *ContentPolicy) Match(text string) (string, bool) {
+	lower := strings.ToLower(text)
+	for _, keyword := range p.Keywords {
+		if strings.Contains(lower, keyword) {
+			return keyword, true
+		}
+	}
+	for _, re := range p.Patterns {
+		if re.MatchString(text) {
+			return re.String(), true
+		}
+	}
+	return "", false
+}
+
+// Redact replaces the keywords and the matches of the patterns in the text with the replacement
+func (p *ContentPolicy) Redact(text string) string {
+	for _, re := range p.keywordPatterns {
+		text = re.ReplaceAllLiteralString(text, p.Replacement)
+	}
+	for _, re := range p.Patterns {
+		text = re.ReplaceAllLiteralString(text, p.Replacement)
+	}
+	return text
+}
+
+// matchesField checks if the form field is inspected, all the fields are inspected if the fields aren't set
+func (p *ContentPolicy) matchesField(name string) bool {
+	if len(p.Fields) == 0 {
+		return true
+	}
+	for _, pattern := range p.Fields {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTheContentPolicy applies the content policy of the service on the request body in REQMOD, every field
+// of the forms is matched alone and redacted as a whole, the text bodies are matched as they are and only the
+// matched content is redacted, the file is changed in its place when it's redacted
+func (f *GeneralFunc) CheckTheContentPolicy(serviceName, methodName, identifier, fileSize string,
+	reqContentType ContentTypes.ContentType, file *bytes.Buffer) (bool, int, interface{}) {
+	contentPoliciesMu.RLock()
+	p := contentPolicies[serviceName]
+	contentPoliciesMu.RUnlock()
+	if p == nil || methodName != utils.ICAPModeReq {
+		return true, 0, nil
+	}
+	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata, "checking the content policy"))
+
+	var matches []string
+	switch content := reqContentType.(type) {
+	case *ContentTypes.URLEncodedForm:
+		for i, field := range content.Fields() {
+			if !p.matchesField(field.Name) {
+				continue
+			}
+			if match, ok := p.Match(field.Value); ok {
+				matches = append(matches, field.Name+": "+match)
+				if p.Action == ContentPolicyRedact {
+					content.SetValue(i, p.Replacement)
+				}
+			}
+		}
+	case ContentTypes.RegularFile:
+		mediaType, _, _ := mime.ParseMediaType(f.httpMsg.Request.Header.Get("Content-Type"))
+		if !strings.HasPrefix(mediaType, "text/") {
+			return true, 0, nil
+		}
+		if match, ok := p.Match(file.String()); ok {
+			matches = append(matches, match)
+			if p.Action == ContentPolicyRedact {
+				redacted := p.Redact(file.String())
+				file.Reset()
+				file.WriteString(redacted)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return true, 0, nil
+	}
+	logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "the content policy matched "+
+		strings.Join(matches, ", ")+", the action is "+p.Action))
+	switch p.Action {
+	case ContentPolicyRedact:
+		logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionRedact)
+		logging.Audit(f.xICAPMetadata).SetRedacted()
+	case utils.RejectExts:
+		logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionReject)
+		logging.Audit(f.xICAPMetadata).SetVerdict(logging.VerdictBlocked, "content: "+strings.Join(matches, ", "))
+		htmlPage, req, err := f.ReqModErrPage(utils.ErrPageReasonSensitiveContent, serviceName, identifier, fileSize)
+		if err != nil {
+			return false, utils.InternalServerErrStatusCodeStr, nil
+		}
+		req.Body = io.NopCloser(bytes.NewBuffer(htmlPage.Bytes()))
+		return false, utils.OkStatusCodeStr, req
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,75 @@
+package general_functions
+
+import (
+	"bytes"
+	utils "icapeg/consts"
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/service/services-utilities/ContentTypes"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCheckTheContentPolicy(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	p := &ContentPolicy{
+		Keywords:    []string{"confidential"},
+		Patterns:    []*regexp.Regexp{regexp.MustCompile(`\b4[0-9]{3}( ?[0-9]{4}){3}\b`)},
+		Fields:      []string{"card*", "note"},
+		Action:      ContentPolicyRedact,
+		Replacement: "[REDACTED]",
+	}
+	p.compileKeywords()
+	contentPoliciesMu.Lock()
+	contentPolicies["dlp"] = p
+	contentPoliciesMu.Unlock()
+	defer func() {
+		contentPoliciesMu.Lock()
+		delete(contentPolicies, "dlp")
+		contentPoliciesMu.Unlock()
+	}()
+
+	check := func(contentType, body string) string {
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/submit", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		f := NewGeneralFunc(&http_message.HttpMsg{Request: req}, "dlp")
+		file, reqContentType, err := f.CopyingFileToTheBuffer(utils.ICAPModeReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		isProcess, _, _ := f.CheckTheContentPolicy("dlp", utils.ICAPModeReq, "", "", reqContentType, file)
+		if !isProcess {
+			t.Fatalf("%s: expected the redacted body to be processed", body)
+		}
+		return string(f.PreparingFileAfterScanning(file.Bytes(), reqContentType, utils.ICAPModeReq))
+	}
+
+	logging.StartAudit("dlp", utils.ICAPModeReq, "echo")
+	defer logging.FinishAudit("dlp")
+	form := "user=j.doe&card_number=4111+1111+1111+1111&note=Confidential+plan&comment=4111111111111111"
+	expected := "user=j.doe&card_number=%5BREDACTED%5D&note=%5BREDACTED%5D&comment=4111111111111111"
+	if got := check("application/x-www-form-urlencoded", form); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if !logging.Audit("dlp").Redacted {
+		t.Error("expected the audit record to be redacted")
+	}
+	text := "the CONFIDENTIAL card is 4111 1111 1111 1111."
+	if got := check("text/plain; charset=utf-8", text); got != "the [REDACTED] card is [REDACTED]." {
+		t.Errorf("expected the matches to be redacted, got %q", got)
+	}
+	if got := check("application/octet-stream", text); got != text {
+		t.Errorf("expected the binary body to be untouched, got %q", got)
+	}
+
+	file := bytes.NewBufferString(text)
+	f := NewGeneralFunc(&http_message.HttpMsg{Request: &http.Request{Header: http.Header{}}}, "")
+	if isProcess, _, _ := f.CheckTheContentPolicy("dlp", utils.ICAPModeResp, "", "",
+		ContentTypes.NewRegularFile(file, false), file); !isProcess || file.String() != text {
+		t.Errorf("expected the responses not to be checked, got %q", file.String())
+	}
+}
@@ -0,0 +1,70 @@
+package general_functions
+
+import (
+	"bytes"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/service/services-utilities/ContentTypes"
+	"icapeg/service/services-utilities/encryption"
+	"io"
+	"net/http"
+)
+
+// the actions of the encrypted files policy of a service
+const (
+	EncryptedFilesAllow = "allow"
+	EncryptedFilesWarn  = "warn"
+	EncryptedFilesBlock = "block"
+)
+
+// ReadEncryptedFilesPolicy validates the encrypted_files value of a service, an empty value is allow
+func ReadEncryptedFilesPolicy(serviceName, policy string) string {
+	switch policy {
+	case "":
+		return EncryptedFilesAllow
+	case EncryptedFilesAllow, EncryptedFilesWarn, EncryptedFilesBlock:
+		return policy
+	}
+	logging.Logger.Fatal(serviceName + ".encrypted_files should be " + EncryptedFilesAllow + ", " +
+		EncryptedFilesWarn + " or " + EncryptedFilesBlock)
+	return ""
+}
+
+// CheckTheEncryptionPolicy is a func used for applying the encrypted files policy of the service on the encrypted
+// zip archives, PDFs and office documents which can't be scanned, it returns the warn page if the policy is warn
+// and the block page if it's block, the returned bool value indicates whether the service should continue processing or not
+func (f *GeneralFunc) CheckTheEncryptionPolicy(policy, client, serviceName, methodName, identifier, requestURI,
+	fileSize string, isGzip bool, reqContentType ContentTypes.ContentType, file *bytes.Buffer,
+	BlockPagePath string) (bool, int, interface{}) {
+	if policy == "" || policy == EncryptedFilesAllow {
+		return true, 0, nil
+	}
+	fileType, err := encryption.Detect(file.Bytes())
+	if err != nil {
+		logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "couldn't check the encryption of the file: "+err.Error()))
+	}
+	if fileType == "" {
+		return true, 0, nil
+	}
+	logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "the file is an encrypted "+fileType+
+		", encrypted files policy is "+policy))
+	if policy == EncryptedFilesWarn {
+		return f.CheckTheWarnPolicy(true, client, serviceName, methodName, identifier, fileSize, isGzip,
+			reqContentType, file)
+	}
+	logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionReject)
+	logging.Audit(f.xICAPMetadata).SetVerdict(logging.VerdictBlocked, "encrypted "+fileType)
+	if methodName == utils.ICAPModeResp {
+		errPage, contentType := f.GenBlockPage(BlockPagePath, utils.ErrPageReasonFileIsEncrypted, serviceName,
+			identifier, requestURI, fileSize, f.xICAPMetadata)
+		f.httpMsg.Response = f.ErrPageResp(http.StatusForbidden, errPage.Len(), contentType)
+		f.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+		return false, utils.OkStatusCodeStr, f.httpMsg.Response
+	}
+	htmlPage, req, err := f.ReqModErrPage(utils.ErrPageReasonFileIsEncrypted, serviceName, identifier, fileSize)
+	if err != nil {
+		return false, utils.InternalServerErrStatusCodeStr, nil
+	}
+	req.Body = io.NopCloser(htmlPage)
+	return false, utils.OkStatusCodeStr, req
+}
@@ -0,0 +1,141 @@
+package general_functions
+
+import (
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/readValues"
+	"icapeg/service/services-utilities/executable"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ExecutableRule is a rule of the extension policy which is applied on the executables and the scripts
+// depending on their type, architecture, signature and the host which they're downloaded from
+type ExecutableRule struct {
+	Name        string
+	Action      string
+	Types       []string
+	Archs       []string
+	Signed      *bool
+	Hosts       []string
+	ExceptHosts []string
+}
+
+var executableRulesMu sync.RWMutex
+
+// executableRules stores the executable rules of every service in their order
+var executableRules = make(map[string][]*ExecutableRule)
+
+// InitExecutableRules loads the executable rules of a service from the optional [<service>.executable_policy]
+// section in config.toml file, the names of the rules are listed in its rules key and every rule has its own
+// section (ex: [clamav.executable_policy.unsigned_pe]), it loads them only one time
+func InitExecutableRules(serviceName string) {
+	executableRulesMu.Lock()
+	defer executableRulesMu.Unlock()
+	if _, loaded := executableRules[serviceName]; loaded {
+		return
+	}
+	var rules []*ExecutableRule
+	if readValues.IsSecExists(serviceName + ".executable_policy.rules") {
+		logging.Logger.Debug("loading " + serviceName + " service executable rules")
+		for _, name := range readValues.ReadValuesSlice(serviceName + ".executable_policy.rules") {
+			rules = append(rules, readExecutableRule(serviceName+".executable_policy."+name+".", name))
+		}
+	}
+	executableRules[serviceName] = rules
+}
+
+func readExecutableRule(section, name string) *ExecutableRule {
+	r := &ExecutableRule{Name: name, Action: readValues.ReadValuesString(section + "action")}
+	if r.Action != utils.ProcessExts && r.Action != utils.RejectExts && r.Action != utils.BypassExts {
+		logging.Logger.Fatal(section + "action should be " + utils.ProcessExts + ", " + utils.RejectExts +
+			" or " + utils.BypassExts)
+	}
+	if readValues.IsSecExists(section + "types") {
+		r.Types = readValues.ReadValuesSlice(section + "types")
+	}
+	if readValues.IsSecExists(section + "archs") {
+		r.Archs = readValues.ReadValuesSlice(section + "archs")
+	}
+	if readValues.IsSecExists(section + "signed") {
+		signed := readValues.ReadValuesBool(section + "signed")
+		r.Signed = &signed
+	}
+	if readValues.IsSecExists(section + "hosts") {
+		r.Hosts = readValues.ReadValuesSlice(section + "hosts")
+	}
+	if readValues.IsSecExists(section + "except_hosts") {
+		r.ExceptHosts = readValues.ReadValuesSlice(section + "except_hosts")
+	}
+	return r
+}
+
+// Matches checks if the rule applies on the executable which is downloaded from the host,
+// the types are the file types (ex: "pe", "script") or the script types (ex: "powershell")
+// and a host matches its subdomains too
+func (r *ExecutableRule) Matches(info *executable.Info, host string) bool {
+	if len(r.Types) > 0 && !matchesAny(r.Types, info.Type) && (info.ScriptType == "" || !matchesAny(r.Types, info.ScriptType)) {
+		return false
+	}
+	if len(r.Archs) > 0 && !matchesAny(r.Archs, info.Arch) {
+		return false
+	}
+	if r.Signed != nil && (info.Type != executable.TypePE || info.Signed != *r.Signed) {
+		return false
+	}
+	if len(r.Hosts) > 0 && !matchesHost(r.Hosts, host) {
+		return false
+	}
+	return !matchesHost(r.ExceptHosts, host)
+}
+
+// executablePolicy returns the action and the name of the first executable rule of the service
+// which matches the body of the HTTP message, it returns empty strings if there isn't one
+func (f *GeneralFunc) executablePolicy(serviceName string, data []byte) (string, string) {
+	executableRulesMu.RLock()
+	rules := executableRules[serviceName]
+	executableRulesMu.RUnlock()
+	if len(rules) == 0 {
+		return "", ""
+	}
+	info := f.executable
+	if info == nil {
+		if info = executable.Detect(data); info == nil {
+			return "", ""
+		}
+	}
+	host := ""
+	if f.httpMsg != nil && f.httpMsg.Request != nil {
+		u := url.URL{Host: f.httpMsg.Request.Host}
+		if f.httpMsg.Request.URL != nil && f.httpMsg.Request.URL.Host != "" {
+			u.Host = f.httpMsg.Request.URL.Host
+		}
+		host = strings.ToLower(u.Hostname())
+	}
+	for _, rule := range rules {
+		if rule.Matches(info, host) {
+			return rule.Action, rule.Name
+		}
+	}
+	return "", ""
+}
+
+func matchesAny(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimPrefix(h, "*."))
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package general_functions
+
+import (
+	"icapeg/service/services-utilities/executable"
+	"testing"
+)
+
+func TestExecutableRuleMatches(t *testing.T) {
+	unsigned := false
+	rule := &ExecutableRule{Name: "unsigned_pe", Action: "reject", Types: []string{"pe"}, Signed: &unsigned,
+		ExceptHosts: []string{"*.example.com"}}
+	scripts := &ExecutableRule{Name: "scripts", Action: "reject", Types: []string{"powershell", "hta"}}
+
+	for name, test := range map[string]struct {
+		rule     *ExecutableRule
+		info     *executable.Info
+		host     string
+		expected bool
+	}{
+		"unsigned pe":                {rule, &executable.Info{Type: "pe", Arch: "x64"}, "evil.test", true},
+		"signed pe":                  {rule, &executable.Info{Type: "pe", Arch: "x64", Signed: true}, "evil.test", false},
+		"unsigned pe from allowlist": {rule, &executable.Info{Type: "pe", Arch: "x64"}, "dl.example.com", false},
+		"elf":                        {rule, &executable.Info{Type: "elf", Arch: "x64"}, "evil.test", false},
+		"powershell script":          {scripts, &executable.Info{Type: "script", ScriptType: "powershell"}, "", true},
+		"shell script":               {scripts, &executable.Info{Type: "script", ScriptType: "shell"}, "", false},
+	} {
+		if got := test.rule.Matches(test.info, test.host); got != test.expected {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package general_functions
+
+import (
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/readValues"
+	"icapeg/service/services-utilities/ContentTypes"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the checks of the filename policy
+const (
+	FileNameDoubleExtension = "double_extension"
+	FileNameBidiControl     = "bidi_control"
+	FileNameHomoglyph       = "homoglyph"
+	FileNameLongName        = "long_name"
+)
+
+// fileNameChecks are the checks of the filename policy in the order they're applied
+var fileNameChecks = []string{FileNameBidiControl, FileNameHomoglyph, FileNameDoubleExtension, FileNameLongName}
+
+// the default values of the filename policy
+var (
+	defaultDangerousExts = []string{"exe", "scr", "com", "pif", "bat", "cmd", "msi", "jar", "js", "jse", "vbs", "vbe",
+		"wsf", "hta", "ps1", "lnk", "cpl", "reg", "dll", "iso", "img"}
+	defaultDecoyExts = []string{"pdf", "doc", "docx", "xls", "xlsx", "ppt", "pptx", "rtf", "txt", "csv", "jpg", "jpeg",
+		"png", "gif", "bmp", "mp3", "mp4", "avi", "mov", "zip", "rar", "7z", "html", "htm"}
+)
+
+const defaultMaxFileNameLength = 255
+
+// contentDispositionFileName finds the filename and the filename* parameters of the Content-Disposition
+// headers, it's used for the malformed headers which mime.ParseMediaType can't parse (ex: unquoted names
+// which have backslashes) and for the filename* charsets which it doesn't decode
+var contentDispositionFileName = regexp.MustCompile(`(?i)filename(\*?)\s*=\s*"?([^";]+)"?`)
+
+// FileNamePolicy is the policy of the names of the files of a service, every check has an action which is
+// process (the name is only logged) or reject
+type FileNamePolicy struct {
+	Actions       map[string]string
+	MaxLength     int
+	DangerousExts []string
+	DecoyExts     []string
+}
+
+var fileNamePoliciesMu sync.RWMutex
+
+// fileNamePolicies stores the filename policy of every service which has one
+var fileNamePolicies = make(map[string]*FileNamePolicy)
+
+// InitFileNamePolicy loads the filename policy of a service from the optional [<service>.filename_policy]
+// section in config.toml file, it loads it only one time
+func InitFileNamePolicy(serviceName string) {
+	fileNamePoliciesMu.Lock()
+	defer fileNamePoliciesMu.Unlock()
+	if _, loaded := fileNamePolicies[serviceName]; loaded {
+		return
+	}
+	section := serviceName + ".filename_policy."
+	if !readValues.IsSecExists(serviceName + ".filename_policy") {
+		fileNamePolicies[serviceName] = nil
+		return
+	}
+	logging.Logger.Debug("loading " + serviceName + " service filename policy")
+	p := &FileNamePolicy{
+		Actions:       make(map[string]string),
+		MaxLength:     defaultMaxFileNameLength,
+		DangerousExts: defaultDangerousExts,
+		DecoyExts:     defaultDecoyExts,
+	}
+	for _, check := range fileNameChecks {
+		p.Actions[check] = utils.ProcessExts
+		if readValues.IsSecExists(section + check) {
+			p.Actions[check] = readValues.ReadValuesString(section + check)
+		}
+		if p.Actions[check] != utils.ProcessExts && p.Actions[check] != utils.RejectExts {
+			logging.Logger.Fatal(section + check + " should be " + utils.ProcessExts + " or " + utils.RejectExts)
+		}
+	}
+	if readValues.IsSecExists(section + "max_length") {
+		p.MaxLength = readValues.ReadValuesInt(section + "max_length")
+	}
+	if readValues.IsSecExists(section + "dangerous_extensions") {
+		p.DangerousExts = readValues.ReadValuesSlice(section + "dangerous_extensions")
+	}
+	if readValues.IsSecExists(section + "decoy_extensions") {
+		p.DecoyExts = readValues.ReadValuesSlice(section + "decoy_extensions")
+	}
+	fileNamePolicies[serviceName] = p
+}
+
+// Check returns the checks of the policy which the file name fails in their order
+func (p *FileNamePolicy) Check(name string) []string {
+	var failed []string
+	for _, check := range fileNameChecks {
+		var fails bool
+		switch check {
+		case FileNameBidiControl:
+			fails = strings.IndexFunc(name, isBidiControl) >= 0
+		case FileNameHomoglyph:
+			fails = isHomoglyphName(name)
+		case FileNameDoubleExtension:
+			fails = p.hasDoubleExtension(name)
+		case FileNameLongName:
+			fails = p.MaxLength > 0 && utf8.RuneCountInString(name) > p.MaxLength
+		}
+		if fails {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// hasDoubleExtension checks if a dangerous extension follows a decoy extension (ex: invoice.pdf.exe),
+// the spaces and the dots which are used to hide the last extension are ignored, the trailing ones too
+// because Windows removes them (ex: "invoice.pdf.exe." is saved as invoice.pdf.exe)
+func (p *FileNamePolicy) hasDoubleExtension(name string) bool {
+	parts := strings.Split(strings.TrimRight(strings.ToLower(name), ". "), ".")
+	if len(parts) < 3 {
+		return false
+	}
+	last := strings.TrimSpace(parts[len(parts)-1])
+	if !matchesAny(p.DangerousExts, last) {
+		return false
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		if matchesAny(p.DecoyExts, strings.TrimSpace(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBidiControl checks if the rune changes the direction of the text, ex: the right-to-left override (U+202E)
+// before "fdp.exe" shows "invoice<U+202E>fdp.exe" as "invoiceexe.pdf"
+func isBidiControl(r rune) bool {
+	return (r >= '\u202a' && r <= '\u202e') || (r >= '\u2066' && r <= '\u2069') ||
+		r == '\u200e' || r == '\u200f' || r == '\u061c'
+}
+
+// isHomoglyphName checks if a word of the name mixes the Latin letters with the Cyrillic or the Greek ones which
+// look the same (ex: "paypal.exe" with a Cyrillic "a"), or if its extension has letters which aren't ASCII
+func isHomoglyphName(name string) bool {
+	latin, lookalike := false, false
+	for _, r := range name {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin = true
+		case unicode.Is(unicode.Cyrillic, r), unicode.Is(unicode.Greek, r):
+			lookalike = true
+		case !unicode.IsLetter(r):
+			// the scripts are checked in every word, so the names which have words of different languages are allowed
+			latin, lookalike = false, false
+		}
+		if latin && lookalike {
+			return true
+		}
+	}
+	if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+		for _, r := range name[dot+1:] {
+			if r > unicode.MaxASCII && unicode.IsLetter(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fileNamePolicy returns the action of the filename policy of the service and the checks which the file
+// name failed, the action is reject if one of the failed checks is reject
+func (f *GeneralFunc) fileNamePolicy(serviceName string) (string, []string) {
+	fileNamePoliciesMu.RLock()
+	p := fileNamePolicies[serviceName]
+	fileNamePoliciesMu.RUnlock()
+	if p == nil {
+		return "", nil
+	}
+	failed := p.Check(f.GetFileName())
+	action := ""
+	for _, check := range failed {
+		if p.Actions[check] == utils.RejectExts {
+			action = utils.RejectExts
+		}
+	}
+	return action, failed
+}
+
+// fileNameFromHeaders returns the filename of the Content-Disposition header or of the file part of
+// the multipart form, the filename* parameter (RFC 5987) is preferred over the filename one
+func (f *GeneralFunc) fileNameFromHeaders() string {
+	var contentDisposition string
+	if f.httpMsg == nil {
+		return ""
+	}
+	if f.httpMsg.Response != nil {
+		contentDisposition = f.httpMsg.Response.Header.Get("Content-Disposition")
+	} else if f.httpMsg.Request != nil {
+		contentDisposition = f.httpMsg.Request.Header.Get("Content-Disposition")
+	}
+	if contentDisposition != "" {
+		matches := contentDispositionFileName.FindAllStringSubmatch(contentDisposition, -1)
+		for _, match := range matches {
+			if match[1] == "" {
+				continue
+			}
+			if name, ok := decodeExtendedValue(strings.TrimSpace(match[2])); ok && name != "" {
+				return baseName(name)
+			}
+		}
+		_, params, err := mime.ParseMediaType(contentDisposition)
+		if err == nil && params["filename"] != "" {
+			return baseName(params["filename"])
+		}
+		for _, match := range matches {
+			if match[1] == "" {
+				return baseName(strings.TrimSpace(match[2]))
+			}
+		}
+	}
+	if form, ok := f.reqContentType.(ContentTypes.MultipartForm); ok {
+		return baseName(form.FileName())
+	}
+	return ""
+}
+
+// decodeExtendedValue decodes the value of an RFC 5987 parameter (ex: ISO-8859-1'en'%A3%20rates),
+// the UTF-8, US-ASCII and ISO-8859-1 charsets are supported
+func decodeExtendedValue(value string) (string, bool) {
+	parts := strings.SplitN(value, "'", 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+	decoded, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(parts[0]) {
+	case "utf-8":
+		return decoded, utf8.ValidString(decoded)
+	case "us-ascii":
+		for i := 0; i < len(decoded); i++ {
+			if decoded[i] > unicode.MaxASCII {
+				return "", false
+			}
+		}
+		return decoded, true
+	case "iso-8859-1":
+		// the bytes of ISO-8859-1 are the first 256 code points of unicode
+		runes := make([]rune, len(decoded))
+		for i := 0; i < len(decoded); i++ {
+			runes[i] = rune(decoded[i])
+		}
+		return string(runes), true
+	}
+	return "", false
+}
+
+// baseName returns the last element of a path which is separated by slashes or backslashes
+func baseName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,76 @@
+package general_functions
+
+import (
+	"bytes"
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/service/services-utilities/ContentTypes"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFileNamePolicyCheck(t *testing.T) {
+	p := &FileNamePolicy{MaxLength: 20, DangerousExts: defaultDangerousExts, DecoyExts: defaultDecoyExts}
+
+	for name, expected := range map[string][]string{
+		"invoice.pdf":          nil,
+		"setup.v2.exe":         nil,
+		"invoice.pdf.exe":      {FileNameDoubleExtension},
+		"photo.JPG  .scr":      {FileNameDoubleExtension},
+		"invoice.pdf.exe.":     {FileNameDoubleExtension},
+		"invoice.pdf.exe . ":   {FileNameDoubleExtension},
+		"invoice.exe.":         nil,
+		"invoice\u202efdp.exe": {FileNameBidiControl},
+		"p\u0430ypal.exe":      {FileNameHomoglyph},
+		"report.\u0435xe":      {FileNameHomoglyph},
+		"\u043e\u0442\u0447\u0451\u0442 report.pdf": nil,
+		"a-very-long-file-name.txt":                 {FileNameLongName},
+	} {
+		if got := p.Check(name); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: expected %v, got %v", name, expected, got)
+		}
+	}
+}
+
+func TestGetFileName(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/download/file.bin", nil)
+	req.RequestURI = req.URL.String()
+	resp := &http.Response{Header: http.Header{}, Request: req}
+	f := NewGeneralFunc(&http_message.HttpMsg{Request: req, Response: resp}, "")
+
+	for header, expected := range map[string]string{
+		"":                                  "file.bin",
+		`attachment; filename="report.pdf"`: "report.pdf",
+		`attachment; filename="a.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.exe`:       "résumé.exe",
+		`attachment; filename=..\..\evil.exe`:                                       "evil.exe",
+		`attachment; filename="rates.txt"; filename*=ISO-8859-1'en'%A3%20rates.txt`: "£ rates.txt",
+		`attachment; filename*=iso-8859-1''caf%E9\menu.exe`:                         "menu.exe",
+		`attachment; filename*=UTF-8''bad%ZZ; filename=fallback.pdf`:                "fallback.pdf",
+	} {
+		resp.Header.Set("Content-Disposition", header)
+		if got := f.GetFileName(); got != expected {
+			t.Errorf("%q: expected %q, got %q", header, expected, got)
+		}
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("name", "value")
+	part, _ := w.CreateFormFile("upload", "invoice.pdf.exe")
+	part.Write([]byte("MZ"))
+	w.Close()
+	req, _ = http.NewRequest(http.MethodPost, "http://example.com/upload", strings.NewReader(body.String()))
+	req.RequestURI = req.URL.String()
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	f = NewGeneralFunc(&http_message.HttpMsg{Request: req}, "")
+	f.reqContentType = ContentTypes.GetContentType(req)
+	if got := f.GetFileName(); got != "invoice.pdf.exe" {
+		t.Errorf("expected the name of the multipart file, got %q", got)
+	}
+}
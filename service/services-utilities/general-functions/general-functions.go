@@ -4,13 +4,13 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
-	"html/template"
 	utils "icapeg/consts"
 	http_message "icapeg/http-message"
 	"icapeg/logging"
 	"icapeg/readValues"
 	services_utilities "icapeg/service/services-utilities"
 	"icapeg/service/services-utilities/ContentTypes"
+	"icapeg/service/services-utilities/executable"
 	"image"
 	"io"
 	"io/ioutil"
@@ -29,16 +29,22 @@ type (
 		ServiceName   string `json:"service_name"`
 		RequestedURL  string `json:"requested_url"`
 		IdentifierId  string `json:"identifier_id"`
-		ExceptionPage string `json:"exception_page"`
+		ExceptionPage string `json:"exception_page,omitempty"`
 		Size          string `json:"size"`
+		ThreatName    string `json:"threat_name,omitempty"`
 		XICAPMetadata string `json:"X-ICAP-Metadata"`
+		Locale        string `json:"locale,omitempty"`
+		Message       string `json:"message,omitempty"`
+		ProceedURL    string `json:"proceed_url,omitempty"`
 	}
 )
 
 // GeneralFunc is a struct used for applying general functionalities that any service can apply
 type GeneralFunc struct {
-	httpMsg       *http_message.HttpMsg
-	xICAPMetadata string
+	httpMsg        *http_message.HttpMsg
+	xICAPMetadata  string
+	executable     *executable.Info
+	reqContentType ContentTypes.ContentType
 }
 
 // NewGeneralFunc is used to create a new instance from the struct
@@ -76,60 +82,96 @@ func (f *GeneralFunc) CheckTheExtension(fileExtension string, extArrs []services
 	requestURI string, reqContentType ContentTypes.ContentType, file *bytes.Buffer, BlockPagePath string, fileSize string) (bool, int, interface{}) {
 	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata,
 		"checking the extension (reject or bypass or process))"))
+	policy, threatName := "", ""
+	if action, failed := f.fileNamePolicy(serviceName); len(failed) > 0 {
+		logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "the file name failed the checks: "+
+			strings.Join(failed, ", ")))
+		if action == utils.RejectExts {
+			policy, threatName = action, "filename: "+strings.Join(failed, ", ")
+		}
+	}
+	if policy == "" {
+		var rule string
+		policy, rule = f.executablePolicy(serviceName, file.Bytes())
+		if rule != "" {
+			logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "executable rule "+rule+" matched, policy is "+policy))
+		} else {
+			policy = f.extensionPolicy(fileExtension, extArrs, processExts, rejectExts, bypassExts)
+			logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "extension is "+policy))
+		}
+	}
+	switch policy {
+	case utils.RejectExts:
+		logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionReject)
+		logging.Audit(f.xICAPMetadata).SetVerdict(logging.VerdictBlocked, threatName)
+		if return400IfFileExtRejected {
+			f.notifyBlock(ErrorPage{Reason: utils.ErrPageReasonFileRejected, ServiceName: serviceName,
+				RequestedURL: requestURI, IdentifierId: identifier, Size: fileSize})
+			return false, utils.BadRequestStatusCodeStr, nil
+		}
+		if methodName == "RESPMOD" {
+			errPage, contentType := f.GenBlockPage(BlockPagePath, utils.ErrPageReasonFileRejected, serviceName, identifier, requestURI, fileSize, f.xICAPMetadata)
+			f.httpMsg.Response = f.ErrPageResp(http.StatusForbidden, errPage.Len(), contentType)
+			f.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+			return false, utils.OkStatusCodeStr, f.httpMsg.Response
+		} else {
+			htmlPage, req, err := f.ReqModErrPage(utils.ErrPageReasonFileRejected, serviceName, "-", fileSize)
+			if err != nil {
+				return false, utils.InternalServerErrStatusCodeStr, nil
+			}
+			reqContentType = &ContentTypes.RegularFile{
+				Buf:     file,
+				Encoded: false,
+			}
+			fileAfterPrep := f.PreparingFileAfterScanning(htmlPage.Bytes(), reqContentType, methodName)
+			req.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			return false, utils.OkStatusCodeStr, req
+		}
+	case utils.BypassExts:
+		logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionBypass)
+		logging.Audit(f.xICAPMetadata).SetVerdict(logging.VerdictAllowed, "")
+		fileAfterPrep, httpMsg := f.IfICAPStatusIs204(methodName, utils.NoModificationStatusCodeStr,
+			file, isGzip, reqContentType, f.httpMsg)
+		if fileAfterPrep == nil && httpMsg == nil {
+			return false, utils.InternalServerErrStatusCodeStr, nil
+		}
+
+		//returning the http message and the ICAP status code
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			return false, utils.NoModificationStatusCodeStr, msg
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			return false, utils.NoModificationStatusCodeStr, msg
+		}
+		return false, utils.NoModificationStatusCodeStr, nil
+	}
+	logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionProcess)
+	return true, 0, nil
+}
+
+// extensionPolicy returns the name of the first extensions array (process, reject or bypass) in the order
+// of extArrs which has the file extension, the file is processed if none of them has it
+func (f *GeneralFunc) extensionPolicy(fileExtension string, extArrs []services_utilities.Extension, processExts,
+	rejectExts, bypassExts []string) string {
 	for i := 0; i < 3; i++ {
-		if extArrs[i].Name == utils.ProcessExts {
+		switch extArrs[i].Name {
+		case utils.ProcessExts:
 			if f.ifFileExtIsX(fileExtension, processExts) {
-				logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "extension is process"))
-				break
+				return utils.ProcessExts
 			}
-		} else if extArrs[i].Name == utils.RejectExts {
+		case utils.RejectExts:
 			if f.ifFileExtIsX(fileExtension, rejectExts) {
-				logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "extension is reject"))
-				if return400IfFileExtRejected {
-					return false, utils.BadRequestStatusCodeStr, nil
-				}
-				if methodName == "RESPMOD" {
-					errPage := f.GenHtmlPage(BlockPagePath, utils.ErrPageReasonFileRejected, serviceName, identifier, requestURI, fileSize, f.xICAPMetadata)
-					f.httpMsg.Response = f.ErrPageResp(http.StatusForbidden, errPage.Len())
-					f.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
-					return false, utils.OkStatusCodeStr, f.httpMsg.Response
-				} else {
-					htmlPage, req, err := f.ReqModErrPage(utils.ErrPageReasonFileRejected, serviceName, "-", fileSize)
-					if err != nil {
-						return false, utils.InternalServerErrStatusCodeStr, nil
-					}
-					reqContentType = &ContentTypes.RegularFile{
-						Buf:     file,
-						Encoded: false,
-					}
-					fileAfterPrep := f.PreparingFileAfterScanning(htmlPage.Bytes(), reqContentType, methodName)
-					req.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
-					return false, utils.OkStatusCodeStr, req
-				}
+				return utils.RejectExts
 			}
-		} else if extArrs[i].Name == utils.BypassExts {
+		case utils.BypassExts:
 			if f.ifFileExtIsX(fileExtension, bypassExts) {
-				logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "extension is bypass"))
-				fileAfterPrep, httpMsg := f.IfICAPStatusIs204(methodName, utils.NoModificationStatusCodeStr,
-					file, isGzip, reqContentType, f.httpMsg)
-				if fileAfterPrep == nil && httpMsg == nil {
-					return false, utils.InternalServerErrStatusCodeStr, nil
-				}
-
-				//returning the http message and the ICAP status code
-				switch msg := httpMsg.(type) {
-				case *http.Request:
-					msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
-					return false, utils.NoModificationStatusCodeStr, msg
-				case *http.Response:
-					msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
-					return false, utils.NoModificationStatusCodeStr, msg
-				}
-				return false, utils.NoModificationStatusCodeStr, nil
+				return utils.BypassExts
 			}
 		}
 	}
-	return true, 0, nil
+	return utils.ProcessExts
 }
 
 // copyingFileToTheBufferResp is a utility function for CopyingFileToTheBuffer func
@@ -143,7 +185,11 @@ func (f *GeneralFunc) copyingFileToTheBufferResp() (*bytes.Buffer, error) {
 // copyingFileToTheBufferReq is a utility function for CopyingFileToTheBuffer func
 // it's used for extracting a file from the body of the http request
 func (f *GeneralFunc) copyingFileToTheBufferReq() (*bytes.Buffer, ContentTypes.ContentType, error) {
-	reqContentType := ContentTypes.GetContentType(f.httpMsg.Request)
+	reqContentType := f.httpMsg.ContentType
+	if reqContentType == nil {
+		reqContentType = ContentTypes.GetContentType(f.httpMsg.Request)
+	}
+	f.reqContentType = reqContentType
 	// getting the file from request and store it in buf as a type of bytes.Buffer
 	file := reqContentType.GetFileFromRequest()
 	return file, reqContentType, nil
@@ -187,10 +233,23 @@ func (f *GeneralFunc) IsBodyGzipCompressed(methodName string) bool {
 
 // DecompressGzipBody is a func used for decompress files which compressed in Gzip
 func (f *GeneralFunc) DecompressGzipBody(file *bytes.Buffer) (*bytes.Buffer, error) {
+	return f.DecompressGzipBodyLimited(file, 0)
+}
+
+// DecompressGzipBodyLimited is like DecompressGzipBody but it stops decompressing after limit+1 bytes,
+// so the callers can tell that the file is greater than the limit without inflating all of it, 0 means no limit
+func (f *GeneralFunc) DecompressGzipBodyLimited(file *bytes.Buffer, limit int) (*bytes.Buffer, error) {
 	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata, "decompressing the HTTP message body"))
 	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
 	defer reader.Close()
-	result, err := ioutil.ReadAll(reader)
+	var r io.Reader = reader
+	if limit > 0 {
+		r = io.LimitReader(reader, int64(limit)+1)
+	}
+	result, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
@@ -198,6 +257,23 @@ func (f *GeneralFunc) DecompressGzipBody(file *bytes.Buffer) (*bytes.Buffer, err
 }
 
 func (f *GeneralFunc) ReqModErrPage(reason, serviceName, IdentifierId string, fileSize string) (*bytes.Buffer, *http.Request, error) {
+	errPage := &ErrorPage{
+		Reason:       reason,
+		ServiceName:  serviceName,
+		IdentifierId: IdentifierId,
+		Size:         fileSize,
+		ThreatName:   logging.Audit(f.xICAPMetadata).ThreatName,
+	}
+	page, req, err := f.reqModPage(errPage)
+	if err == nil {
+		f.notifyBlock(*errPage)
+	}
+	return page, req, err
+}
+
+// reqModPage redirects the HTTP request to the web server of ICAPeg which renders the page,
+// it returns the fields of the page in JSON to be written in the body of the request
+func (f *GeneralFunc) reqModPage(htmlPageStructInstance *ErrorPage) (*bytes.Buffer, *http.Request, error) {
 	host := readValues.ReadValuesString("app.web_server_host")
 	endpoint := readValues.ReadValuesString("app.web_server_endpoint")
 	url := host + endpoint
@@ -205,20 +281,26 @@ func (f *GeneralFunc) ReqModErrPage(reason, serviceName, IdentifierId string, fi
 	f.httpMsg.Request.URL.Opaque = url
 	f.httpMsg.Request.URL.Path = ""
 	f.httpMsg.Request.URL.Host = host
+	//the Accept and Accept-Language headers are kept to let the web server render the block page
+	//in the format and the language the client accepts
+	accept := f.httpMsg.Request.Header.Get("Accept")
+	acceptLanguage := f.httpMsg.Request.Header.Get("Accept-Language")
 	for key, _ := range f.httpMsg.Request.Header {
 		f.httpMsg.Request.Header.Del(key)
 	}
+	if accept != "" {
+		f.httpMsg.Request.Header.Set("Accept", accept)
+	}
+	if acceptLanguage != "" {
+		f.httpMsg.Request.Header.Set("Accept-Language", acceptLanguage)
+	}
 	reqUri := f.httpMsg.Request.RequestURI
 	f.httpMsg.Request.Header.Set("Host", host)
 	f.httpMsg.Request.Method = http.MethodGet
 	f.httpMsg.Request.RequestURI = url
 	f.httpMsg.Request.Body = io.NopCloser(strings.NewReader(""))
-	htmlPageStructInstance := &ErrorPage{
-		Reason:       reason,
-		ServiceName:  serviceName,
-		RequestedURL: reqUri,
-		IdentifierId: IdentifierId,
-		Size:         fileSize,
+	if htmlPageStructInstance.RequestedURL == "" {
+		htmlPageStructInstance.RequestedURL = reqUri
 	}
 	req := &http.Request{
 		URL:        f.httpMsg.Request.URL,
@@ -247,14 +329,17 @@ func (f *GeneralFunc) IfMaxFileSizeExc(returnOrigIfMaxSizeExc bool, serviceName,
 		" MB, the allowed max file size: "+strconv.Itoa(maxFileSize)+" MB")) //check if returning the original file option is enabled in this case or not
 	//if yes, return no modification status code
 	//if not, return an error page
+	logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionMaxSizeExceeded)
 	if returnOrigIfMaxSizeExc {
+		logging.Audit(f.xICAPMetadata).SetVerdict(logging.VerdictAllowed, "")
 		return utils.NoModificationStatusCodeStr, file, nil
 	} else {
+		logging.Audit(f.xICAPMetadata).SetVerdict(logging.VerdictBlocked, "")
 		if methodName == utils.ICAPModeResp {
 
-			htmlErrPage := f.GenHtmlPage(BlockPagePath,
+			htmlErrPage, contentType := f.GenBlockPage(BlockPagePath,
 				utils.ErrPageReasonMaxFileExceeded, serviceName, "-", f.httpMsg.Request.RequestURI, fileSize, f.xICAPMetadata)
-			f.httpMsg.Response = f.ErrPageResp(http.StatusForbidden, htmlErrPage.Len())
+			f.httpMsg.Response = f.ErrPageResp(http.StatusForbidden, htmlErrPage.Len(), contentType)
 			return utils.OkStatusCodeStr, htmlErrPage, f.httpMsg.Response
 		} else {
 			htmlPage, req, err := f.ReqModErrPage(utils.ErrPageReasonMaxFileExceeded, serviceName, "-", fileSize)
@@ -266,11 +351,15 @@ func (f *GeneralFunc) IfMaxFileSizeExc(returnOrigIfMaxSizeExc bool, serviceName,
 	}
 }
 
-// GetFileName returns the filename from the http request
+// GetFileName returns the filename of the Content-Disposition header, the file part of the multipart form
+// or the path of the URL of the http message
 func (f *GeneralFunc) GetFileName() string {
 	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata, "getting the file name"))
 	var filename string
 
+	if filename = f.fileNameFromHeaders(); filename != "" {
+		return filename
+	}
 	if f.httpMsg.Response != nil && f.httpMsg.Response.Request != nil {
 		if f.httpMsg.Response.Request.RequestURI != "" {
 			r := f.httpMsg.Response.Request.URL
@@ -307,13 +396,13 @@ func (f *GeneralFunc) CompressFileGzip(scannedFile []byte) ([]byte, error) {
 }
 
 // ErrPageResp is a func used for creating http response for returning an error page
-func (f *GeneralFunc) ErrPageResp(status int, pageContentLength int) *http.Response {
+func (f *GeneralFunc) ErrPageResp(status int, pageContentLength int, contentType string) *http.Response {
 	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata, "preparing http response with the block page"))
 	return &http.Response{
 		StatusCode: status,
 		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
 		Header: http.Header{
-			utils.ContentType:   []string{utils.HTMLContentType},
+			utils.ContentType:   []string{contentType},
 			utils.ContentLength: []string{strconv.Itoa(pageContentLength)},
 		},
 	}
@@ -322,20 +411,14 @@ func (f *GeneralFunc) ErrPageResp(status int, pageContentLength int) *http.Respo
 // GenHtmlPage is a func used for generating an error page
 func (f *GeneralFunc) GenHtmlPage(path, reason, serviceName, identifierId, reqUrl string, fileSize string, xICAPMetadata string) *bytes.Buffer {
 	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata, "preparing a block page"))
-	htmlTmpl, err := template.ParseFiles(path)
-	if err != nil {
-		logging.Logger.Error("exception page path not exist and replaced with default page")
-		htmlTmpl, _ = template.ParseFiles(utils.BlockPagePath)
-	}
-	htmlErrPage := &bytes.Buffer{}
-	htmlTmpl.Execute(htmlErrPage, &ErrorPage{
+	htmlErrPage, _ := RenderBlockPage(&ErrorPage{
 		Reason:        reason,
 		ServiceName:   serviceName,
 		RequestedURL:  reqUrl,
 		IdentifierId:  identifierId,
 		Size:          fileSize,
 		XICAPMetadata: xICAPMetadata,
-	})
+	}, BlockPageFormatHTML, path)
 	return htmlErrPage
 }
 
@@ -460,6 +543,17 @@ func (f *GeneralFunc) GetMimeExtension(data []byte, contentType string, filename
 	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata,
 		"getting the mime extension of the HTTP message body"))
 	kind, _ := filetype.Match(data)
+	//the executables and the scripts are detected by their headers and their content, so their extension
+	//doesn't depend on the file name of the URL
+	f.executable = executable.Detect(data)
+	if f.executable != nil {
+		logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata,
+			"HTTP message body is an executable: "+f.executable.String()))
+		logging.Audit(f.xICAPMetadata).SetExecutable(f.executable.String())
+		if kind == filetype.Unknown {
+			return f.executable.Extension
+		}
+	}
 	exts := map[string]string{"application/xml": "xml", "application/html": "html", "text/html": "html", "text/json": "html", "application/json": "json", "text/plain": "txt"}
 	contentType = strings.Split(contentType, ";")[0]
 	if kind == filetype.Unknown {
@@ -486,6 +580,7 @@ func (f *GeneralFunc) GetMimeExtension(data []byte, contentType string, filename
 
 }
 
+// LogHTTPMsgHeaders returns the headers of the HTTP message for logging, sensitive headers are redacted
 func (f *GeneralFunc) LogHTTPMsgHeaders(methodName string) map[string]interface{} {
 	msgHeaders := make(map[string]interface{})
 	if methodName == utils.ICAPModeReq {
@@ -497,7 +592,7 @@ func (f *GeneralFunc) LogHTTPMsgHeaders(methodName string) map[string]interface{
 					values += ", "
 				}
 			}
-			msgHeaders[key] = values
+			msgHeaders[key] = logging.RedactHeader(key, values)
 		}
 	} else {
 		for key, value := range f.httpMsg.Response.Header {
@@ -508,7 +603,7 @@ func (f *GeneralFunc) LogHTTPMsgHeaders(methodName string) map[string]interface{
 					values += ", "
 				}
 			}
-			msgHeaders[key] = values
+			msgHeaders[key] = logging.RedactHeader(key, values)
 		}
 	}
 	return msgHeaders
@@ -0,0 +1,31 @@
+package general_functions
+
+import (
+	"bytes"
+	"compress/gzip"
+	"icapeg/logging"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDecompressGzipBodyLimited(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(bytes.Repeat([]byte("a"), 1<<20))
+	w.Close()
+	f := &GeneralFunc{}
+
+	decompressed, err := f.DecompressGzipBodyLimited(bytes.NewBuffer(compressed.Bytes()), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decompressed.Len() != 1025 {
+		t.Errorf("expected the decompression to stop after 1025 bytes, got %d", decompressed.Len())
+	}
+	decompressed, err = f.DecompressGzipBodyLimited(bytes.NewBuffer(compressed.Bytes()), 0)
+	if err != nil || decompressed.Len() != 1<<20 {
+		t.Errorf("expected the whole file without a limit, got %d bytes, %v", decompressed.Len(), err)
+	}
+}
@@ -0,0 +1,233 @@
+package general_functions
+
+import (
+	"encoding/json"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/readValues"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Catalog stores the messages of a locale which are used in block pages,
+// Reasons maps every block reason to its title and message and Labels stores the rest of the page texts
+type Catalog struct {
+	Reasons map[string]ReasonText `json:"reasons"`
+	Labels  map[string]string     `json:"labels"`
+}
+
+// ReasonText is the human-readable text of a block reason
+type ReasonText struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// defaultLocale is the locale of the built-in catalog
+const defaultLocale = "en"
+
+// builtinCatalog is used when a message doesn't exist in the catalog of the locale
+// nor in the catalog of the default locale
+var builtinCatalog = &Catalog{
+	Reasons: map[string]ReasonText{
+		utils.ErrPageReasonFileRejected:     {Title: "File rejected", Message: "Access denied! The file type is not allowed"},
+		utils.ErrPageReasonMaxFileExceeded:  {Title: "The max file size is exceeded", Message: "Access denied! The file size is exceeded"},
+		utils.ErrPageReasonFileIsNotSafe:    {Title: "File is not safe", Message: "Access denied! The file contains a virus"},
+		utils.ErrPageReasonRiskyContent:     {Title: "Risky content", Message: "The requested content may be harmful, make sure you trust it before you continue"},
+		utils.ErrPageReasonURLBlocked:       {Title: "Website blocked", Message: "Access denied! The requested website is not allowed"},
+		utils.ErrPageReasonActiveContent:    {Title: "Active content blocked", Message: "Access denied! The file contains active content such as macros or scripts"},
+		utils.ErrPageReasonFileIsEncrypted:  {Title: "Encrypted file blocked", Message: "Access denied! The file is encrypted and can't be scanned"},
+		utils.ErrPageReasonSensitiveContent: {Title: "Sensitive content blocked", Message: "Access denied! The request contains sensitive content which is not allowed to be sent"},
+	},
+	Labels: map[string]string{
+		"title":        "BLOCK PAGE",
+		"accessDenied": "Access to the requested resource has been denied!",
+		"requestedURL": "Requested URL",
+		"serviceName":  "Service Name",
+		"fileSize":     "File size",
+		"fileHash":     "File Hash",
+		"threatName":   "Threat",
+		"details":      "Details",
+		"blocked":      "The requested content was blocked by ICAPeg.",
+		"proceed":      "Proceed anyway",
+	},
+}
+
+var localesOnce sync.Once
+var catalogs = make(map[string]*Catalog)
+var appDefaultLocale = defaultLocale
+
+// loadLocales loads the message catalogs from the locales directory which is configured
+// in app.locales_dir, every catalog is a JSON file named by its locale (ex: fr.json, pt-br.json)
+func loadLocales() {
+	if readValues.IsSecExists("app.default_locale") {
+		if locale := normalizeLocale(readValues.ReadValuesString("app.default_locale")); locale != "" {
+			appDefaultLocale = locale
+		}
+	}
+	if !readValues.IsSecExists("app.locales_dir") {
+		return
+	}
+	dir := readValues.ReadValuesString("app.locales_dir")
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		logging.Logger.Error("couldn't list the locales directory " + dir + ": " + err.Error())
+		return
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			logging.Logger.Error("couldn't read the catalog " + file + ": " + err.Error())
+			continue
+		}
+		catalog := &Catalog{}
+		if err = json.Unmarshal(content, catalog); err != nil {
+			logging.Logger.Error("couldn't parse the catalog " + file + ": " + err.Error())
+			continue
+		}
+		locale := normalizeLocale(strings.TrimSuffix(filepath.Base(file), ".json"))
+		catalogs[locale] = catalog
+		logging.Logger.Debug("the catalog of " + locale + " locale is loaded")
+	}
+	if _, ok := catalogs[appDefaultLocale]; !ok {
+		logging.Logger.Warn("there is no catalog for the default locale " + appDefaultLocale +
+			", the built-in messages will be used")
+	}
+}
+
+// normalizeLocale converts a language tag to the form which catalogs are stored by (ex: pt_BR -> pt-br)
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// NegotiateLocale chooses the locale of the block page from the Accept-Language header,
+// every language range falls back to its primary language (ex: fr-ca -> fr) and
+// if there is no catalog for any of them, the default locale is returned
+func NegotiateLocale(acceptLanguage string) string {
+	localesOnce.Do(loadLocales)
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []languageRange
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		tag := normalizeLocale(fields[0])
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, languageRange{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	for _, r := range ranges {
+		if r.tag == "*" {
+			return appDefaultLocale
+		}
+		if _, ok := catalogs[r.tag]; ok {
+			return r.tag
+		}
+		if primary := strings.SplitN(r.tag, "-", 2)[0]; primary != r.tag {
+			if _, ok := catalogs[primary]; ok {
+				return primary
+			}
+		}
+		if r.tag == defaultLocale || strings.HasPrefix(r.tag, defaultLocale+"-") {
+			return defaultLocale
+		}
+	}
+	return appDefaultLocale
+}
+
+// catalogChain returns the catalogs which a message is looked up in, by order
+func catalogChain(locale string) []*Catalog {
+	localesOnce.Do(loadLocales)
+	var chain []*Catalog
+	if catalog, ok := catalogs[locale]; ok {
+		chain = append(chain, catalog)
+	}
+	if catalog, ok := catalogs[appDefaultLocale]; ok && locale != appDefaultLocale {
+		chain = append(chain, catalog)
+	}
+	return append(chain, builtinCatalog)
+}
+
+// Translate returns the text of a label in the required locale
+func Translate(locale, key string) string {
+	for _, catalog := range catalogChain(locale) {
+		if text, ok := catalog.Labels[key]; ok && text != "" {
+			return text
+		}
+	}
+	return key
+}
+
+// ReasonTitle returns the human-readable title of a block reason in the required locale
+func ReasonTitle(locale, reason string) string {
+	for _, catalog := range catalogChain(locale) {
+		if text, ok := catalog.Reasons[reason]; ok && text.Title != "" {
+			return text.Title
+		}
+	}
+	return reason
+}
+
+// ReasonMessage returns the human-readable message of a block reason in the required locale
+func ReasonMessage(locale, reason string) string {
+	for _, catalog := range catalogChain(locale) {
+		if text, ok := catalog.Reasons[reason]; ok && text.Message != "" {
+			return text.Message
+		}
+	}
+	return Translate(locale, "accessDenied")
+}
+
+// blockPageFuncs returns the functions which block page templates can use
+// to get the texts of the page in the locale of the block page
+func blockPageFuncs(locale string) map[string]interface{} {
+	return map[string]interface{}{
+		"t": func(key string) string {
+			return Translate(locale, key)
+		},
+		"reasonText": func(reason string) string {
+			return ReasonTitle(locale, reason)
+		},
+		"reasonMessage": func(reason string) string {
+			return ReasonMessage(locale, reason)
+		},
+	}
+}
+
+// localizedPath returns the path of the template of the locale if it exists
+// (ex: block-page.fr-ca.html, then block-page.fr.html), otherwise it returns the path as it is
+func localizedPath(path, locale string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	candidates := []string{locale}
+	if primary := strings.SplitN(locale, "-", 2)[0]; primary != locale {
+		candidates = append(candidates, primary)
+	}
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		localized := base + "." + candidate + ext
+		if _, err := os.Stat(localized); err == nil {
+			return localized
+		}
+	}
+	return path
+}
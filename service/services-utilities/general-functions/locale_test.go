@@ -0,0 +1,59 @@
+package general_functions
+
+import (
+	"icapeg/logging"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNegotiateLocale(t *testing.T) {
+	localesOnce.Do(func() {})
+	catalogs["fr"] = &Catalog{Labels: map[string]string{"details": "Détails"}}
+	catalogs["pt-br"] = &Catalog{}
+	defer func() {
+		delete(catalogs, "fr")
+		delete(catalogs, "pt-br")
+	}()
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"", defaultLocale},
+		{"fr-CA,fr;q=0.9,en;q=0.8", "fr"},
+		{"de-DE,de;q=0.9", defaultLocale},
+		{"pt_BR", "pt-br"},
+		{"en;q=0.5, fr;q=0.9", "fr"},
+		{"fr;q=0", defaultLocale},
+	}
+	for _, tt := range tests {
+		if got := NegotiateLocale(tt.acceptLanguage); got != tt.want {
+			t.Errorf("NegotiateLocale(%q) = %q, want %q", tt.acceptLanguage, got, tt.want)
+		}
+	}
+	if got := Translate("fr", "details"); got != "Détails" {
+		t.Errorf("Translate(fr, details) = %q", got)
+	}
+	if got := Translate("fr", "requestedURL"); got != "Requested URL" {
+		t.Errorf("Translate(fr, requestedURL) should fall back to the built-in catalog, got %q", got)
+	}
+}
+
+func TestRenderBlockPageFallsBackWhenTemplateIsBroken(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	broken := filepath.Join(t.TempDir(), "broken.html")
+	if err := os.WriteFile(broken, []byte("<h1>{{unknownFunc .Reason}}</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	page, contentType := RenderBlockPage(&ErrorPage{Reason: "fileIsNotSafe", ServiceName: "clamav"},
+		BlockPageFormatHTML, broken)
+	if contentType != "text/html" {
+		t.Errorf("content type = %q", contentType)
+	}
+	if !strings.Contains(page.String(), "File is not safe") {
+		t.Errorf("the fallback block page wasn't rendered: %q", page.String())
+	}
+}
@@ -0,0 +1,36 @@
+package general_functions
+
+import (
+	"icapeg/logging"
+	"icapeg/webhook"
+	"time"
+)
+
+// BlockNotification is the payload of the webhooks which are notified when a service blocks
+// an HTTP message, it has the fields of the block page and the details of the client and the file
+type BlockNotification struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	ErrorPage
+	ClientIP string `json:"client_ip,omitempty"`
+	FileHash string `json:"file_hash,omitempty"`
+	Verdict  string `json:"verdict,omitempty"`
+}
+
+// notifyBlock notifies the webhooks that the HTTP message is blocked,
+// the client and the threat details are taken from the audit record of the ICAP transaction
+func (f *GeneralFunc) notifyBlock(errPage ErrorPage) {
+	if errPage.XICAPMetadata == "" {
+		errPage.XICAPMetadata = f.xICAPMetadata
+	}
+	errPage.Locale, errPage.Message, errPage.ProceedURL = "", "", ""
+	record := logging.Audit(f.xICAPMetadata)
+	webhook.Notify(errPage.ServiceName, errPage.Reason, &BlockNotification{
+		Event:     "block",
+		Time:      time.Now().UTC(),
+		ErrorPage: errPage,
+		ClientIP:  record.ClientIP,
+		FileHash:  record.Hashes["sha256"],
+		Verdict:   record.Verdict,
+	})
+}
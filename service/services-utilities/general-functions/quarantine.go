@@ -0,0 +1,27 @@
+package general_functions
+
+import (
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/quarantine"
+)
+
+// QuarantineFile stores the body of a blocked HTTP message in the quarantine if it's enabled
+func (f *GeneralFunc) QuarantineFile(body []byte, serviceName, threatName, client string) {
+	if !quarantine.Init().Enabled {
+		return
+	}
+	rawURL, _ := warnURL(f.httpMsg.Request)
+	err := quarantine.Store(body, quarantine.Metadata{
+		URL:           rawURL,
+		ClientIP:      client,
+		Service:       serviceName,
+		ThreatName:    threatName,
+		XICAPMetadata: f.xICAPMetadata,
+	})
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(f.xICAPMetadata, "couldn't quarantine the file: "+err.Error()))
+		return
+	}
+	logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "the file is quarantined"))
+}
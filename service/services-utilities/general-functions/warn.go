@@ -0,0 +1,285 @@
+package general_functions
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"icapeg/readValues"
+	"icapeg/service/services-utilities/ContentTypes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the default values of the warn configuration
+const (
+	defaultWarnTokenTTL     = 5 * time.Minute
+	defaultWarnBypassPeriod = time.Hour
+)
+
+// warnConfig stores the configuration of the warn and continue mode, it's read from [app] section
+type warnConfig struct {
+	secret       []byte
+	tokenTTL     time.Duration
+	bypassPeriod time.Duration
+}
+
+var warnOnce sync.Once
+var warnCfg *warnConfig
+
+// warnOverrides stores the URLs which clients chose to proceed to after a warning,
+// the key is the service, the client and the URL and the value is the time the override expires at
+var warnOverrides = struct {
+	sync.Mutex
+	entries map[string]time.Time
+}{entries: make(map[string]time.Time)}
+
+// loadWarnConfig reads the optional warn_secret, warn_token_ttl and warn_bypass_period variables
+// from [app] section, if warn_secret isn't set, a random secret is generated which means that
+// the tokens are not valid anymore once ICAPeg restarts
+func loadWarnConfig() {
+	warnCfg = &warnConfig{
+		tokenTTL:     defaultWarnTokenTTL,
+		bypassPeriod: defaultWarnBypassPeriod,
+	}
+	if readValues.IsSecExists("app.warn_secret") {
+		warnCfg.secret = []byte(readValues.ReadValuesString("app.warn_secret"))
+	}
+	if len(warnCfg.secret) == 0 {
+		warnCfg.secret = make([]byte, 32)
+		rand.Read(warnCfg.secret)
+	}
+	if readValues.IsSecExists("app.warn_token_ttl") {
+		if ttl := readValues.ReadValuesDuration("app.warn_token_ttl") * time.Second; ttl > 0 {
+			warnCfg.tokenTTL = ttl
+		}
+	}
+	if readValues.IsSecExists("app.warn_bypass_period") {
+		if period := readValues.ReadValuesDuration("app.warn_bypass_period") * time.Second; period > 0 {
+			warnCfg.bypassPeriod = period
+		}
+	}
+}
+
+// signWarnToken returns the HMAC signature of a token which is bound to the URL, the client and the expiry time
+func signWarnToken(secret []byte, rawURL, client string, expiry int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(rawURL + "\n" + client + "\n" + strconv.FormatInt(expiry, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewWarnToken generates a time-limited token which allows the client to proceed to the URL after a warning,
+// no token is issued without the identity of the client because it would be shared by all the clients of the proxy
+func NewWarnToken(rawURL, client string) (string, error) {
+	warnOnce.Do(loadWarnConfig)
+	if client == "" {
+		return "", errors.New("the client of the warn token is unknown")
+	}
+	expiry := time.Now().Add(warnCfg.tokenTTL).Unix()
+	return strconv.FormatInt(expiry, 10) + "." + signWarnToken(warnCfg.secret, rawURL, client, expiry), nil
+}
+
+// VerifyWarnToken checks that the token is signed by ICAPeg for the URL and the client and that it's not expired
+func VerifyWarnToken(token, rawURL, client string) error {
+	warnOnce.Do(loadWarnConfig)
+	if client == "" {
+		return errors.New("the client of the warn token is unknown")
+	}
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return errors.New("malformed warn token")
+	}
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return errors.New("malformed warn token")
+	}
+	expected := signWarnToken(warnCfg.secret, rawURL, client, expiry)
+	if !hmac.Equal([]byte(expected), []byte(parts[1])) {
+		return errors.New("invalid warn token signature")
+	}
+	if time.Now().Unix() > expiry {
+		return errors.New("warn token is expired")
+	}
+	return nil
+}
+
+// warnURL returns the URL of the HTTP request without the warn token, it's the URL which the tokens are bound to
+func warnURL(req *http.Request) (string, string) {
+	if req == nil || req.URL == nil {
+		return "", ""
+	}
+	u := *req.URL
+	if u.Host == "" {
+		u.Host = req.Host
+	}
+	query := u.Query()
+	token := query.Get(utils.WarnTokenParam)
+	query.Del(utils.WarnTokenParam)
+	u.RawQuery = query.Encode()
+	return u.String(), token
+}
+
+// removeWarnToken removes the warn token from the URL, the other parameters of the query keep their order
+// and their encoding, it returns true if the URL had a warn token
+func removeWarnToken(u *url.URL) bool {
+	if u == nil || u.RawQuery == "" {
+		return false
+	}
+	var params []string
+	removed := false
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		key, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil && unescaped == utils.WarnTokenParam {
+			removed = true
+			continue
+		}
+		params = append(params, param)
+	}
+	if removed {
+		u.RawQuery = strings.Join(params, "&")
+	}
+	return removed
+}
+
+// proceedURL returns the URL of the "proceed anyway" link of the warn page
+func proceedURL(rawURL, token string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	query := u.Query()
+	query.Set(utils.WarnTokenParam, token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// isWarnOverridden checks if the client proceeded to the URL after a warning, either by a valid token
+// in the URL or because the client proceeded to the same URL within the bypass period, the clients
+// without identity can't proceed because their overrides would be shared by all the clients of the proxy
+func (f *GeneralFunc) isWarnOverridden(serviceName, rawURL, token, client string) bool {
+	warnOnce.Do(loadWarnConfig)
+	if client == "" {
+		return false
+	}
+	key := serviceName + "\n" + client + "\n" + rawURL
+	now := time.Now()
+	warnOverrides.Lock()
+	defer warnOverrides.Unlock()
+	if expiry, ok := warnOverrides.entries[key]; ok {
+		if now.Before(expiry) {
+			return true
+		}
+		delete(warnOverrides.entries, key)
+	}
+	if token == "" {
+		return false
+	}
+	if err := VerifyWarnToken(token, rawURL, client); err != nil {
+		logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "the warn token is rejected: "+err.Error()))
+		return false
+	}
+	for k, expiry := range warnOverrides.entries {
+		if now.After(expiry) {
+			delete(warnOverrides.entries, k)
+		}
+	}
+	warnOverrides.entries[key] = now.Add(warnCfg.bypassPeriod)
+	logging.Logger.Info(utils.PrepareLogMsg(f.xICAPMetadata, "the client "+client+" proceeded to "+rawURL+
+		" after a warning, "+serviceName+" service returns 204 for it until "+
+		now.Add(warnCfg.bypassPeriod).UTC().Format(time.RFC3339)))
+	return true
+}
+
+// CheckTheWarnPolicy is a func used for applying the warn and continue mode, if the client proceeded to the URL
+// after a warning, it returns 204 no modifications and the override is recorded in the audit record, otherwise
+// if warn is true, it returns the warn page which has a "proceed anyway" link, the returned bool value indicates
+// whether the service should continue processing or not
+func (f *GeneralFunc) CheckTheWarnPolicy(warn bool, client, serviceName, methodName, identifier, fileSize string,
+	isGzip bool, reqContentType ContentTypes.ContentType, file *bytes.Buffer) (bool, int, interface{}) {
+	rawURL, token := warnURL(f.httpMsg.Request)
+	if rawURL == "" {
+		return true, 0, nil
+	}
+	//the warn token isn't forwarded to the origin server
+	if methodName == utils.ICAPModeReq {
+		removeWarnToken(f.httpMsg.Request.URL)
+	}
+	if f.isWarnOverridden(serviceName, rawURL, token, client) {
+		logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "the client proceeded after a warning"))
+		logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionWarnOverride)
+		logging.Audit(f.xICAPMetadata).SetWarnOverride()
+		logging.Audit(f.xICAPMetadata).SetVerdict(logging.VerdictAllowed, "")
+		fileAfterPrep, httpMsg := f.IfICAPStatusIs204(methodName, utils.NoModificationStatusCodeStr,
+			file, isGzip, reqContentType, f.httpMsg)
+		if fileAfterPrep == nil && httpMsg == nil {
+			return false, utils.InternalServerErrStatusCodeStr, nil
+		}
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			return false, utils.NoModificationStatusCodeStr, msg
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			return false, utils.NoModificationStatusCodeStr, msg
+		}
+		return false, utils.NoModificationStatusCodeStr, nil
+	}
+	if !warn {
+		return true, 0, nil
+	}
+	logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "returning the warn page"))
+	logging.Audit(f.xICAPMetadata).SetDecision(logging.DecisionWarn)
+	logging.Audit(f.xICAPMetadata).SetVerdict(logging.VerdictWarned, "")
+	status, httpMsg := f.WarnPage(serviceName, methodName, identifier, fileSize, rawURL, client)
+	return false, status, httpMsg
+}
+
+// WarnPage is a func used for returning the warn page which has a "proceed anyway" link to the requested URL
+func (f *GeneralFunc) WarnPage(serviceName, methodName, identifier, fileSize, rawURL, client string) (int, interface{}) {
+	errPage := &ErrorPage{
+		Reason:        utils.ErrPageReasonRiskyContent,
+		ServiceName:   serviceName,
+		RequestedURL:  rawURL,
+		IdentifierId:  identifier,
+		Size:          fileSize,
+		XICAPMetadata: f.xICAPMetadata,
+	}
+	//the warn page doesn't have a "proceed anyway" link if the client is unknown
+	if token, err := NewWarnToken(rawURL, client); err == nil {
+		errPage.ProceedURL = proceedURL(rawURL, token)
+	} else {
+		logging.Logger.Debug(utils.PrepareLogMsg(f.xICAPMetadata, "no warn token is issued: "+err.Error()))
+	}
+	if methodName == utils.ICAPModeReq {
+		page, req, err := f.reqModPage(errPage)
+		if err != nil {
+			return utils.InternalServerErrStatusCodeStr, nil
+		}
+		req.Body = io.NopCloser(page)
+		return utils.OkStatusCodeStr, req
+	}
+	accept, acceptLanguage := "", ""
+	if f.httpMsg.Request != nil {
+		accept = f.httpMsg.Request.Header.Get("Accept")
+		acceptLanguage = f.httpMsg.Request.Header.Get("Accept-Language")
+	}
+	errPage.Locale = NegotiateLocale(acceptLanguage)
+	page, contentType := RenderBlockPage(errPage, NegotiateBlockPageFormat(accept), utils.WarnPagePath)
+	f.httpMsg.Response = f.ErrPageResp(http.StatusForbidden, page.Len(), contentType)
+	f.httpMsg.Response.Body = io.NopCloser(page)
+	return utils.OkStatusCodeStr, f.httpMsg.Response
+}
+
+// IsWarnExtension checks if the file extension is one of the warn extensions of the service
+func (f *GeneralFunc) IsWarnExtension(fileExtension string, warnExts []string) bool {
+	return f.inStringSlice(fileExtension, warnExts)
+}
@@ -0,0 +1,93 @@
+package general_functions
+
+import (
+	"bytes"
+	utils "icapeg/consts"
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/service/services-utilities/ContentTypes"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWarnToken(t *testing.T) {
+	const rawURL = "http://example.com/setup.exe"
+	if _, err := NewWarnToken(rawURL, ""); err == nil {
+		t.Error("token is issued without a client")
+	}
+	token, _ := NewWarnToken(rawURL, "10.0.0.1")
+	if err := VerifyWarnToken(token, rawURL, "10.0.0.1"); err != nil {
+		t.Fatalf("valid token is rejected: %v", err)
+	}
+	if err := VerifyWarnToken(token, rawURL, "10.0.0.2"); err == nil {
+		t.Error("token of another client is accepted")
+	}
+	if err := VerifyWarnToken(token, "http://example.com/other.exe", "10.0.0.1"); err == nil {
+		t.Error("token of another URL is accepted")
+	}
+	if err := VerifyWarnToken(token+"x", rawURL, "10.0.0.1"); err == nil {
+		t.Error("tampered token is accepted")
+	}
+	expiry := time.Now().Add(-time.Minute).Unix()
+	expired := strconv.FormatInt(expiry, 10) + "." + signWarnToken(warnCfg.secret, rawURL, "10.0.0.1", expiry)
+	if err := VerifyWarnToken(expired, rawURL, "10.0.0.1"); err == nil {
+		t.Error("expired token is accepted")
+	}
+}
+
+func TestWarnURLStripsTheToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/a.exe?x=1&icapeg_proceed=123.abc", nil)
+	rawURL, token := warnURL(req)
+	if rawURL != "http://example.com/a.exe?x=1" || token != "123.abc" {
+		t.Errorf("warnURL() = %q, %q", rawURL, token)
+	}
+	if got := proceedURL(rawURL, "123.abc"); got != "http://example.com/a.exe?icapeg_proceed=123.abc&x=1" {
+		t.Errorf("proceedURL() = %q", got)
+	}
+}
+
+func TestRemoveWarnToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/a.exe?b=%2F&icapeg_proceed=123.abc&a=1", nil)
+	if !removeWarnToken(req.URL) || req.URL.RawQuery != "b=%2F&a=1" {
+		t.Errorf("expected the token to be removed, got %q", req.URL.RawQuery)
+	}
+	if removeWarnToken(req.URL) {
+		t.Error("expected no token to be removed")
+	}
+}
+
+func TestCheckTheWarnPolicyOverride(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	const rawURL = "http://example.com/setup.exe"
+	token, _ := NewWarnToken(rawURL, "10.0.0.3")
+	req, _ := http.NewRequest(http.MethodGet, rawURL+"?"+utils.WarnTokenParam+"="+token, nil)
+	logging.StartAudit("warn-override", utils.ICAPModeReq, "echo")
+	defer logging.FinishAudit("warn-override")
+	f := NewGeneralFunc(&http_message.HttpMsg{Request: req}, "warn-override")
+	file := &bytes.Buffer{}
+	isProcess, status, _ := f.CheckTheWarnPolicy(true, "10.0.0.3", "echo", utils.ICAPModeReq, "", "0",
+		false, ContentTypes.NewRegularFile(file, false), file)
+	if isProcess || status != utils.NoModificationStatusCodeStr {
+		t.Fatalf("expected 204 after the override, got %v, %d", isProcess, status)
+	}
+	if req.URL.RawQuery != "" {
+		t.Errorf("expected the token to be removed, got %q", req.URL.RawQuery)
+	}
+	record := logging.Audit("warn-override")
+	record.SetDecision(logging.DecisionProcess)
+	if !record.WarnOverride {
+		t.Error("expected the override in the audit record")
+	}
+
+	//the client doesn't need the token within the bypass period
+	req, _ = http.NewRequest(http.MethodGet, rawURL, nil)
+	f = NewGeneralFunc(&http_message.HttpMsg{Request: req}, "warn-override")
+	if _, status, _ = f.CheckTheWarnPolicy(true, "10.0.0.3", "echo", utils.ICAPModeReq, "", "0",
+		false, ContentTypes.NewRegularFile(file, false), file); status != utils.NoModificationStatusCodeStr {
+		t.Errorf("expected 204 within the bypass period, got %d", status)
+	}
+}
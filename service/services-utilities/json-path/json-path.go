@@ -0,0 +1,121 @@
+package json_path
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// splitPath splits a JSON path like data.attributes.results[0].name or data.items[*].id into its keys,
+// array indexes are keys too, and the leading "$." of JSONPath is optional
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+	var keys []string
+	for _, key := range strings.Split(path, ".") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Find returns all the values of a JSON path in a document which is decoded by encoding/json,
+// a "*" key matches all the elements of an array or all the values of an object
+func Find(doc interface{}, path string) []interface{} {
+	values := []interface{}{doc}
+	for _, key := range splitPath(path) {
+		var next []interface{}
+		for _, value := range values {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				if key == "*" {
+					for _, item := range v {
+						next = append(next, item)
+					}
+				} else if item, ok := v[key]; ok {
+					next = append(next, item)
+				}
+			case []interface{}:
+				if key == "*" {
+					next = append(next, v...)
+				} else if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(v) {
+					next = append(next, v[i])
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// Lookup returns the first value of a JSON path in a document
+func Lookup(doc interface{}, path string) (interface{}, bool) {
+	values := Find(doc, path)
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[0], true
+}
+
+// String returns the value as a string, JSON numbers are formatted without exponent
+// and arrays are joined by commas
+func String(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if s := String(item); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+// Truthy reports whether a value means yes: true, a non-zero number, a non-empty array or object,
+// or a string which isn't empty, "0", "false", "no", "none", "clean" or "null"
+func Truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "", "0", "false", "no", "none", "clean", "null":
+			return false
+		}
+		return true
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// Match checks if the keys of a value in a document match a JSON path, a "*" key matches any key
+// or array index (ex: attachments[*].content matches attachments, 0 and content)
+func Match(path string, keys []string) bool {
+	pathKeys := splitPath(path)
+	if len(pathKeys) != len(keys) {
+		return false
+	}
+	for i, key := range pathKeys {
+		if key != "*" && key != keys[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package json_path
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"data":{"results":[{"name":"a","hit":true},{"name":"b","hit":0}],"count":2}}`), &doc)
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"data.results[1].name", "b"},
+		{"$.data.results.0.name", "a"},
+		{"data.results[*].name", "a, b"},
+		{"data.count", "2"},
+		{"data.missing", ""},
+	}
+	for _, test := range tests {
+		var got []interface{}
+		got = append(got, Find(doc, test.path)...)
+		if s := String(got); s != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.path, test.expected, s)
+		}
+	}
+	if v, _ := Lookup(doc, "data.results[0].hit"); !Truthy(v) {
+		t.Error("expected true to be truthy")
+	}
+	if v, _ := Lookup(doc, "data.results[1].hit"); Truthy(v) {
+		t.Error("expected 0 not to be truthy")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"attachments[*].content": true,
+		"attachments[1].content": true,
+		"attachments[0].content": false,
+		"attachments.*.*":        true,
+		"attachments":            false,
+	} {
+		if got := Match(path, []string{"attachments", "1", "content"}); got != expected {
+			t.Errorf("%s: expected %v, got %v", path, expected, got)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package magic
+
+import "bytes"
+
+// the signatures which are used to detect the type of a file by its content,
+// the signature of the OLE2 compound files is ole2.Magic
+var (
+	PDF = []byte("%PDF-")
+	Zip = []byte("PK\x03\x04")
+)
+
+// pdfHeaderOffset is the length of the data where the PDF header is looked for,
+// the readers accept junk before the header so it isn't required to be at the start
+const pdfHeaderOffset = 1024
+
+// IsPDF checks if the data has the PDF header
+func IsPDF(data []byte) bool {
+	if len(data) > pdfHeaderOffset {
+		data = data[:pdfHeaderOffset]
+	}
+	return bytes.Contains(data, PDF)
+}
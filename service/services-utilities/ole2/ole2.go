@@ -0,0 +1,232 @@
+package ole2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Magic is the signature of the OLE2 compound files (ex: doc, xls, ppt, msi and the encrypted OOXML documents)
+var Magic = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// the types of the directory entries
+const (
+	TypeStorage = 1
+	TypeStream  = 2
+	TypeRoot    = 5
+)
+
+const (
+	miniSectorSize = 64
+	endOfChain     = 0xFFFFFFFA
+)
+
+// Entry is an entry of the directory of a compound file, a storage or a stream
+type Entry struct {
+	Name        string
+	Type        byte
+	StartSector uint32
+	Size        uint64
+}
+
+// File is a compound file which is read from memory
+type File struct {
+	data       []byte
+	sectorSize int
+	miniCutoff uint64
+	fat        []uint32
+	miniFAT    []uint32
+	miniStream []byte
+	Entries    []Entry
+}
+
+func errInvalid(reason string) error {
+	return errors.New("invalid OLE2 compound file: " + reason)
+}
+
+// Open reads the header, the FAT and the directory of a compound file
+func Open(data []byte) (*File, error) {
+	if len(data) < 512 || !bytes.HasPrefix(data, Magic) {
+		return nil, errInvalid("the header is truncated")
+	}
+	sectorShift := binary.LittleEndian.Uint16(data[0x1E:])
+	if sectorShift != 9 && sectorShift != 12 {
+		return nil, errInvalid("the sector size is invalid")
+	}
+	if len(data) < 2<<sectorShift {
+		return nil, errInvalid("the file has no sectors after the header")
+	}
+	f := &File{
+		data:       data,
+		sectorSize: 1 << sectorShift,
+		miniCutoff: uint64(binary.LittleEndian.Uint32(data[0x38:])),
+	}
+
+	// the FAT sectors are listed in the header and in the DIFAT sectors chain, the FAT doesn't need
+	// more sectors than the ones which have an entry for every sector of the file
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		fatSectors = append(fatSectors, binary.LittleEndian.Uint32(data[0x4C+4*i:]))
+	}
+	maxFATSectors := (f.sectorsCount() + f.sectorSize/4 - 1) / (f.sectorSize / 4)
+	visited := make([]bool, f.sectorsCount())
+	difat := binary.LittleEndian.Uint32(data[0x44:])
+	for difat < endOfChain && len(fatSectors) < maxFATSectors {
+		s := f.sector(difat)
+		if s == nil || visited[difat] {
+			break
+		}
+		visited[difat] = true
+		for j := 0; j < f.sectorSize/4-1; j++ {
+			fatSectors = append(fatSectors, binary.LittleEndian.Uint32(s[4*j:]))
+		}
+		difat = binary.LittleEndian.Uint32(s[f.sectorSize-4:])
+	}
+	if len(fatSectors) > maxFATSectors {
+		fatSectors = fatSectors[:maxFATSectors]
+	}
+	for _, id := range fatSectors {
+		if s := f.sector(id); s != nil {
+			for j := 0; j < f.sectorSize/4; j++ {
+				f.fat = append(f.fat, binary.LittleEndian.Uint32(s[4*j:]))
+			}
+		}
+	}
+
+	// the directory is a chain of sectors of 128 bytes entries
+	dir, err := f.chain(binary.LittleEndian.Uint32(data[0x30:]))
+	if err != nil {
+		return nil, err
+	}
+	for entry := 0; entry+128 <= len(dir); entry += 128 {
+		e := dir[entry : entry+128]
+		nameLen := int(binary.LittleEndian.Uint16(e[64:]))
+		if nameLen < 2 || nameLen > 64 || e[66] == 0 {
+			continue
+		}
+		units := make([]uint16, nameLen/2-1)
+		for j := range units {
+			units[j] = binary.LittleEndian.Uint16(e[2*j:])
+		}
+		size := binary.LittleEndian.Uint64(e[120:])
+		if f.sectorSize == 512 {
+			size &= 0xFFFFFFFF
+		}
+		f.Entries = append(f.Entries, Entry{
+			Name:        string(utf16.Decode(units)),
+			Type:        e[66],
+			StartSector: binary.LittleEndian.Uint32(e[116:]),
+			Size:        size,
+		})
+	}
+
+	// the small streams are stored in the mini stream which is the stream of the root entry
+	if miniFAT, err := f.chain(binary.LittleEndian.Uint32(data[0x3C:])); err == nil {
+		for j := 0; j+4 <= len(miniFAT); j += 4 {
+			f.miniFAT = append(f.miniFAT, binary.LittleEndian.Uint32(miniFAT[j:]))
+		}
+	}
+	for _, e := range f.Entries {
+		if e.Type == TypeRoot {
+			f.miniStream, _ = f.chain(e.StartSector)
+			break
+		}
+	}
+	return f, nil
+}
+
+// Has checks if the file has a storage or a stream with the name, the names are compared case insensitively
+func (f *File) Has(name string) bool {
+	for _, e := range f.Entries {
+		if strings.EqualFold(e.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stream returns the content of the first stream with the name, nil is returned if there isn't one
+func (f *File) Stream(name string) ([]byte, error) {
+	for _, e := range f.Entries {
+		if e.Type != TypeStream || !strings.EqualFold(e.Name, name) {
+			continue
+		}
+		var data []byte
+		var err error
+		if e.Size < f.miniCutoff {
+			data, err = f.miniChain(e.StartSector)
+		} else {
+			data, err = f.chain(e.StartSector)
+		}
+		if uint64(len(data)) > e.Size {
+			data = data[:e.Size]
+		}
+		return data, err
+	}
+	return nil, nil
+}
+
+// sectorsCount returns the number of the sectors after the header
+func (f *File) sectorsCount() int {
+	if len(f.data) < f.sectorSize {
+		return 0
+	}
+	return len(f.data)/f.sectorSize - 1
+}
+
+// sector returns the content of a sector, nil is returned if it's out of the file
+func (f *File) sector(id uint32) []byte {
+	start := (int(id) + 1) * f.sectorSize
+	if id >= endOfChain || start < 0 || start+f.sectorSize > len(f.data) {
+		return nil
+	}
+	return f.data[start : start+f.sectorSize]
+}
+
+// chain returns the content of a chain of sectors which starts at the sector, the chains of the damaged
+// or the crafted files which have loops are invalid
+func (f *File) chain(id uint32) ([]byte, error) {
+	var data []byte
+	visited := make([]bool, f.sectorsCount())
+	for id < endOfChain {
+		s := f.sector(id)
+		if s == nil {
+			return data, errInvalid("the sector " + strconv.Itoa(int(id)) + " is out of the file")
+		}
+		if visited[id] {
+			return data, errInvalid("the sectors chain has a loop at the sector " + strconv.Itoa(int(id)))
+		}
+		visited[id] = true
+		data = append(data, s...)
+		if int(id) >= len(f.fat) {
+			break
+		}
+		id = f.fat[id]
+	}
+	return data, nil
+}
+
+// miniChain returns the content of a chain of mini sectors which starts at the mini sector
+func (f *File) miniChain(id uint32) ([]byte, error) {
+	var data []byte
+	visited := make([]bool, len(f.miniStream)/miniSectorSize)
+	for id < endOfChain {
+		start := int(id) * miniSectorSize
+		if start < 0 || start+miniSectorSize > len(f.miniStream) {
+			return data, errInvalid("the mini sector " + strconv.Itoa(int(id)) + " is out of the mini stream")
+		}
+		if visited[id] {
+			return data, errInvalid("the mini sectors chain has a loop at the mini sector " + strconv.Itoa(int(id)))
+		}
+		visited[id] = true
+		data = append(data, f.miniStream[start:start+miniSectorSize]...)
+		if int(id) >= len(f.miniFAT) {
+			break
+		}
+		id = f.miniFAT[id]
+	}
+	return data, nil
+}
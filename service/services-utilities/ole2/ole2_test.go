@@ -0,0 +1,69 @@
+package ole2
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// loopedFile builds a compound file whose FAT sector is the directory too, fat[0] is 0 so the directory chain
+// is a loop, the DIFAT sector is the next sector and it points to itself
+func loopedFile() []byte {
+	data := make([]byte, 3*512)
+	copy(data, Magic)
+	binary.LittleEndian.PutUint16(data[0x1E:], 9)
+	binary.LittleEndian.PutUint32(data[0x30:], 0)
+	binary.LittleEndian.PutUint32(data[0x3C:], 0xFFFFFFFE)
+	binary.LittleEndian.PutUint32(data[0x44:], 1)
+	for i := 1; i < 109; i++ {
+		binary.LittleEndian.PutUint32(data[0x4C+4*i:], 0xFFFFFFFF)
+	}
+	difat := data[1024:1536]
+	for i := 0; i < 127; i++ {
+		binary.LittleEndian.PutUint32(difat[4*i:], 0)
+	}
+	binary.LittleEndian.PutUint32(difat[508:], 1)
+	return data
+}
+
+func TestOpenLoopedChains(t *testing.T) {
+	data := loopedFile()
+	if _, err := Open(data); err == nil {
+		t.Error("expected the directory chain loop to be invalid")
+	}
+
+	// the directory ends after the first sector, the FAT has one sector only because its entries
+	// are more than the sectors of the file, so the DIFAT sector which lists it again isn't read
+	binary.LittleEndian.PutUint32(data[512:], 0xFFFFFFFE)
+	f, err := Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.fat) != 512/4 {
+		t.Errorf("expected one FAT sector, got %d entries", len(f.fat))
+	}
+	if data, err := f.chain(0); err != nil || len(data) != 512 {
+		t.Errorf("expected one sector, got %d bytes, %v", len(data), err)
+	}
+
+	f.fat[0] = 0
+	if _, err := f.chain(0); err == nil {
+		t.Error("expected the sectors chain loop to be invalid")
+	}
+	f.miniStream = make([]byte, 2*miniSectorSize)
+	f.miniFAT = []uint32{1, 0}
+	if _, err := f.miniChain(0); err == nil {
+		t.Error("expected the mini sectors chain loop to be invalid")
+	}
+}
+
+func TestOpenTruncatedSectors(t *testing.T) {
+	// the header of the 4096 bytes sectors is bigger than the file
+	data := loopedFile()[:600]
+	binary.LittleEndian.PutUint16(data[0x1E:], 12)
+	if _, err := Open(data); err == nil {
+		t.Error("expected the file without sectors to be invalid")
+	}
+	if count := (&File{data: data, sectorSize: 4096}).sectorsCount(); count != 0 {
+		t.Errorf("expected no sectors, got %d", count)
+	}
+}
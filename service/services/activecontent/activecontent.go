@@ -0,0 +1,267 @@
+package activecontent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (a *Activecontent) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = a.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	a.IcapHeaders = IcapHeader
+	a.IcapHeaders.Add("X-ICAP-Metadata", a.xICAPMetadata)
+	// no need to scan part of the file, this service needs all the file at ine time
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata,
+			a.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	if a.methodName == utils.ICAPModeResp {
+		if a.httpMsg.Response != nil {
+			if a.httpMsg.Response.StatusCode == 206 {
+				logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing byte range received"))
+				return utils.NoModificationStatusCodeStr, a.httpMsg, serviceHeaders,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+		}
+	}
+	isGzip := false
+	ExceptionPagePath := utils.BlockPagePath
+
+	if a.ExceptionPage != "" {
+		ExceptionPagePath = a.ExceptionPage
+	}
+	//extracting the file from http message
+
+	file, reqContentType, err := a.generalFunc.CopyingFileToTheBuffer(a.methodName)
+
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//if the http method is Connect, return the request as it is because it has no body
+	if a.methodName == utils.ICAPModeReq {
+		if a.httpMsg.Request.Method == http.MethodConnect {
+			return utils.OkStatusCodeStr, a.generalFunc.ReturningHttpMessageWithFile(a.methodName, file.Bytes()),
+				serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//getting the extension of the file
+	var contentType []string
+
+	var fileName string
+	if a.methodName == utils.ICAPModeReq {
+		contentType = a.httpMsg.Request.Header["Content-Type"]
+		fileName = a.generalFunc.GetFileName()
+	} else {
+		contentType = a.httpMsg.Response.Header["Content-Type"]
+		fileName = a.generalFunc.GetFileName()
+	}
+	if len(contentType) == 0 {
+		contentType = append(contentType, "")
+	}
+
+	logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" file name : "+fileName))
+
+	fileExtension := a.generalFunc.GetMimeExtension(file.Bytes(), contentType[0], fileName)
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+
+	sha256Sum := sha256.Sum256(file.Bytes())
+	fileSize := fmt.Sprintf("%v", file.Len())
+	fileHash := hex.EncodeToString(sha256Sum[:])
+	logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" file hash : "+fileHash))
+	logging.Audit(a.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := a.generalFunc.CheckTheWarnPolicy(a.generalFunc.IsWarnExtension(fileExtension, a.warnExts),
+		a.IcapHeaders.Get(utils.ClientIPHeader), a.serviceName, a.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+	isProcess, icapStatus, httpMsg = a.generalFunc.CheckTheExtension(fileExtension, a.extArrs,
+		a.processExts, a.rejectExts, a.bypassExts, a.return400IfFileExtRejected, isGzip,
+		a.serviceName, a.methodName, fileHash, a.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	//check if the file size is greater than max file size of the service
+	//if yes we will return 200 ok or 204 no modification, it depends on the configuration of the service
+	if a.maxFileSize != 0 && a.maxFileSize < file.Len() {
+		status, file, httpMsg := a.generalFunc.IfMaxFileSizeExc(a.returnOrigIfMaxSizeExc, a.serviceName, a.methodName, file, a.maxFileSize, ExceptionPagePath, fileSize)
+		fileAfterPrep, httpMsg := a.generalFunc.IfStatusIs204WithFile(a.methodName, status, file, isGzip, reqContentType, httpMsg, true)
+		if fileAfterPrep == nil && httpMsg == nil {
+			logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+			return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+			logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+		return status, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = a.generalFunc.CheckTheContentPolicy(a.serviceName, a.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//detecting the active content of the file and applying the policies of the detected features
+	scannedFile := file.Bytes()
+	scanStart := time.Now()
+	features, err := Detect(scannedFile)
+	logging.Audit(a.xICAPMetadata).StageDone("scan", scanStart)
+	if err != nil {
+		//the policy of the files which couldn't be parsed is applied with the policies of the detected features
+		logging.Logger.Debug(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" the file couldn't be parsed: "+err.Error()))
+		features = append(features, ParseError)
+	}
+	policy := a.policy(features)
+	if len(features) > 0 {
+		serviceHeaders["X-ICAPeg-Active-Content"] = strings.Join(features, ", ")
+		logging.Logger.Debug(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" active content: "+
+			strings.Join(features, ", ")+", policy: "+policy))
+	}
+
+	//check if the client proceeded to the URL after a warning
+	//if yes we will return 204 No modifications, otherwise the warn page which has a "proceed anyway" link
+	if policy == PolicyWarn {
+		isProcess, icapStatus, httpMsg := a.generalFunc.CheckTheWarnPolicy(true, a.IcapHeaders.Get(utils.ClientIPHeader),
+			a.serviceName, a.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+		if !isProcess {
+			logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+			return icapStatus, httpMsg, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	if policy == PolicyBlock {
+		threatName := "active content: " + strings.Join(a.blockedFeatures(features), ", ")
+		logging.Audit(a.xICAPMetadata).SetVerdict(logging.VerdictBlocked, threatName)
+		a.generalFunc.QuarantineFile(scannedFile, a.serviceName, threatName, a.IcapHeaders.Get(utils.ClientIPHeader))
+		if a.methodName == utils.ICAPModeResp {
+
+			errPage, contentType := a.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonActiveContent, a.serviceName, fileHash, a.httpMsg.Request.RequestURI, fileSize, a.xICAPMetadata)
+
+			a.httpMsg.Response = a.generalFunc.ErrPageResp(a.CaseBlockHttpResponseCode, errPage.Len(), contentType)
+			if a.CaseBlockHttpBody {
+				a.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+			} else {
+				var body []byte
+				a.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(body))
+				delete(a.httpMsg.Response.Header, "Content-Type")
+				delete(a.httpMsg.Response.Header, "Content-Length")
+			}
+			logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+			return utils.OkStatusCodeStr, a.httpMsg.Response, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		} else {
+			htmlPage, req, err := a.generalFunc.ReqModErrPage(utils.ErrPageReasonActiveContent, a.serviceName, fileHash, fileSize)
+			if err != nil {
+				logging.Logger.Error(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" error: "+err.Error()))
+
+				return utils.InternalServerErrStatusCodeStr, nil, nil,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+			req.Body = io.NopCloser(htmlPage)
+			msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+			return utils.OkStatusCodeStr, req, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	if err != nil {
+		logging.Audit(a.xICAPMetadata).SetVerdict(logging.VerdictUnscanned, "")
+	} else {
+		logging.Audit(a.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	}
+	//returning the scanned file if everything is ok
+	logging.Logger.Info(utils.PrepareLogMsg(a.xICAPMetadata, a.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = a.generalFunc.LogHTTPMsgHeaders(a.methodName)
+	scannedFile = a.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, a.methodName)
+
+	return utils.NoModificationStatusCodeStr, a.generalFunc.ReturningHttpMessageWithFile(a.methodName, scannedFile),
+		serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// policy returns the strictest policy of the detected features
+func (a *Activecontent) policy(features []string) string {
+	policy := PolicyAllow
+	for _, feature := range features {
+		switch a.Policies[feature] {
+		case PolicyBlock:
+			return PolicyBlock
+		case PolicyWarn:
+			policy = PolicyWarn
+		}
+	}
+	return policy
+}
+
+// blockedFeatures returns the detected features whose policy is block
+func (a *Activecontent) blockedFeatures(features []string) []string {
+	var blocked []string
+	for _, feature := range features {
+		if a.Policies[feature] == PolicyBlock {
+			blocked = append(blocked, feature)
+		}
+	}
+	return blocked
+}
+
+func (a *Activecontent) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
@@ -0,0 +1,28 @@
+package activecontent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	a := &Activecontent{Policies: map[string]string{
+		FeatureMacros:        PolicyWarn,
+		FeaturePDFOpenAction: PolicyAllow,
+		ParseError:           PolicyAllow,
+	}}
+	if policy := a.policy([]string{FeaturePDFOpenAction, ParseError}); policy != PolicyAllow {
+		t.Errorf("expected %s, got %s", PolicyAllow, policy)
+	}
+	if policy := a.policy([]string{FeatureMacros, ParseError}); policy != PolicyWarn {
+		t.Errorf("expected %s, got %s", PolicyWarn, policy)
+	}
+
+	a.Policies[ParseError] = PolicyBlock
+	if policy := a.policy([]string{FeatureMacros, ParseError}); policy != PolicyBlock {
+		t.Errorf("expected the file which couldn't be parsed to be blocked, got %s", policy)
+	}
+	if blocked := a.blockedFeatures([]string{FeatureMacros, ParseError}); !reflect.DeepEqual(blocked, []string{ParseError}) {
+		t.Errorf("expected only %s to be blocked, got %v", ParseError, blocked)
+	}
+}
@@ -0,0 +1,122 @@
+package activecontent
+
+import (
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	services_utilities "icapeg/service/services-utilities"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/textproto"
+	"sync"
+)
+
+// the activecontent constants
+const (
+	ActivecontentIdentifier = "ACTIVECONTENT ID"
+)
+
+var doOnce sync.Once
+var activecontentConfig *Activecontent
+
+// the policies of the active content features
+const (
+	PolicyAllow = "allow"
+	PolicyWarn  = "warn"
+	PolicyBlock = "block"
+)
+
+// ParseError is the policy key of the files which couldn't be parsed, their active content is unknown
+const ParseError = "parse_error"
+
+// defaultPolicies are the policies of the features which aren't set in config.toml file,
+// the features which are common in the benign files are allowed by default
+var defaultPolicies = map[string]string{
+	FeatureMacros:                PolicyBlock,
+	FeatureExternalRelationships: PolicyBlock,
+	FeatureEmbeddedObjects:       PolicyBlock,
+	FeaturePDFJavaScript:         PolicyBlock,
+	FeaturePDFOpenAction:         PolicyAllow,
+	FeaturePDFLaunch:             PolicyBlock,
+	FeaturePDFEmbeddedFile:       PolicyAllow,
+	ParseError:                   PolicyAllow,
+}
+
+// Activecontent represents the information regarding the active content detection service,
+// it detects the macros, the embedded objects and the scripts of the documents and applies the policy of every feature
+type Activecontent struct {
+	xICAPMetadata              string
+	httpMsg                    *http_message.HttpMsg
+	serviceName                string
+	methodName                 string
+	maxFileSize                int
+	bypassExts                 []string
+	processExts                []string
+	rejectExts                 []string
+	warnExts                   []string
+	extArrs                    []services_utilities.Extension
+	Policies                   map[string]string
+	returnOrigIfMaxSizeExc     bool
+	return400IfFileExtRejected bool
+	generalFunc                *general_functions.GeneralFunc
+	CaseBlockHttpResponseCode  int
+	CaseBlockHttpBody          bool
+	ExceptionPage              string
+	IcapHeaders                textproto.MIMEHeader
+}
+
+func InitActivecontentConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		activecontentConfig = &Activecontent{
+			maxFileSize:                readValues.ReadValuesInt(serviceName + ".max_filesize"),
+			bypassExts:                 readValues.ReadValuesSlice(serviceName + ".bypass_extensions"),
+			processExts:                readValues.ReadValuesSlice(serviceName + ".process_extensions"),
+			rejectExts:                 readValues.ReadValuesSlice(serviceName + ".reject_extensions"),
+			Policies:                   make(map[string]string),
+			returnOrigIfMaxSizeExc:     readValues.ReadValuesBool(serviceName + ".return_original_if_max_file_size_exceeded"),
+			return400IfFileExtRejected: readValues.ReadValuesBool(serviceName + ".return_400_if_file_ext_rejected"),
+			CaseBlockHttpResponseCode:  readValues.ReadValuesInt(serviceName + ".http_exception_response_code"),
+			CaseBlockHttpBody:          readValues.ReadValuesBool(serviceName + ".http_exception_has_body"),
+			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
+		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			activecontentConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		keys := append([]string{ParseError}, Features...)
+		for _, feature := range keys {
+			policy := defaultPolicies[feature]
+			if readValues.IsSecExists(serviceName + "." + feature) {
+				policy = readValues.ReadValuesString(serviceName + "." + feature)
+			}
+			if policy != PolicyAllow && policy != PolicyWarn && policy != PolicyBlock {
+				logging.Logger.Fatal(serviceName + "." + feature + " should be " + PolicyAllow + ", " +
+					PolicyWarn + " or " + PolicyBlock)
+			}
+			activecontentConfig.Policies[feature] = policy
+		}
+		activecontentConfig.extArrs = services_utilities.InitExtsArr(activecontentConfig.processExts, activecontentConfig.rejectExts, activecontentConfig.bypassExts)
+	})
+}
+
+// NewActivecontentService returns a new populated instance of the activecontent service
+func NewActivecontentService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Activecontent {
+	return &Activecontent{
+		xICAPMetadata:              xICAPMetadata,
+		httpMsg:                    httpMsg,
+		serviceName:                serviceName,
+		methodName:                 methodName,
+		maxFileSize:                activecontentConfig.maxFileSize,
+		bypassExts:                 activecontentConfig.bypassExts,
+		processExts:                activecontentConfig.processExts,
+		rejectExts:                 activecontentConfig.rejectExts,
+		warnExts:                   activecontentConfig.warnExts,
+		extArrs:                    activecontentConfig.extArrs,
+		Policies:                   activecontentConfig.Policies,
+		returnOrigIfMaxSizeExc:     activecontentConfig.returnOrigIfMaxSizeExc,
+		return400IfFileExtRejected: activecontentConfig.return400IfFileExtRejected,
+		generalFunc:                general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+		CaseBlockHttpResponseCode:  activecontentConfig.CaseBlockHttpResponseCode,
+		CaseBlockHttpBody:          activecontentConfig.CaseBlockHttpBody,
+		ExceptionPage:              activecontentConfig.ExceptionPage,
+	}
+}
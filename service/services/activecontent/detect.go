@@ -0,0 +1,236 @@
+package activecontent
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"icapeg/service/services-utilities/magic"
+	"icapeg/service/services-utilities/ole2"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// the active content features which can be detected
+const (
+	FeatureMacros                = "macros"
+	FeatureExternalRelationships = "external_relationships"
+	FeatureEmbeddedObjects       = "embedded_objects"
+	FeaturePDFJavaScript         = "pdf_javascript"
+	FeaturePDFOpenAction         = "pdf_open_action"
+	FeaturePDFLaunch             = "pdf_launch"
+	FeaturePDFEmbeddedFile       = "pdf_embedded_file"
+)
+
+// Features are all the features in the order they're reported
+var Features = []string{FeatureMacros, FeatureExternalRelationships, FeatureEmbeddedObjects,
+	FeaturePDFJavaScript, FeaturePDFOpenAction, FeaturePDFLaunch, FeaturePDFEmbeddedFile}
+
+// the limits of the data which is read from a container to detect its features
+const (
+	maxRelsSize     = 1024 * 1024
+	maxInflatedSize = 16 * 1024 * 1024
+)
+
+// ole2Names maps the names of the OLE2 storages and streams (lower case) to the features they indicate
+var ole2Names = map[string]string{
+	"vba":              FeatureMacros,
+	"_vba_project":     FeatureMacros,
+	"_vba_project_cur": FeatureMacros,
+	"macros":           FeatureMacros,
+	"objectpool":       FeatureEmbeddedObjects,
+	"\x01ole10native":  FeatureEmbeddedObjects,
+}
+
+// pdfNames maps the PDF names to the features they indicate
+var pdfNames = map[string]string{
+	"JavaScript":    FeaturePDFJavaScript,
+	"JS":            FeaturePDFJavaScript,
+	"OpenAction":    FeaturePDFOpenAction,
+	"AA":            FeaturePDFOpenAction,
+	"Launch":        FeaturePDFLaunch,
+	"EmbeddedFile":  FeaturePDFEmbeddedFile,
+	"EmbeddedFiles": FeaturePDFEmbeddedFile,
+}
+
+// Detect returns the active content features of an OOXML document, an OLE2 compound file
+// or a PDF, the type of the file is detected by its content, not by its extension
+func Detect(data []byte) ([]string, error) {
+	found := make(map[string]bool)
+	var err error
+	switch {
+	case bytes.HasPrefix(data, magic.Zip):
+		err = detectOOXML(data, found)
+	case bytes.HasPrefix(data, ole2.Magic):
+		err = detectOLE2(data, found)
+	case magic.IsPDF(data):
+		detectPDF(data, found)
+	}
+	var features []string
+	for _, feature := range Features {
+		if found[feature] {
+			features = append(features, feature)
+		}
+	}
+	return features, err
+}
+
+type relationships struct {
+	Relationships []struct {
+		Type       string `xml:"Type,attr"`
+		Target     string `xml:"Target,attr"`
+		TargetMode string `xml:"TargetMode,attr"`
+	} `xml:"Relationship"`
+}
+
+// detectOOXML looks for the VBA project, the embedded OLE objects and ActiveX controls, and the external
+// relationships of an OOXML zip container, the external hyperlinks are ignored because they aren't active
+func detectOOXML(data []byte, found map[string]bool) error {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	isOOXML := false
+	for _, file := range archive.File {
+		if file.Name == "[Content_Types].xml" {
+			isOOXML = true
+		}
+	}
+	if !isOOXML {
+		return nil
+	}
+	for _, file := range archive.File {
+		name := strings.ToLower(file.Name)
+		dir, base := path.Split(name)
+		switch {
+		case base == "vbaproject.bin" || base == "vbadata.xml":
+			found[FeatureMacros] = true
+		case strings.HasSuffix(dir, "/embeddings/") && strings.HasSuffix(base, ".bin"),
+			strings.HasSuffix(dir, "/activex/") && strings.HasSuffix(base, ".bin"):
+			found[FeatureEmbeddedObjects] = true
+		case strings.HasSuffix(base, ".rels"):
+			external, err := hasExternalRelationship(file)
+			if err != nil {
+				return err
+			}
+			if external {
+				found[FeatureExternalRelationships] = true
+			}
+		}
+	}
+	return nil
+}
+
+// hasExternalRelationship checks whether a relationships part has an external target which isn't a hyperlink,
+// ex: a remote template or an OLE object which is loaded when the document is opened
+func hasExternalRelationship(file *zip.File) (bool, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return false, err
+	}
+	defer reader.Close()
+	var rels relationships
+	if err := xml.NewDecoder(io.LimitReader(reader, maxRelsSize)).Decode(&rels); err != nil {
+		return false, nil
+	}
+	for _, rel := range rels.Relationships {
+		if strings.EqualFold(rel.TargetMode, "External") && !strings.HasSuffix(rel.Type, "/hyperlink") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// detectOLE2 reads the directory of an OLE2 compound file and looks for the storages and the streams
+// of the VBA project (ex: "VBA", "_VBA_PROJECT_CUR", "Macros") and of the embedded objects
+func detectOLE2(data []byte, found map[string]bool) error {
+	file, err := ole2.Open(data)
+	if err != nil {
+		return err
+	}
+	for _, entry := range file.Entries {
+		if feature := ole2Names[strings.ToLower(entry.Name)]; feature != "" {
+			found[feature] = true
+		}
+	}
+	return nil
+}
+
+// detectPDF looks for the names of the active content in the PDF and in its compressed streams (ex: object
+// streams), the names are decoded from their #xx escapes because they're used to hide them (ex: /J#61vaScript)
+func detectPDF(data []byte, found map[string]bool) {
+	scanPDFNames(data, found)
+	inflated := 0
+	for rest := data; inflated < maxInflatedSize; {
+		start := bytes.Index(rest, []byte("stream"))
+		if start < 0 {
+			break
+		}
+		rest = rest[start+len("stream"):]
+		if bytes.HasPrefix(rest, []byte("\r\n")) {
+			rest = rest[2:]
+		} else if bytes.HasPrefix(rest, []byte("\n")) {
+			rest = rest[1:]
+		} else {
+			continue
+		}
+		end := bytes.Index(rest, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		reader, err := zlib.NewReader(bytes.NewReader(rest[:end]))
+		if err == nil {
+			stream, _ := io.ReadAll(io.LimitReader(reader, int64(maxInflatedSize-inflated)))
+			inflated += len(stream)
+			scanPDFNames(stream, found)
+		}
+		rest = rest[end+len("endstream"):]
+	}
+}
+
+// scanPDFNames adds the features of the PDF names in the data
+func scanPDFNames(data []byte, found map[string]bool) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != '/' {
+			continue
+		}
+		j := i + 1
+		for j < len(data) && !isPDFDelimiter(data[j]) {
+			j++
+		}
+		if feature := pdfNames[decodePDFName(data[i+1:j])]; feature != "" {
+			found[feature] = true
+		}
+		i = j - 1
+	}
+}
+
+// isPDFDelimiter checks if the byte ends a PDF name
+func isPDFDelimiter(b byte) bool {
+	switch b {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// decodePDFName decodes the #xx escapes of a PDF name
+func decodePDFName(name []byte) string {
+	if bytes.IndexByte(name, '#') < 0 {
+		return string(name)
+	}
+	var decoded []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if b, err := strconv.ParseUint(string(name[i+1:i+3]), 16, 8); err == nil {
+				decoded = append(decoded, byte(b))
+				i += 2
+				continue
+			}
+		}
+		decoded = append(decoded, name[i])
+	}
+	return string(decoded)
+}
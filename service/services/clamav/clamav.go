@@ -97,7 +97,21 @@ func (c *Clamav) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int,
 	fileSize := fmt.Sprintf("%v", file.Len())
 	fileHash := hex.EncodeToString(hash.Sum([]byte(nil)))
 	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" file hash : "+fileHash))
-	isProcess, icapStatus, httpMsg := c.generalFunc.CheckTheExtension(fileExtension, c.extArrs,
+	logging.Audit(c.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := c.generalFunc.CheckTheWarnPolicy(c.generalFunc.IsWarnExtension(fileExtension, c.warnExts),
+		c.IcapHeaders.Get(utils.ClientIPHeader), c.serviceName, c.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+	isProcess, icapStatus, httpMsg = c.generalFunc.CheckTheExtension(fileExtension, c.extArrs,
 		c.processExts, c.rejectExts, c.bypassExts, c.return400IfFileExtRejected, isGzip,
 		c.serviceName, c.methodName, fileHash, c.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
 	if !isProcess {
@@ -135,9 +149,33 @@ func (c *Clamav) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int,
 		return status, nil, nil,
 			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
 	}
+
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = c.generalFunc.CheckTheContentPolicy(c.serviceName, c.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	//check if the file is an encrypted archive or document which can't be scanned
+	//if yes we will apply the encrypted files policy of the service (allow, warn or block)
+	isProcess, icapStatus, httpMsg = c.generalFunc.CheckTheEncryptionPolicy(c.encryptedFiles,
+		c.IcapHeaders.Get(utils.ClientIPHeader), c.serviceName, c.methodName, fileHash, c.httpMsg.Request.RequestURI,
+		fileSize, isGzip, reqContentType, file, ExceptionPagePath)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
 	clmd := clamd.NewClamd(c.SocketPath)
 	logging.Logger.Debug(utils.PrepareLogMsg(c.xICAPMetadata,
 		"sending the HTTP msg body to the ClamAV through antivirus socket"))
+	scanStart := time.Now()
 	response, err := clmd.ScanStream(bytes.NewReader(file.Bytes()), make(chan bool))
 	if err != nil {
 		logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
@@ -169,12 +207,15 @@ func (c *Clamav) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int,
 		return utils.BadRequestStatusCodeStr, nil, nil,
 			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
 	}
+	logging.Audit(c.xICAPMetadata).StageDone("scan", scanStart)
 	if result.Status == ClamavMalStatus {
+		logging.Audit(c.xICAPMetadata).SetVerdict(logging.VerdictMalicious, result.Description)
 		logging.Logger.Debug(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+"File is not safe"))
+		c.generalFunc.QuarantineFile(file.Bytes(), c.serviceName, result.Description, c.IcapHeaders.Get(utils.ClientIPHeader))
 		if c.methodName == utils.ICAPModeResp {
-			errPage := c.generalFunc.GenHtmlPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, c.serviceName, c.FileHash, c.httpMsg.Request.RequestURI, fileSize, c.xICAPMetadata)
+			errPage, contentType := c.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, c.serviceName, c.FileHash, c.httpMsg.Request.RequestURI, fileSize, c.xICAPMetadata)
 
-			c.httpMsg.Response = c.generalFunc.ErrPageResp(c.CaseBlockHttpResponseCode, errPage.Len())
+			c.httpMsg.Response = c.generalFunc.ErrPageResp(c.CaseBlockHttpResponseCode, errPage.Len(), contentType)
 			if c.CaseBlockHttpBody {
 				c.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
 			} else {
@@ -202,6 +243,7 @@ func (c *Clamav) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int,
 				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
 		}
 	}
+	logging.Audit(c.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
 	//returning the scanned file if everything is ok
 	fileAfterPrep, httpMsg := c.generalFunc.IfICAPStatusIs204(c.methodName, utils.NoModificationStatusCodeStr,
 		file, false, reqContentType, c.httpMsg)
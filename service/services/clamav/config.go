@@ -31,6 +31,7 @@ type Clamav struct {
 	bypassExts  []string
 	processExts []string
 	rejectExts  []string
+	warnExts    []string
 	extArrs     []services_utilities.Extension
 	SocketPath  string
 	Timeout     time.Duration
@@ -45,6 +46,7 @@ type Clamav struct {
 	CaseBlockHttpResponseCode  int
 	CaseBlockHttpBody          bool
 	ExceptionPage              string
+	encryptedFiles             string
 	IcapHeaders                textproto.MIMEHeader
 }
 
@@ -67,6 +69,13 @@ func InitClamavConfig(serviceName string) {
 			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
 		}
 
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			clamavConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		if readValues.IsSecExists(serviceName + ".encrypted_files") {
+			clamavConfig.encryptedFiles = readValues.ReadValuesString(serviceName + ".encrypted_files")
+		}
+		clamavConfig.encryptedFiles = general_functions.ReadEncryptedFilesPolicy(serviceName, clamavConfig.encryptedFiles)
 		clamavConfig.extArrs = services_utilities.InitExtsArr(clamavConfig.processExts, clamavConfig.rejectExts, clamavConfig.bypassExts)
 	})
 }
@@ -82,6 +91,7 @@ func NewClamavService(serviceName, methodName string, httpMsg *http_message.Http
 		bypassExts:                 clamavConfig.bypassExts,
 		processExts:                clamavConfig.processExts,
 		rejectExts:                 clamavConfig.rejectExts,
+		warnExts:                   clamavConfig.warnExts,
 		extArrs:                    clamavConfig.extArrs,
 		Timeout:                    clamavConfig.Timeout * time.Second,
 		SocketPath:                 clamavConfig.SocketPath,
@@ -92,5 +102,6 @@ func NewClamavService(serviceName, methodName string, httpMsg *http_message.Http
 		CaseBlockHttpResponseCode:  clamavConfig.CaseBlockHttpResponseCode,
 		CaseBlockHttpBody:          clamavConfig.CaseBlockHttpBody,
 		ExceptionPage:              clamavConfig.ExceptionPage,
+		encryptedFiles:             clamavConfig.encryptedFiles,
 	}
 }
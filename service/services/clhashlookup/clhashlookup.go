@@ -99,10 +99,22 @@ func (h *Hashlookup) Processing(partial bool, IcapHeader textproto.MIMEHeader) (
 	fileSize := fmt.Sprintf("%v", file.Len())
 	fileHash := hex.EncodeToString(hash.Sum([]byte(nil)))
 	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" file hash : "+fileHash))
+	logging.Audit(h.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := h.generalFunc.CheckTheWarnPolicy(h.generalFunc.IsWarnExtension(fileExtension, h.warnExts),
+		h.IcapHeaders.Get(utils.ClientIPHeader), h.serviceName, h.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
 
 	//check if the file extension is a bypass extension
 	//if yes we will not modify the file, and we will return 204 No modifications
-	isProcess, icapStatus, httpMsg := h.generalFunc.CheckTheExtension(fileExtension, h.extArrs,
+	isProcess, icapStatus, httpMsg = h.generalFunc.CheckTheExtension(fileExtension, h.extArrs,
 		h.processExts, h.rejectExts, h.bypassExts, h.return400IfFileExtRejected, isGzip,
 		h.serviceName, h.methodName, fileHash, h.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
 	if !isProcess {
@@ -140,8 +152,33 @@ func (h *Hashlookup) Processing(partial bool, IcapHeader textproto.MIMEHeader) (
 			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
 	}
 
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = h.generalFunc.CheckTheContentPolicy(h.serviceName, h.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file is an encrypted archive or document which can't be scanned
+	//if yes we will apply the encrypted files policy of the service (allow, warn or block)
+	isProcess, icapStatus, httpMsg = h.generalFunc.CheckTheEncryptionPolicy(h.encryptedFiles,
+		h.IcapHeaders.Get(utils.ClientIPHeader), h.serviceName, h.methodName, fileHash, h.httpMsg.Request.RequestURI,
+		fileSize, isGzip, reqContentType, file, ExceptionPagePath)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
 	scannedFile := file.Bytes()
-	isMal, err := h.sendFileToScan(file)
+	scanStart := time.Now()
+	isMal, threatName, err := h.sendFileToScan(file)
+	logging.Audit(h.xICAPMetadata).StageDone("scan", scanStart)
 	if err != nil && !h.BypassOnApiError {
 		logging.Logger.Error(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" error: "+err.Error()))
 		if strings.Contains(err.Error(), "context deadline exceeded") {
@@ -156,12 +193,14 @@ func (h *Hashlookup) Processing(partial bool, IcapHeader textproto.MIMEHeader) (
 	}
 
 	if isMal {
+		logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictMalicious, threatName)
 		logging.Logger.Debug(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+": file is not safe"))
+		h.generalFunc.QuarantineFile(scannedFile, h.serviceName, threatName, h.IcapHeaders.Get(utils.ClientIPHeader))
 		if h.methodName == utils.ICAPModeResp {
 
-			errPage := h.generalFunc.GenHtmlPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, h.serviceName, h.FileHash, h.httpMsg.Request.RequestURI, fileSize, h.xICAPMetadata)
+			errPage, contentType := h.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, h.serviceName, h.FileHash, h.httpMsg.Request.RequestURI, fileSize, h.xICAPMetadata)
 
-			h.httpMsg.Response = h.generalFunc.ErrPageResp(h.CaseBlockHttpResponseCode, errPage.Len())
+			h.httpMsg.Response = h.generalFunc.ErrPageResp(h.CaseBlockHttpResponseCode, errPage.Len(), contentType)
 			if h.CaseBlockHttpBody {
 				h.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
 			} else {
@@ -189,6 +228,12 @@ func (h *Hashlookup) Processing(partial bool, IcapHeader textproto.MIMEHeader) (
 		}
 	}
 
+	//the file is allowed without being scanned if the scanner error is bypassed
+	if err != nil {
+		logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictUnscanned, "")
+	} else {
+		logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	}
 	//returning the scanned file if everything is ok
 	//scannedFile = h.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, h.methodName)
 	h.generalFunc.LogHTTPMsgHeaders(h.methodName)
@@ -211,8 +256,8 @@ func (h *Hashlookup) Processing(partial bool, IcapHeader textproto.MIMEHeader) (
 
 }
 
-// SendFileToScan is a function to send the file to API
-func (h *Hashlookup) sendFileToScan(f *bytes.Buffer) (bool, error) {
+// SendFileToScan is a function to send the file to API, it returns the KnownMalicious value as the threat name
+func (h *Hashlookup) sendFileToScan(f *bytes.Buffer) (bool, string, error) {
 	hash := sha256.New()
 	_, _ = io.Copy(hash, f)
 	fileHash := hex.EncodeToString(hash.Sum([]byte(nil)))
@@ -225,16 +270,16 @@ func (h *Hashlookup) sendFileToScan(f *bytes.Buffer) (bool, error) {
 	req = req.WithContext(ctx)
 	resp, err := client.Do(req)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 	defer resp.Body.Close()
 	var data map[string]interface{}
 	err = json.NewDecoder(resp.Body).Decode(&data)
 	y, err := (fmt.Sprint(data["KnownMalicious"])), nil
 	if len(y) > 0 && y != "<nil>" {
-		return true, nil
+		return true, y, nil
 	} else {
-		return false, nil
+		return false, "", nil
 
 	}
 
@@ -24,6 +24,8 @@ type Hashlookup struct {
 	bypassExts                 []string
 	processExts                []string
 	rejectExts                 []string
+	warnExts                   []string
+	encryptedFiles             string
 	extArrs                    []services_utilities.Extension
 	ScanUrl                    string
 	Timeout                    time.Duration
@@ -57,6 +59,13 @@ func InitHashlookupConfig(serviceName string) {
 			CaseBlockHttpBody:          readValues.ReadValuesBool(serviceName + ".http_exception_has_body"),
 			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
 		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			HashLookupConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		if readValues.IsSecExists(serviceName + ".encrypted_files") {
+			HashLookupConfig.encryptedFiles = readValues.ReadValuesString(serviceName + ".encrypted_files")
+		}
+		HashLookupConfig.encryptedFiles = general_functions.ReadEncryptedFilesPolicy(serviceName, HashLookupConfig.encryptedFiles)
 		HashLookupConfig.extArrs = services_utilities.InitExtsArr(HashLookupConfig.processExts, HashLookupConfig.rejectExts, HashLookupConfig.bypassExts)
 	})
 }
@@ -72,6 +81,8 @@ func NewHashlookupService(serviceName, methodName string, httpMsg *http_message.
 		bypassExts:                 HashLookupConfig.bypassExts,
 		processExts:                HashLookupConfig.processExts,
 		rejectExts:                 HashLookupConfig.rejectExts,
+		warnExts:                   HashLookupConfig.warnExts,
+		encryptedFiles:             HashLookupConfig.encryptedFiles,
 		extArrs:                    HashLookupConfig.extArrs,
 		ScanUrl:                    HashLookupConfig.ScanUrl,
 		Timeout:                    HashLookupConfig.Timeout * time.Second,
@@ -0,0 +1,343 @@
+package cloudmersive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (c *Cloudmersive) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = c.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	c.IcapHeaders = IcapHeader
+	c.IcapHeaders.Add("X-ICAP-Metadata", c.xICAPMetadata)
+	// no need to scan part of the file, this service needs all the file at ine time
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata,
+			c.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	if c.methodName == utils.ICAPModeResp {
+		if c.httpMsg.Response != nil {
+			if c.httpMsg.Response.StatusCode == 206 {
+				logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing byte range received"))
+				return utils.NoModificationStatusCodeStr, c.httpMsg, serviceHeaders,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+		}
+	}
+	isGzip := false
+	ExceptionPagePath := utils.BlockPagePath
+
+	if c.ExceptionPage != "" {
+		ExceptionPagePath = c.ExceptionPage
+	}
+	//extracting the file from http message
+
+	file, reqContentType, err := c.generalFunc.CopyingFileToTheBuffer(c.methodName)
+
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//if the http method is Connect, return the request as it is because it has no body
+	if c.methodName == utils.ICAPModeReq {
+		if c.httpMsg.Request.Method == http.MethodConnect {
+			return utils.OkStatusCodeStr, c.generalFunc.ReturningHttpMessageWithFile(c.methodName, file.Bytes()),
+				serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//getting the extension of the file
+	var contentType []string
+
+	var fileName string
+	if c.methodName == utils.ICAPModeReq {
+		contentType = c.httpMsg.Request.Header["Content-Type"]
+		fileName = c.generalFunc.GetFileName()
+	} else {
+		contentType = c.httpMsg.Response.Header["Content-Type"]
+		fileName = c.generalFunc.GetFileName()
+	}
+	if len(contentType) == 0 {
+		contentType = append(contentType, "")
+	}
+
+	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" file name : "+fileName))
+
+	fileExtension := c.generalFunc.GetMimeExtension(file.Bytes(), contentType[0], fileName)
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+
+	hash := sha256.New()
+	f := file
+	_, err = hash.Write(f.Bytes())
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
+	}
+	fileSize := fmt.Sprintf("%v", file.Len())
+	fileHash := hex.EncodeToString(hash.Sum([]byte(nil)))
+	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" file hash : "+fileHash))
+	logging.Audit(c.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := c.generalFunc.CheckTheWarnPolicy(c.generalFunc.IsWarnExtension(fileExtension, c.warnExts),
+		c.IcapHeaders.Get(utils.ClientIPHeader), c.serviceName, c.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+	isProcess, icapStatus, httpMsg = c.generalFunc.CheckTheExtension(fileExtension, c.extArrs,
+		c.processExts, c.rejectExts, c.bypassExts, c.return400IfFileExtRejected, isGzip,
+		c.serviceName, c.methodName, fileHash, c.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	//check if the file size is greater than max file size of the service
+	//if yes we will return 200 ok or 204 no modification, it depends on the configuration of the service
+	if c.maxFileSize != 0 && c.maxFileSize < file.Len() {
+		status, file, httpMsg := c.generalFunc.IfMaxFileSizeExc(c.returnOrigIfMaxSizeExc, c.serviceName, c.methodName, file, c.maxFileSize, ExceptionPagePath, fileSize)
+		fileAfterPrep, httpMsg := c.generalFunc.IfStatusIs204WithFile(c.methodName, status, file, isGzip, reqContentType, httpMsg, true)
+		if fileAfterPrep == nil && httpMsg == nil {
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return status, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = c.generalFunc.CheckTheContentPolicy(c.serviceName, c.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	scannedFile := file.Bytes()
+	scanStart := time.Now()
+	isMal, threatName, err := c.sendFileToScan(file.Bytes(), fileName)
+	logging.Audit(c.xICAPMetadata).StageDone("scan", scanStart)
+	if err != nil && !c.BypassOnApiError {
+		logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
+		if strings.Contains(err.Error(), "context deadline exceeded") {
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			return utils.RequestTimeOutStatusCodeStr, nil, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		// its suppose to be InternalServerErrStatusCodeStr but need to be handled
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		return utils.BadRequestStatusCodeStr, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	if err != nil {
+		logging.Logger.Warn(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error is bypassed: "+err.Error()))
+	}
+
+	if isMal {
+		logging.Audit(c.xICAPMetadata).SetVerdict(logging.VerdictMalicious, threatName)
+		if threatName != "" {
+			serviceHeaders["X-Virus-ID"] = threatName
+		}
+		logging.Logger.Debug(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+": file is not safe"))
+		c.generalFunc.QuarantineFile(scannedFile, c.serviceName, threatName, c.IcapHeaders.Get(utils.ClientIPHeader))
+		if c.methodName == utils.ICAPModeResp {
+
+			errPage, contentType := c.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, c.serviceName, fileHash, c.httpMsg.Request.RequestURI, fileSize, c.xICAPMetadata)
+
+			c.httpMsg.Response = c.generalFunc.ErrPageResp(c.CaseBlockHttpResponseCode, errPage.Len(), contentType)
+			if c.CaseBlockHttpBody {
+				c.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+			} else {
+				var body []byte
+				c.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(body))
+				delete(c.httpMsg.Response.Header, "Content-Type")
+				delete(c.httpMsg.Response.Header, "Content-Length")
+			}
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+			return utils.OkStatusCodeStr, c.httpMsg.Response, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		} else {
+			htmlPage, req, err := c.generalFunc.ReqModErrPage(utils.ErrPageReasonFileIsNotSafe, c.serviceName, fileHash, fileSize)
+			if err != nil {
+				logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
+
+				return utils.InternalServerErrStatusCodeStr, nil, nil,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+			req.Body = io.NopCloser(htmlPage)
+			msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+			return utils.OkStatusCodeStr, req, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//the file is allowed without being scanned if the scanner error is bypassed
+	if err != nil {
+		logging.Audit(c.xICAPMetadata).SetVerdict(logging.VerdictUnscanned, "")
+	} else {
+		logging.Audit(c.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	}
+	//returning the scanned file if everything is ok
+	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+	scannedFile = c.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, c.methodName)
+
+	return utils.NoModificationStatusCodeStr, c.generalFunc.ReturningHttpMessageWithFile(c.methodName, scannedFile),
+		serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// foundVirus is a virus which Cloudmersive found in the file
+type foundVirus struct {
+	FileName  string `json:"FileName"`
+	VirusName string `json:"VirusName"`
+}
+
+// scanResult is the response of the advanced virus scan endpoint of Cloudmersive
+type scanResult struct {
+	CleanResult                   bool         `json:"CleanResult"`
+	ContainsExecutable            bool         `json:"ContainsExecutable"`
+	ContainsInvalidFile           bool         `json:"ContainsInvalidFile"`
+	ContainsScript                bool         `json:"ContainsScript"`
+	ContainsPasswordProtectedFile bool         `json:"ContainsPasswordProtectedFile"`
+	ContainsMacros                bool         `json:"ContainsMacros"`
+	FoundViruses                  []foundVirus `json:"FoundViruses"`
+}
+
+// threatNames returns the names of the viruses which Cloudmersive found, if the file isn't clean
+// because of a disallowed content, the names of that content are returned instead
+func (s *scanResult) threatNames() string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, virus := range s.FoundViruses {
+		if virus.VirusName != "" && !seen[virus.VirusName] {
+			seen[virus.VirusName] = true
+			names = append(names, virus.VirusName)
+		}
+	}
+	if len(names) > 0 {
+		return strings.Join(names, ", ")
+	}
+	contents := []struct {
+		found bool
+		name  string
+	}{
+		{s.ContainsExecutable, "executable"},
+		{s.ContainsScript, "script"},
+		{s.ContainsPasswordProtectedFile, "password protected file"},
+		{s.ContainsMacros, "macros"},
+		{s.ContainsInvalidFile, "invalid file"},
+	}
+	for _, content := range contents {
+		if content.found {
+			names = append(names, content.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// sendFileToScan posts the file to the advanced virus scan endpoint with the advanced scan options
+func (c *Cloudmersive) sendFileToScan(file []byte, fileName string) (bool, string, error) {
+	if fileName == "" {
+		fileName = "file"
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("inputFile", fileName)
+	if err != nil {
+		return false, "", err
+	}
+	if _, err = part.Write(file); err != nil {
+		return false, "", err
+	}
+	if err = writer.Close(); err != nil {
+		return false, "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.BaseUrl, "/")+scanEndpoint, &body)
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Apikey", c.ApiKey)
+	req.Header.Set("allowExecutables", strconv.FormatBool(c.AllowExecutables))
+	req.Header.Set("allowScripts", strconv.FormatBool(c.AllowScripts))
+	req.Header.Set("allowPasswordProtectedFiles", strconv.FormatBool(c.AllowPasswordProtected))
+	req.Header.Set("allowMacros", strconv.FormatBool(c.AllowMacros))
+	req.Header.Set("allowInvalidFiles", strconv.FormatBool(c.AllowInvalidFiles))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, "", errors.New("Cloudmersive responded with status code " + strconv.Itoa(resp.StatusCode))
+	}
+	result := &scanResult{}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return false, "", err
+	}
+	if result.CleanResult {
+		return false, "", nil
+	}
+	return true, result.threatNames(), nil
+}
+
+func (c *Cloudmersive) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
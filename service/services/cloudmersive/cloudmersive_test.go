@@ -0,0 +1,73 @@
+package cloudmersive
+
+import (
+	"icapeg/logging"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSendFileToScan(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != scanEndpoint || r.Header.Get("Apikey") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("allowExecutables") != "false" || r.Header.Get("allowScripts") != "true" {
+			t.Errorf("unexpected advanced scan options %v", r.Header)
+		}
+		file, _, err := r.FormFile("inputFile")
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		switch string(content) {
+		case "eicar":
+			io.WriteString(w, `{"CleanResult":false,"FoundViruses":[{"FileName":"a","VirusName":"Eicar"},
+				{"FileName":"b","VirusName":"Eicar"},{"FileName":"c","VirusName":"Trojan"}]}`)
+		case "exe":
+			io.WriteString(w, `{"CleanResult":false,"ContainsExecutable":true,"FoundViruses":null}`)
+		default:
+			io.WriteString(w, `{"CleanResult":true,"FoundViruses":null}`)
+		}
+	}))
+	defer server.Close()
+	c := &Cloudmersive{
+		BaseUrl:           server.URL,
+		ApiKey:            "secret",
+		AllowScripts:      true,
+		AllowInvalidFiles: true,
+		Timeout:           time.Second,
+		generalFunc:       general_functions.NewGeneralFunc(nil, ""),
+		client:            &http.Client{},
+	}
+
+	tests := []struct {
+		body       string
+		isMal      bool
+		threatName string
+	}{
+		{"eicar", true, "Eicar, Trojan"},
+		{"exe", true, "executable"},
+		{"clean", false, ""},
+	}
+	for _, test := range tests {
+		isMal, threatName, err := c.sendFileToScan([]byte(test.body), "")
+		if err != nil || isMal != test.isMal || threatName != test.threatName {
+			t.Errorf("%s: expected %v %q, got %v %q %v", test.body, test.isMal, test.threatName, isMal, threatName, err)
+		}
+	}
+
+	c.ApiKey = "wrong"
+	if _, _, err := c.sendFileToScan([]byte("clean"), ""); err == nil {
+		t.Error("expected an error when Cloudmersive rejects the API key")
+	}
+}
@@ -0,0 +1,136 @@
+package cloudmersive
+
+import (
+	"crypto/tls"
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	services_utilities "icapeg/service/services-utilities"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/http"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// the cloudmersive constants
+const (
+	CloudmersiveIdentifier = "CLOUDMERSIVE ID"
+	defaultBaseUrl         = "https://api.cloudmersive.com"
+	scanEndpoint           = "/virus/scan/file/advanced"
+)
+
+var doOnce sync.Once
+var cloudmersiveConfig *Cloudmersive
+
+// Cloudmersive represents the information regarding the Cloudmersive service
+type Cloudmersive struct {
+	xICAPMetadata              string
+	httpMsg                    *http_message.HttpMsg
+	serviceName                string
+	methodName                 string
+	maxFileSize                int
+	bypassExts                 []string
+	processExts                []string
+	rejectExts                 []string
+	warnExts                   []string
+	extArrs                    []services_utilities.Extension
+	BaseUrl                    string
+	ApiKey                     string
+	AllowExecutables           bool
+	AllowScripts               bool
+	AllowPasswordProtected     bool
+	AllowMacros                bool
+	AllowInvalidFiles          bool
+	Timeout                    time.Duration
+	returnOrigIfMaxSizeExc     bool
+	return400IfFileExtRejected bool
+	generalFunc                *general_functions.GeneralFunc
+	BypassOnApiError           bool
+	verifyServerCert           bool
+	client                     *http.Client
+	CaseBlockHttpResponseCode  int
+	CaseBlockHttpBody          bool
+	ExceptionPage              string
+	IcapHeaders                textproto.MIMEHeader
+}
+
+// readAllowOption reads an optional advanced scan option, the content is allowed if the option isn't set
+// to keep the behaviour of a plain virus scan
+func readAllowOption(varName string) bool {
+	if readValues.IsSecExists(varName) {
+		return readValues.ReadValuesBool(varName)
+	}
+	return true
+}
+
+func InitCloudmersiveConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		cloudmersiveConfig = &Cloudmersive{
+			maxFileSize:                readValues.ReadValuesInt(serviceName + ".max_filesize"),
+			bypassExts:                 readValues.ReadValuesSlice(serviceName + ".bypass_extensions"),
+			processExts:                readValues.ReadValuesSlice(serviceName + ".process_extensions"),
+			rejectExts:                 readValues.ReadValuesSlice(serviceName + ".reject_extensions"),
+			BaseUrl:                    defaultBaseUrl,
+			ApiKey:                     readValues.ReadValuesString(serviceName + ".api_key"),
+			AllowExecutables:           readAllowOption(serviceName + ".allow_executables"),
+			AllowScripts:               readAllowOption(serviceName + ".allow_scripts"),
+			AllowPasswordProtected:     readAllowOption(serviceName + ".allow_password_protected_files"),
+			AllowMacros:                readAllowOption(serviceName + ".allow_macros"),
+			AllowInvalidFiles:          readAllowOption(serviceName + ".allow_invalid_files"),
+			Timeout:                    readValues.ReadValuesDuration(serviceName+".timeout") * time.Second,
+			returnOrigIfMaxSizeExc:     readValues.ReadValuesBool(serviceName + ".return_original_if_max_file_size_exceeded"),
+			return400IfFileExtRejected: readValues.ReadValuesBool(serviceName + ".return_400_if_file_ext_rejected"),
+			BypassOnApiError:           readValues.ReadValuesBool(serviceName + ".bypass_on_api_error"),
+			verifyServerCert:           readValues.ReadValuesBool(serviceName + ".verify_server_cert"),
+			CaseBlockHttpResponseCode:  readValues.ReadValuesInt(serviceName + ".http_exception_response_code"),
+			CaseBlockHttpBody:          readValues.ReadValuesBool(serviceName + ".http_exception_has_body"),
+			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
+		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			cloudmersiveConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		if readValues.IsSecExists(serviceName + ".base_url") {
+			cloudmersiveConfig.BaseUrl = readValues.ReadValuesString(serviceName + ".base_url")
+		}
+		//the client is shared by the requests of the service to reuse its connections
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: !cloudmersiveConfig.verifyServerCert}
+		cloudmersiveConfig.client = &http.Client{Transport: transport}
+		cloudmersiveConfig.extArrs = services_utilities.InitExtsArr(cloudmersiveConfig.processExts, cloudmersiveConfig.rejectExts, cloudmersiveConfig.bypassExts)
+	})
+}
+
+// NewCloudmersiveService returns a new populated instance of the cloudmersive service
+func NewCloudmersiveService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Cloudmersive {
+	return &Cloudmersive{
+		xICAPMetadata:              xICAPMetadata,
+		httpMsg:                    httpMsg,
+		serviceName:                serviceName,
+		methodName:                 methodName,
+		maxFileSize:                cloudmersiveConfig.maxFileSize,
+		bypassExts:                 cloudmersiveConfig.bypassExts,
+		processExts:                cloudmersiveConfig.processExts,
+		rejectExts:                 cloudmersiveConfig.rejectExts,
+		warnExts:                   cloudmersiveConfig.warnExts,
+		extArrs:                    cloudmersiveConfig.extArrs,
+		BaseUrl:                    cloudmersiveConfig.BaseUrl,
+		ApiKey:                     cloudmersiveConfig.ApiKey,
+		AllowExecutables:           cloudmersiveConfig.AllowExecutables,
+		AllowScripts:               cloudmersiveConfig.AllowScripts,
+		AllowPasswordProtected:     cloudmersiveConfig.AllowPasswordProtected,
+		AllowMacros:                cloudmersiveConfig.AllowMacros,
+		AllowInvalidFiles:          cloudmersiveConfig.AllowInvalidFiles,
+		Timeout:                    cloudmersiveConfig.Timeout,
+		returnOrigIfMaxSizeExc:     cloudmersiveConfig.returnOrigIfMaxSizeExc,
+		return400IfFileExtRejected: cloudmersiveConfig.return400IfFileExtRejected,
+		generalFunc:                general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+		BypassOnApiError:           cloudmersiveConfig.BypassOnApiError,
+		verifyServerCert:           cloudmersiveConfig.verifyServerCert,
+		client:                     cloudmersiveConfig.client,
+		CaseBlockHttpResponseCode:  cloudmersiveConfig.CaseBlockHttpResponseCode,
+		CaseBlockHttpBody:          cloudmersiveConfig.CaseBlockHttpBody,
+		ExceptionPage:              cloudmersiveConfig.ExceptionPage,
+	}
+}
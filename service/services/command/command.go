@@ -0,0 +1,380 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (c *Command) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = c.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	c.IcapHeaders = IcapHeader
+	c.IcapHeaders.Add("X-ICAP-Metadata", c.xICAPMetadata)
+	// no need to scan part of the file, this service needs all the file at ine time
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata,
+			c.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	if c.methodName == utils.ICAPModeResp {
+		if c.httpMsg.Response != nil {
+			if c.httpMsg.Response.StatusCode == 206 {
+				logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing byte range received"))
+				return utils.NoModificationStatusCodeStr, c.httpMsg, serviceHeaders,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+		}
+	}
+	isGzip := false
+	ExceptionPagePath := utils.BlockPagePath
+
+	if c.ExceptionPage != "" {
+		ExceptionPagePath = c.ExceptionPage
+	}
+	//extracting the file from http message
+
+	file, reqContentType, err := c.generalFunc.CopyingFileToTheBuffer(c.methodName)
+
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//if the http method is Connect, return the request as it is because it has no body
+	if c.methodName == utils.ICAPModeReq {
+		if c.httpMsg.Request.Method == http.MethodConnect {
+			return utils.OkStatusCodeStr, c.generalFunc.ReturningHttpMessageWithFile(c.methodName, file.Bytes()),
+				serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//getting the extension of the file
+	var contentType []string
+
+	var fileName string
+	if c.methodName == utils.ICAPModeReq {
+		contentType = c.httpMsg.Request.Header["Content-Type"]
+		fileName = c.generalFunc.GetFileName()
+	} else {
+		contentType = c.httpMsg.Response.Header["Content-Type"]
+		fileName = c.generalFunc.GetFileName()
+	}
+	if len(contentType) == 0 {
+		contentType = append(contentType, "")
+	}
+
+	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" file name : "+fileName))
+
+	fileExtension := c.generalFunc.GetMimeExtension(file.Bytes(), contentType[0], fileName)
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+
+	hash := sha256.New()
+	f := file
+	_, err = hash.Write(f.Bytes())
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
+	}
+	fileSize := fmt.Sprintf("%v", file.Len())
+	fileHash := hex.EncodeToString(hash.Sum([]byte(nil)))
+	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" file hash : "+fileHash))
+	logging.Audit(c.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := c.generalFunc.CheckTheWarnPolicy(c.generalFunc.IsWarnExtension(fileExtension, c.warnExts),
+		c.IcapHeaders.Get(utils.ClientIPHeader), c.serviceName, c.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+	isProcess, icapStatus, httpMsg = c.generalFunc.CheckTheExtension(fileExtension, c.extArrs,
+		c.processExts, c.rejectExts, c.bypassExts, c.return400IfFileExtRejected, isGzip,
+		c.serviceName, c.methodName, fileHash, c.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	//check if the file size is greater than max file size of the service
+	//if yes we will return 200 ok or 204 no modification, it depends on the configuration of the service
+	if c.maxFileSize != 0 && c.maxFileSize < file.Len() {
+		status, file, httpMsg := c.generalFunc.IfMaxFileSizeExc(c.returnOrigIfMaxSizeExc, c.serviceName, c.methodName, file, c.maxFileSize, ExceptionPagePath, fileSize)
+		fileAfterPrep, httpMsg := c.generalFunc.IfStatusIs204WithFile(c.methodName, status, file, isGzip, reqContentType, httpMsg, true)
+		if fileAfterPrep == nil && httpMsg == nil {
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return status, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = c.generalFunc.CheckTheContentPolicy(c.serviceName, c.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	scannedFile := file.Bytes()
+	scanStart := time.Now()
+	isMal, threatName, err := c.sendFileToScan(file.Bytes(), fileHash, fileName)
+	logging.Audit(c.xICAPMetadata).StageDone("scan", scanStart)
+	if err != nil && !c.BypassOnApiError {
+		logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
+		if strings.Contains(err.Error(), "context deadline exceeded") {
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			return utils.RequestTimeOutStatusCodeStr, nil, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		// its suppose to be InternalServerErrStatusCodeStr but need to be handled
+		logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+		return utils.BadRequestStatusCodeStr, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	if err != nil {
+		logging.Logger.Warn(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error is bypassed: "+err.Error()))
+	}
+
+	if isMal {
+		logging.Audit(c.xICAPMetadata).SetVerdict(logging.VerdictMalicious, threatName)
+		if threatName != "" {
+			serviceHeaders["X-Virus-ID"] = threatName
+		}
+		logging.Logger.Debug(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+": file is not safe"))
+		c.generalFunc.QuarantineFile(scannedFile, c.serviceName, threatName, c.IcapHeaders.Get(utils.ClientIPHeader))
+		if c.methodName == utils.ICAPModeResp {
+
+			errPage, contentType := c.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, c.serviceName, fileHash, c.httpMsg.Request.RequestURI, fileSize, c.xICAPMetadata)
+
+			c.httpMsg.Response = c.generalFunc.ErrPageResp(c.CaseBlockHttpResponseCode, errPage.Len(), contentType)
+			if c.CaseBlockHttpBody {
+				c.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+			} else {
+				var body []byte
+				c.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(body))
+				delete(c.httpMsg.Response.Header, "Content-Type")
+				delete(c.httpMsg.Response.Header, "Content-Length")
+			}
+			logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+			return utils.OkStatusCodeStr, c.httpMsg.Response, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		} else {
+			htmlPage, req, err := c.generalFunc.ReqModErrPage(utils.ErrPageReasonFileIsNotSafe, c.serviceName, fileHash, fileSize)
+			if err != nil {
+				logging.Logger.Error(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" error: "+err.Error()))
+
+				return utils.InternalServerErrStatusCodeStr, nil, nil,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+			req.Body = io.NopCloser(htmlPage)
+			msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+			return utils.OkStatusCodeStr, req, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//the file is allowed without being scanned if the scanner error is bypassed
+	if err != nil {
+		logging.Audit(c.xICAPMetadata).SetVerdict(logging.VerdictUnscanned, "")
+	} else {
+		logging.Audit(c.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	}
+	//returning the scanned file if everything is ok
+	logging.Logger.Info(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = c.generalFunc.LogHTTPMsgHeaders(c.methodName)
+	scannedFile = c.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, c.methodName)
+
+	return utils.NoModificationStatusCodeStr, c.generalFunc.ReturningHttpMessageWithFile(c.methodName, scannedFile),
+		serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// templateData is the data of the templates of the command arguments
+type templateData struct {
+	Path     string
+	FileName string
+	SHA256   string
+}
+
+// safeExtension matches the extensions which are kept in the name of the temp file,
+// some scanners decide how to scan the file by its extension
+var safeExtension = regexp.MustCompile(`^\.[A-Za-z0-9]{1,10}$`)
+
+// maxErrOutput is the max length of the stderr of the command which is added to its error
+const maxErrOutput = 256
+
+// sendFileToScan writes the file to a private temp file and runs the command on it, the number
+// of the commands which run at the same time is capped by max_concurrent
+func (c *Command) sendFileToScan(file []byte, fileHash, fileName string) (bool, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+			defer func() { <-c.slots }()
+		case <-ctx.Done():
+			return false, "", ctx.Err()
+		}
+	}
+
+	// the temp dir is only accessible by ICAPeg and the command
+	dir, err := os.MkdirTemp(c.TempDir, "icapeg-command-")
+	if err != nil {
+		return false, "", err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	if ext := filepath.Ext(fileName); safeExtension.MatchString(ext) {
+		path += ext
+	}
+	if err = os.WriteFile(path, file, 0600); err != nil {
+		return false, "", err
+	}
+
+	data := templateData{Path: path, FileName: fileName, SHA256: fileHash}
+	args := make([]string, len(c.CommandLine))
+	for i, arg := range c.CommandLine {
+		tmpl, err := template.New("arg").Parse(arg)
+		if err != nil {
+			return false, "", err
+		}
+		var value strings.Builder
+		if err = tmpl.Execute(&value, data); err != nil {
+			return false, "", err
+		}
+		args[i] = value.String()
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = c.WorkDir
+	cmd.Env = c.Env
+	// the output is written to files instead of pipes, so the command isn't waited for after the timeout
+	// if it leaves child processes which still have the output open
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		return false, "", err
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		return false, "", err
+	}
+	defer stderr.Close()
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return false, "", ctx.Err()
+	}
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return false, "", err
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	logging.Logger.Debug(utils.PrepareLogMsg(c.xICAPMetadata, c.serviceName+" command exit code : "+strconv.Itoa(exitCode)))
+
+	output, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		return false, "", err
+	}
+	isMal, threatName, known := c.verdict(exitCode, string(output))
+	if !known {
+		errOutput, _ := os.ReadFile(stderr.Name())
+		errOutput = bytes.TrimSpace(errOutput)
+		if len(errOutput) > maxErrOutput {
+			errOutput = errOutput[:maxErrOutput]
+		}
+		return false, "", errors.New("the command exited with the unknown exit code " + strconv.Itoa(exitCode) + ": " + string(errOutput))
+	}
+	return isMal, threatName, nil
+}
+
+// verdict maps the output and the exit code of the command to a verdict, the regexes are checked
+// before the exit codes, known is false if neither of them decided the verdict
+func (c *Command) verdict(exitCode int, output string) (isMal bool, threatName string, known bool) {
+	if c.InfectedRegex != nil {
+		if match := c.InfectedRegex.FindStringSubmatch(output); match != nil {
+			if i := c.InfectedRegex.SubexpIndex("threat"); i > 0 {
+				threatName = match[i]
+			} else if len(match) > 1 {
+				threatName = match[1]
+			}
+			return true, strings.TrimSpace(threatName), true
+		}
+	}
+	if c.CleanRegex != nil && c.CleanRegex.MatchString(output) {
+		return false, "", true
+	}
+	for _, code := range c.InfectedExitCodes {
+		if code == exitCode {
+			return true, "", true
+		}
+	}
+	for _, code := range c.CleanExitCodes {
+		if code == exitCode {
+			return false, "", true
+		}
+	}
+	return false, "", false
+}
+
+func (c *Command) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
@@ -0,0 +1,79 @@
+package command
+
+import (
+	"icapeg/logging"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testScript prints the file path and the working directory, and detects "EICAR" in the file
+const testScript = `pwd; echo "$FOO"; if grep -q EICAR "$1"; then echo "FOUND: Eicar-Test"; exit 1; fi
+if grep -q BROKEN "$1"; then echo "cannot scan" >&2; exit 2; fi
+if grep -q SLOW "$1"; then sleep 5; fi`
+
+func testCommand(t *testing.T) *Command {
+	logging.Logger = zap.NewNop()
+	return &Command{
+		CommandLine:       []string{"/bin/sh", "-c", testScript, "sh", "{{.Path}}"},
+		CleanExitCodes:    []int{0},
+		InfectedExitCodes: []int{1},
+		InfectedRegex:     regexp.MustCompile(`FOUND: (?P<threat>\S+)`),
+		WorkDir:           t.TempDir(),
+		TempDir:           t.TempDir(),
+		Env:               []string{defaultPath, "FOO=bar"},
+		Timeout:           time.Second,
+		slots:             make(chan struct{}, 1),
+	}
+}
+
+func TestSendFileToScan(t *testing.T) {
+	c := testCommand(t)
+	tests := []struct {
+		body       string
+		isMal      bool
+		threatName string
+		hasErr     bool
+	}{
+		{"a clean file", false, "", false},
+		{"an EICAR file", true, "Eicar-Test", false},
+		{"a BROKEN file", false, "", true},
+	}
+	for _, test := range tests {
+		isMal, threatName, err := c.sendFileToScan([]byte(test.body), "", "file.txt")
+		if isMal != test.isMal || threatName != test.threatName || (err != nil) != test.hasErr {
+			t.Errorf("%s: expected %v %q %v, got %v %q %v", test.body, test.isMal, test.threatName, test.hasErr,
+				isMal, threatName, err)
+		}
+	}
+	if entries, _ := os.ReadDir(c.TempDir); len(entries) != 0 {
+		t.Errorf("expected the temp files to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestSendFileToScanTimeout(t *testing.T) {
+	c := testCommand(t)
+	c.Timeout = 100 * time.Millisecond
+	_, _, err := c.sendFileToScan([]byte("a SLOW file"), "", "")
+	if err == nil || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestVerdict(t *testing.T) {
+	c := testCommand(t)
+	c.CleanRegex = regexp.MustCompile(`OK$`)
+	if isMal, _, known := c.verdict(1, "file: OK"); isMal || !known {
+		t.Error("expected the clean regex to be checked before the exit codes")
+	}
+	if isMal, threatName, known := c.verdict(0, "FOUND: Trojan"); !isMal || threatName != "Trojan" || !known {
+		t.Errorf("expected the infected regex to decide the verdict, got %v %q %v", isMal, threatName, known)
+	}
+	if _, _, known := c.verdict(3, ""); known {
+		t.Error("expected an unknown exit code to be an error")
+	}
+}
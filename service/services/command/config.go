@@ -0,0 +1,182 @@
+package command
+
+import (
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	services_utilities "icapeg/service/services-utilities"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/textproto"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the command constants
+const (
+	// defaultPath is the PATH of the command if the env of the service doesn't set it
+	defaultPath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+var doOnce sync.Once
+var commandConfig *Command
+
+// Command represents the information regarding the external command scanner service
+type Command struct {
+	xICAPMetadata              string
+	httpMsg                    *http_message.HttpMsg
+	serviceName                string
+	methodName                 string
+	maxFileSize                int
+	bypassExts                 []string
+	processExts                []string
+	rejectExts                 []string
+	warnExts                   []string
+	extArrs                    []services_utilities.Extension
+	CommandLine                []string
+	CleanExitCodes             []int
+	InfectedExitCodes          []int
+	InfectedRegex              *regexp.Regexp
+	CleanRegex                 *regexp.Regexp
+	WorkDir                    string
+	TempDir                    string
+	Env                        []string
+	MaxConcurrent              int
+	slots                      chan struct{}
+	Timeout                    time.Duration
+	returnOrigIfMaxSizeExc     bool
+	return400IfFileExtRejected bool
+	generalFunc                *general_functions.GeneralFunc
+	BypassOnApiError           bool
+	CaseBlockHttpResponseCode  int
+	CaseBlockHttpBody          bool
+	ExceptionPage              string
+	IcapHeaders                textproto.MIMEHeader
+}
+
+// readExitCodes reads an optional list of exit codes, defaultCodes are returned if it isn't set
+func readExitCodes(varName string, defaultCodes []int) []int {
+	if !readValues.IsSecExists(varName) {
+		return defaultCodes
+	}
+	var codes []int
+	for _, value := range readValues.ReadValuesSlice(varName) {
+		code, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			logging.Logger.Fatal(varName + " should have integer exit codes: " + err.Error())
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// readRegex compiles an optional regex, it returns nil if it isn't set
+func readRegex(varName string) *regexp.Regexp {
+	if !readValues.IsSecExists(varName) {
+		return nil
+	}
+	expr := readValues.ReadValuesString(varName)
+	if expr == "" {
+		return nil
+	}
+	regex, err := regexp.Compile(expr)
+	if err != nil {
+		logging.Logger.Fatal(varName + " isn't a valid regex: " + err.Error())
+	}
+	return regex
+}
+
+func InitCommandConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		commandConfig = &Command{
+			maxFileSize:                readValues.ReadValuesInt(serviceName + ".max_filesize"),
+			bypassExts:                 readValues.ReadValuesSlice(serviceName + ".bypass_extensions"),
+			processExts:                readValues.ReadValuesSlice(serviceName + ".process_extensions"),
+			rejectExts:                 readValues.ReadValuesSlice(serviceName + ".reject_extensions"),
+			CommandLine:                readValues.ReadValuesSlice(serviceName + ".command"),
+			CleanExitCodes:             readExitCodes(serviceName+".clean_exit_codes", []int{0}),
+			InfectedExitCodes:          readExitCodes(serviceName+".infected_exit_codes", []int{1}),
+			InfectedRegex:              readRegex(serviceName + ".infected_regex"),
+			CleanRegex:                 readRegex(serviceName + ".clean_regex"),
+			WorkDir:                    os.TempDir(),
+			TempDir:                    os.TempDir(),
+			Env:                        []string{defaultPath},
+			MaxConcurrent:              runtime.NumCPU(),
+			Timeout:                    readValues.ReadValuesDuration(serviceName+".timeout") * time.Second,
+			returnOrigIfMaxSizeExc:     readValues.ReadValuesBool(serviceName + ".return_original_if_max_file_size_exceeded"),
+			return400IfFileExtRejected: readValues.ReadValuesBool(serviceName + ".return_400_if_file_ext_rejected"),
+			BypassOnApiError:           readValues.ReadValuesBool(serviceName + ".bypass_on_api_error"),
+			CaseBlockHttpResponseCode:  readValues.ReadValuesInt(serviceName + ".http_exception_response_code"),
+			CaseBlockHttpBody:          readValues.ReadValuesBool(serviceName + ".http_exception_has_body"),
+			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
+		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			commandConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		if readValues.IsSecExists(serviceName + ".work_dir") {
+			commandConfig.WorkDir = readValues.ReadValuesString(serviceName + ".work_dir")
+		}
+		if readValues.IsSecExists(serviceName + ".temp_dir") {
+			commandConfig.TempDir = readValues.ReadValuesString(serviceName + ".temp_dir")
+		}
+		if readValues.IsSecExists(serviceName + ".env") {
+			commandConfig.Env = readValues.ReadValuesSlice(serviceName + ".env")
+			hasPath := false
+			for _, variable := range commandConfig.Env {
+				hasPath = hasPath || strings.HasPrefix(variable, "PATH=")
+			}
+			if !hasPath {
+				commandConfig.Env = append(commandConfig.Env, defaultPath)
+			}
+		}
+		if readValues.IsSecExists(serviceName + ".max_concurrent") {
+			commandConfig.MaxConcurrent = readValues.ReadValuesInt(serviceName + ".max_concurrent")
+		}
+		if len(commandConfig.CommandLine) == 0 {
+			logging.Logger.Fatal(serviceName + ".command should have the command and its arguments")
+		}
+		if commandConfig.MaxConcurrent > 0 {
+			commandConfig.slots = make(chan struct{}, commandConfig.MaxConcurrent)
+		}
+		commandConfig.extArrs = services_utilities.InitExtsArr(commandConfig.processExts, commandConfig.rejectExts, commandConfig.bypassExts)
+	})
+}
+
+// NewCommandService returns a new populated instance of the command service
+func NewCommandService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Command {
+	return &Command{
+		xICAPMetadata:              xICAPMetadata,
+		httpMsg:                    httpMsg,
+		serviceName:                serviceName,
+		methodName:                 methodName,
+		maxFileSize:                commandConfig.maxFileSize,
+		bypassExts:                 commandConfig.bypassExts,
+		processExts:                commandConfig.processExts,
+		rejectExts:                 commandConfig.rejectExts,
+		warnExts:                   commandConfig.warnExts,
+		extArrs:                    commandConfig.extArrs,
+		CommandLine:                commandConfig.CommandLine,
+		CleanExitCodes:             commandConfig.CleanExitCodes,
+		InfectedExitCodes:          commandConfig.InfectedExitCodes,
+		InfectedRegex:              commandConfig.InfectedRegex,
+		CleanRegex:                 commandConfig.CleanRegex,
+		WorkDir:                    commandConfig.WorkDir,
+		TempDir:                    commandConfig.TempDir,
+		Env:                        commandConfig.Env,
+		MaxConcurrent:              commandConfig.MaxConcurrent,
+		slots:                      commandConfig.slots,
+		Timeout:                    commandConfig.Timeout,
+		returnOrigIfMaxSizeExc:     commandConfig.returnOrigIfMaxSizeExc,
+		return400IfFileExtRejected: commandConfig.return400IfFileExtRejected,
+		generalFunc:                general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+		BypassOnApiError:           commandConfig.BypassOnApiError,
+		CaseBlockHttpResponseCode:  commandConfig.CaseBlockHttpResponseCode,
+		CaseBlockHttpBody:          commandConfig.CaseBlockHttpBody,
+		ExceptionPage:              commandConfig.ExceptionPage,
+	}
+}
@@ -26,6 +26,7 @@ type Echo struct {
 	bypassExts                 []string
 	processExts                []string
 	rejectExts                 []string
+	warnExts                   []string
 	extArrs                    []services_utilities.Extension
 	returnOrigIfMaxSizeExc     bool
 	return400IfFileExtRejected bool
@@ -43,6 +44,9 @@ func InitEchoConfig(serviceName string) {
 			returnOrigIfMaxSizeExc:     readValues.ReadValuesBool(serviceName + ".return_original_if_max_file_size_exceeded"),
 			return400IfFileExtRejected: readValues.ReadValuesBool(serviceName + ".return_400_if_file_ext_rejected"),
 		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			echoConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
 		echoConfig.extArrs = services_utilities.InitExtsArr(echoConfig.processExts, echoConfig.rejectExts, echoConfig.bypassExts)
 	})
 }
@@ -59,6 +63,7 @@ func NewEchoService(serviceName, methodName string, httpMsg *http_message.HttpMs
 		bypassExts:                 echoConfig.bypassExts,
 		processExts:                echoConfig.processExts,
 		rejectExts:                 echoConfig.rejectExts,
+		warnExts:                   echoConfig.warnExts,
 		extArrs:                    echoConfig.extArrs,
 		returnOrigIfMaxSizeExc:     echoConfig.returnOrigIfMaxSizeExc,
 		return400IfFileExtRejected: echoConfig.return400IfFileExtRejected,
@@ -63,10 +63,22 @@ func (e *Echo) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, i
 	}
 	fileExtension := e.generalFunc.GetMimeExtension(file.Bytes(), contentType[0], fileName)
 	fileSize := fmt.Sprintf("%v kb", file.Len()/1000)
+	logging.Audit(e.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), "")
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := e.generalFunc.CheckTheWarnPolicy(e.generalFunc.IsWarnExtension(fileExtension, e.warnExts),
+		IcapHeader.Get(utils.ClientIPHeader), e.serviceName, e.methodName, EchoIdentifier, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(e.xICAPMetadata, e.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = e.generalFunc.LogHTTPMsgHeaders(e.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
 
 	//check if the file extension is a bypass extension
 	//if yes we will not modify the file, and we will return 204 No modifications
-	isProcess, icapStatus, httpMsg := e.generalFunc.CheckTheExtension(fileExtension, e.extArrs,
+	isProcess, icapStatus, httpMsg = e.generalFunc.CheckTheExtension(fileExtension, e.extArrs,
 		e.processExts, e.rejectExts, e.bypassExts, e.return400IfFileExtRejected, isGzip,
 		e.serviceName, e.methodName, EchoIdentifier, e.httpMsg.Request.RequestURI, reqContentType, file, utils.BlockPagePath, fileSize)
 	if !isProcess {
@@ -103,7 +115,19 @@ func (e *Echo) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, i
 		return status, nil, nil, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
 	}
 
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = e.generalFunc.CheckTheContentPolicy(e.serviceName, e.methodName,
+		EchoIdentifier, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(e.xICAPMetadata, e.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = e.generalFunc.LogHTTPMsgHeaders(e.methodName)
+		return icapStatus, httpMsg, serviceHeaders, msgHeadersBeforeProcessing,
+			msgHeadersAfterProcessing, vendorMsgs
+	}
+
 	scannedFile := file.Bytes()
+	logging.Audit(e.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
 
 	//returning the scanned file if everything is ok
 	scannedFile = e.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, e.methodName)
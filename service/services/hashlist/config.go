@@ -0,0 +1,112 @@
+package hashlist
+
+import (
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	services_utilities "icapeg/service/services-utilities"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// the hashlist constants
+const (
+	HashlistIdentifier = "HASHLIST ID"
+	// defaultReloadInterval is how often the files of the lists are checked for changes
+	defaultReloadInterval = time.Minute
+)
+
+var doOnce sync.Once
+var hashlistConfig *Hashlist
+
+// Hashlist represents the information regarding the local hash lists service
+type Hashlist struct {
+	xICAPMetadata              string
+	httpMsg                    *http_message.HttpMsg
+	serviceName                string
+	methodName                 string
+	maxFileSize                int
+	bypassExts                 []string
+	processExts                []string
+	rejectExts                 []string
+	warnExts                   []string
+	extArrs                    []services_utilities.Extension
+	Blocklist                  *HashList
+	Allowlist                  *HashList
+	ReloadInterval             time.Duration
+	returnOrigIfMaxSizeExc     bool
+	return400IfFileExtRejected bool
+	generalFunc                *general_functions.GeneralFunc
+	CaseBlockHttpResponseCode  int
+	CaseBlockHttpBody          bool
+	ExceptionPage              string
+	IcapHeaders                textproto.MIMEHeader
+}
+
+func InitHashlistConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		hashlistConfig = &Hashlist{
+			maxFileSize:                readValues.ReadValuesInt(serviceName + ".max_filesize"),
+			bypassExts:                 readValues.ReadValuesSlice(serviceName + ".bypass_extensions"),
+			processExts:                readValues.ReadValuesSlice(serviceName + ".process_extensions"),
+			rejectExts:                 readValues.ReadValuesSlice(serviceName + ".reject_extensions"),
+			ReloadInterval:             defaultReloadInterval,
+			returnOrigIfMaxSizeExc:     readValues.ReadValuesBool(serviceName + ".return_original_if_max_file_size_exceeded"),
+			return400IfFileExtRejected: readValues.ReadValuesBool(serviceName + ".return_400_if_file_ext_rejected"),
+			CaseBlockHttpResponseCode:  readValues.ReadValuesInt(serviceName + ".http_exception_response_code"),
+			CaseBlockHttpBody:          readValues.ReadValuesBool(serviceName + ".http_exception_has_body"),
+			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
+		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			hashlistConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		if readValues.IsSecExists(serviceName + ".reload_interval") {
+			hashlistConfig.ReloadInterval = readValues.ReadValuesDuration(serviceName+".reload_interval") * time.Second
+		}
+		var blocklistFiles, allowlistFiles []string
+		if readValues.IsSecExists(serviceName + ".blocklist_files") {
+			blocklistFiles = readValues.ReadValuesSlice(serviceName + ".blocklist_files")
+		}
+		if readValues.IsSecExists(serviceName + ".allowlist_files") {
+			allowlistFiles = readValues.ReadValuesSlice(serviceName + ".allowlist_files")
+		}
+		if len(blocklistFiles) == 0 && len(allowlistFiles) == 0 {
+			logging.Logger.Fatal(serviceName + " should have blocklist_files or allowlist_files")
+		}
+		hashlistConfig.Blocklist = NewHashList(Blocklist, blocklistFiles)
+		hashlistConfig.Allowlist = NewHashList(Allowlist, allowlistFiles)
+		if hashlistConfig.ReloadInterval > 0 {
+			go hashlistConfig.Blocklist.watch(hashlistConfig.ReloadInterval)
+			go hashlistConfig.Allowlist.watch(hashlistConfig.ReloadInterval)
+		}
+		hashlistConfig.extArrs = services_utilities.InitExtsArr(hashlistConfig.processExts, hashlistConfig.rejectExts, hashlistConfig.bypassExts)
+	})
+}
+
+// NewHashlistService returns a new populated instance of the hashlist service
+func NewHashlistService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Hashlist {
+	return &Hashlist{
+		xICAPMetadata:              xICAPMetadata,
+		httpMsg:                    httpMsg,
+		serviceName:                serviceName,
+		methodName:                 methodName,
+		maxFileSize:                hashlistConfig.maxFileSize,
+		bypassExts:                 hashlistConfig.bypassExts,
+		processExts:                hashlistConfig.processExts,
+		rejectExts:                 hashlistConfig.rejectExts,
+		warnExts:                   hashlistConfig.warnExts,
+		extArrs:                    hashlistConfig.extArrs,
+		Blocklist:                  hashlistConfig.Blocklist,
+		Allowlist:                  hashlistConfig.Allowlist,
+		ReloadInterval:             hashlistConfig.ReloadInterval,
+		returnOrigIfMaxSizeExc:     hashlistConfig.returnOrigIfMaxSizeExc,
+		return400IfFileExtRejected: hashlistConfig.return400IfFileExtRejected,
+		generalFunc:                general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+		CaseBlockHttpResponseCode:  hashlistConfig.CaseBlockHttpResponseCode,
+		CaseBlockHttpBody:          hashlistConfig.CaseBlockHttpBody,
+		ExceptionPage:              hashlistConfig.ExceptionPage,
+	}
+}
@@ -0,0 +1,231 @@
+package hashlist
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (h *Hashlist) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = h.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	h.IcapHeaders = IcapHeader
+	h.IcapHeaders.Add("X-ICAP-Metadata", h.xICAPMetadata)
+	// no need to scan part of the file, this service needs all the file at ine time
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata,
+			h.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	if h.methodName == utils.ICAPModeResp {
+		if h.httpMsg.Response != nil {
+			if h.httpMsg.Response.StatusCode == 206 {
+				logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing byte range received"))
+				return utils.NoModificationStatusCodeStr, h.httpMsg, serviceHeaders,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+		}
+	}
+	isGzip := false
+	ExceptionPagePath := utils.BlockPagePath
+
+	if h.ExceptionPage != "" {
+		ExceptionPagePath = h.ExceptionPage
+	}
+	//extracting the file from http message
+
+	file, reqContentType, err := h.generalFunc.CopyingFileToTheBuffer(h.methodName)
+
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//if the http method is Connect, return the request as it is because it has no body
+	if h.methodName == utils.ICAPModeReq {
+		if h.httpMsg.Request.Method == http.MethodConnect {
+			return utils.OkStatusCodeStr, h.generalFunc.ReturningHttpMessageWithFile(h.methodName, file.Bytes()),
+				serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//getting the extension of the file
+	var contentType []string
+
+	var fileName string
+	if h.methodName == utils.ICAPModeReq {
+		contentType = h.httpMsg.Request.Header["Content-Type"]
+		fileName = h.generalFunc.GetFileName()
+	} else {
+		contentType = h.httpMsg.Response.Header["Content-Type"]
+		fileName = h.generalFunc.GetFileName()
+	}
+	if len(contentType) == 0 {
+		contentType = append(contentType, "")
+	}
+
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" file name : "+fileName))
+
+	fileExtension := h.generalFunc.GetMimeExtension(file.Bytes(), contentType[0], fileName)
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+
+	sha256Sum := sha256.Sum256(file.Bytes())
+	sha1Sum := sha1.Sum(file.Bytes())
+	md5Sum := md5.Sum(file.Bytes())
+	fileSize := fmt.Sprintf("%v", file.Len())
+	fileHash := hex.EncodeToString(sha256Sum[:])
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" file hash : "+fileHash))
+	logging.Audit(h.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+	hashes := []string{fileHash, hex.EncodeToString(sha1Sum[:]), hex.EncodeToString(md5Sum[:])}
+
+	//check if the file is on the allowlist
+	//if yes we will return 204 No modifications without applying the other policies
+	if listFile, listed := h.Allowlist.Lookup(hashes...); listed {
+		serviceHeaders["X-ICAPeg-Hashlist"] = Allowlist + " (" + listFile + ")"
+		logging.Logger.Debug(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+": file is on the allowlist "+listFile))
+		logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictAllowed, "")
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+		fileAfterPrep := h.generalFunc.PreparingFileAfterScanning(file.Bytes(), reqContentType, h.methodName)
+		return utils.NoModificationStatusCodeStr, h.generalFunc.ReturningHttpMessageWithFile(h.methodName, fileAfterPrep),
+			serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file is on the blocklist
+	//if yes we will return the block page without applying the other policies
+	scannedFile := file.Bytes()
+	if listFile, isMal := h.Blocklist.Lookup(hashes...); isMal {
+		threatName := "blocklisted hash (" + listFile + ")"
+		serviceHeaders["X-ICAPeg-Hashlist"] = Blocklist + " (" + listFile + ")"
+		logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictMalicious, threatName)
+		serviceHeaders["X-Virus-ID"] = threatName
+		logging.Logger.Debug(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+": file is on the blocklist "+listFile))
+		h.generalFunc.QuarantineFile(scannedFile, h.serviceName, threatName, h.IcapHeaders.Get(utils.ClientIPHeader))
+		if h.methodName == utils.ICAPModeResp {
+
+			errPage, contentType := h.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, h.serviceName, fileHash, h.httpMsg.Request.RequestURI, fileSize, h.xICAPMetadata)
+
+			h.httpMsg.Response = h.generalFunc.ErrPageResp(h.CaseBlockHttpResponseCode, errPage.Len(), contentType)
+			if h.CaseBlockHttpBody {
+				h.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+			} else {
+				var body []byte
+				h.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(body))
+				delete(h.httpMsg.Response.Header, "Content-Type")
+				delete(h.httpMsg.Response.Header, "Content-Length")
+			}
+			logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+			return utils.OkStatusCodeStr, h.httpMsg.Response, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		} else {
+			htmlPage, req, err := h.generalFunc.ReqModErrPage(utils.ErrPageReasonFileIsNotSafe, h.serviceName, fileHash, fileSize)
+			if err != nil {
+				logging.Logger.Error(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" error: "+err.Error()))
+
+				return utils.InternalServerErrStatusCodeStr, nil, nil,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+			req.Body = io.NopCloser(htmlPage)
+			msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+			return utils.OkStatusCodeStr, req, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := h.generalFunc.CheckTheWarnPolicy(h.generalFunc.IsWarnExtension(fileExtension, h.warnExts),
+		h.IcapHeaders.Get(utils.ClientIPHeader), h.serviceName, h.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+	isProcess, icapStatus, httpMsg = h.generalFunc.CheckTheExtension(fileExtension, h.extArrs,
+		h.processExts, h.rejectExts, h.bypassExts, h.return400IfFileExtRejected, isGzip,
+		h.serviceName, h.methodName, fileHash, h.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	//check if the file size is greater than max file size of the service
+	//if yes we will return 200 ok or 204 no modification, it depends on the configuration of the service
+	if h.maxFileSize != 0 && h.maxFileSize < file.Len() {
+		status, file, httpMsg := h.generalFunc.IfMaxFileSizeExc(h.returnOrigIfMaxSizeExc, h.serviceName, h.methodName, file, h.maxFileSize, ExceptionPagePath, fileSize)
+		fileAfterPrep, httpMsg := h.generalFunc.IfStatusIs204WithFile(h.methodName, status, file, isGzip, reqContentType, httpMsg, true)
+		if fileAfterPrep == nil && httpMsg == nil {
+			logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+			return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+			logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+		return status, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = h.generalFunc.CheckTheContentPolicy(h.serviceName, h.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	//returning the scanned file if everything is ok
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+	scannedFile = h.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, h.methodName)
+
+	return utils.NoModificationStatusCodeStr, h.generalFunc.ReturningHttpMessageWithFile(h.methodName, scannedFile),
+		serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+func (h *Hashlist) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
@@ -0,0 +1,190 @@
+package hashlist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"icapeg/logging"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the names of the lists
+const (
+	Blocklist = "blocklist"
+	Allowlist = "allowlist"
+)
+
+// jsonHashKeys are the keys of the hashes in the objects of the hashlookup JSON export
+var jsonHashKeys = []string{"SHA-256", "SHA-1", "MD5", "sha256", "sha1", "md5"}
+
+// HashList is a list of SHA-256, SHA-1 and MD5 hashes loaded from local files,
+// it maps every hash to the name of the file which has it
+type HashList struct {
+	Name       string
+	files      []string
+	mu         sync.RWMutex
+	hashes     map[string]string
+	fileHashes map[string]map[string]string
+	modTimes   map[string]time.Time
+}
+
+// NewHashList loads the hashes of the files, a file which can't be loaded is logged and skipped
+func NewHashList(name string, files []string) *HashList {
+	l := &HashList{Name: name, files: files}
+	l.reload()
+	return l
+}
+
+// Lookup returns the name of the file which has one of the hashes, the hashes are hex encoded
+func (l *HashList) Lookup(hashes ...string) (string, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, hash := range hashes {
+		if file, ok := l.hashes[strings.ToLower(hash)]; ok {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// Len returns the number of the hashes in the list
+func (l *HashList) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.hashes)
+}
+
+// changed checks whether a file of the list was modified, added or removed since it was loaded
+func (l *HashList) changed() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, file := range l.files {
+		info, err := os.Stat(file)
+		modTime, loaded := l.modTimes[file]
+		if (err == nil) != loaded || (err == nil && !info.ModTime().Equal(modTime)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads the files of the list again and replaces the hashes, a file which can't be loaded
+// (ex: it's being rewritten) keeps its previous hashes, so the list doesn't shrink silently
+func (l *HashList) reload() {
+	l.mu.RLock()
+	fileHashes := make(map[string]map[string]string)
+	modTimes := make(map[string]time.Time)
+	for file, hashes := range l.fileHashes {
+		fileHashes[file] = hashes
+	}
+	l.mu.RUnlock()
+	for _, file := range l.files {
+		info, err := os.Stat(file)
+		hashes := make(map[string]string)
+		if err == nil {
+			//a file which can't be parsed is loaded again only when it's modified again
+			modTimes[file] = info.ModTime()
+			err = loadFile(file, hashes)
+		}
+		if err != nil {
+			if _, ok := fileHashes[file]; ok {
+				logging.Logger.Error("the " + l.Name + " file " + file +
+					" couldn't be loaded, its previous hashes are kept: " + err.Error())
+			} else {
+				logging.Logger.Error("the " + l.Name + " file " + file + " couldn't be loaded: " + err.Error())
+			}
+			continue
+		}
+		fileHashes[file] = hashes
+	}
+	merged := make(map[string]string)
+	for _, file := range l.files {
+		for hash, name := range fileHashes[file] {
+			merged[hash] = name
+		}
+	}
+	l.mu.Lock()
+	l.hashes, l.fileHashes, l.modTimes = merged, fileHashes, modTimes
+	l.mu.Unlock()
+	logging.Logger.Info("the " + l.Name + " is loaded, hashes: " + strconv.Itoa(len(merged)))
+}
+
+// watch reloads the list whenever one of its files changes on disk
+func (l *HashList) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if l.changed() {
+			l.reload()
+		}
+	}
+}
+
+// loadFile adds the hashes of a file to the map, the format depends on the extension of the file:
+// .json is the hashlookup JSON export (an array or one object per line), the other files are plain text
+// or CSV where every field which is a hex SHA-256, SHA-1 or MD5 hash is added and # starts a comment
+func loadFile(file string, hashes map[string]string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(file)
+	if strings.EqualFold(filepath.Ext(file), ".json") {
+		return loadJSON(data, name, hashes)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == '\t' || r == ' ' || r == '"'
+		}) {
+			addHash(field, name, hashes)
+		}
+	}
+	return scanner.Err()
+}
+
+// loadJSON adds the hashes of the hashlookup JSON export
+func loadJSON(data []byte, name string, hashes map[string]string) error {
+	var objects []map[string]interface{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &objects); err != nil {
+			return err
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for decoder.More() {
+			var object map[string]interface{}
+			if err := decoder.Decode(&object); err != nil {
+				return err
+			}
+			objects = append(objects, object)
+		}
+	}
+	for _, object := range objects {
+		for _, key := range jsonHashKeys {
+			if hash, ok := object[key].(string); ok {
+				addHash(hash, name, hashes)
+			}
+		}
+	}
+	return nil
+}
+
+// addHash adds the value if it's a hex SHA-256, SHA-1 or MD5 hash
+func addHash(value, name string, hashes map[string]string) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch len(value) {
+	case hex.EncodedLen(32), hex.EncodedLen(20), hex.EncodedLen(16):
+		if _, err := hex.DecodeString(value); err == nil {
+			hashes[value] = name
+		}
+	}
+}
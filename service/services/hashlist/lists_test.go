@@ -0,0 +1,95 @@
+package hashlist
+
+import (
+	"icapeg/logging"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	testSHA256 = "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"
+	testSHA1   = "3395856ce81f2b7382dee72602f798b642f14140"
+	testMD5    = "44d88612fea8a8f36de82e1278abb02f"
+)
+
+func TestLoadFormats(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	dir := t.TempDir()
+	files := map[string]string{
+		"list.txt": "# known bad\n" + testSHA256 + "\nnot-a-hash\n",
+		"list.csv": "name,sha1\neicar.com," + testSHA1 + "\n",
+		"list.json": `[{"FileName":"eicar.com","MD5":"` + testMD5 + `",` +
+			`"parents":[{"SHA-1":"0000000000000000000000000000000000000000"}]}]`,
+	}
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0600)
+		paths = append(paths, path)
+	}
+	l := NewHashList(Blocklist, append(paths, filepath.Join(dir, "missing.txt")))
+
+	if l.Len() != 3 {
+		t.Errorf("expected 3 hashes, got %d", l.Len())
+	}
+	for hash, file := range map[string]string{testSHA256: "list.txt", testSHA1: "list.csv", testMD5: "list.json"} {
+		if got, ok := l.Lookup("unknown", hash); !ok || got != file {
+			t.Errorf("expected %s to be found in %s, got %q %v", hash, file, got, ok)
+		}
+	}
+	if _, ok := l.Lookup("0000000000000000000000000000000000000000"); ok {
+		t.Error("expected the hashes of the parents not to be loaded")
+	}
+}
+
+func TestReload(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	path := filepath.Join(t.TempDir(), "allow.txt")
+	os.WriteFile(path, []byte(testMD5+"\n"), 0600)
+	l := NewHashList(Allowlist, []string{path})
+	if l.changed() {
+		t.Error("expected the list not to be changed after loading it")
+	}
+
+	os.WriteFile(path, []byte(testSHA256+"\n"), 0600)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	if !l.changed() {
+		t.Fatal("expected the modified file to be detected")
+	}
+	l.reload()
+	if _, ok := l.Lookup(testMD5); ok {
+		t.Error("expected the removed hash not to be found after reloading")
+	}
+	if _, ok := l.Lookup(testSHA256); !ok {
+		t.Error("expected the added hash to be found after reloading")
+	}
+}
+
+func TestReloadKeepsTheHashesOfFailedFiles(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "block.json")
+	os.WriteFile(path, []byte(`[{"MD5":"`+testMD5+`"}]`), 0600)
+	l := NewHashList(Blocklist, []string{path})
+
+	os.WriteFile(path, []byte(`[{"MD5":"`), 0600)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	l.reload()
+	if _, ok := l.Lookup(testMD5); !ok {
+		t.Error("expected the previous hashes of the invalid file to be kept")
+	}
+	os.Remove(path)
+	l.reload()
+	if _, ok := l.Lookup(testMD5); !ok {
+		t.Error("expected the previous hashes of the missing file to be kept")
+	}
+	if l.changed() {
+		t.Error("expected the failed file not to be reloaded until it changes")
+	}
+}
@@ -0,0 +1,103 @@
+package headers
+
+import (
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/textproto"
+	"regexp"
+	"sync"
+)
+
+// the headers constants
+const (
+	HeadersIdentifier = "HEADERS ID"
+)
+
+var doOnce sync.Once
+var headersConfig *Headers
+
+// Headers represents the information regarding the header policy service,
+// the rules are applied on the headers of the HTTP message in their order
+type Headers struct {
+	xICAPMetadata string
+	httpMsg       *http_message.HttpMsg
+	serviceName   string
+	methodName    string
+	Rules         []*Rule
+	generalFunc   *general_functions.GeneralFunc
+	IcapHeaders   textproto.MIMEHeader
+}
+
+func InitHeadersConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		headersConfig = &Headers{}
+		for _, name := range readValues.ReadValuesSlice(serviceName + ".rules") {
+			headersConfig.Rules = append(headersConfig.Rules, readRule(serviceName, name))
+		}
+		if len(headersConfig.Rules) == 0 {
+			logging.Logger.Fatal(serviceName + " should have at least one rule")
+		}
+	})
+}
+
+// readRule reads the [<service>.<rule>] section of a rule
+func readRule(serviceName, name string) *Rule {
+	section := serviceName + "." + name + "."
+	r := &Rule{
+		Name:   name,
+		Action: readValues.ReadValuesString(section + "action"),
+		Header: readValues.ReadValuesString(section + "header"),
+	}
+	if r.Action != ActionSet && r.Action != ActionAppend && r.Action != ActionDelete && r.Action != ActionReplace {
+		logging.Logger.Fatal(section + "action should be " + ActionSet + ", " + ActionAppend + ", " +
+			ActionDelete + " or " + ActionReplace)
+	}
+	if r.Header == "" {
+		logging.Logger.Fatal(section + "header is required")
+	}
+	if readValues.IsSecExists(section + "value") {
+		r.Value = readValues.ReadValuesString(section + "value")
+	}
+	if readValues.IsSecExists(section + "pattern") {
+		r.Pattern = compileRegex(section+"pattern", readValues.ReadValuesString(section+"pattern"))
+	}
+	if r.Action == ActionReplace && r.Pattern == nil {
+		logging.Logger.Fatal(section + "pattern is required by the " + ActionReplace + " action")
+	}
+	if readValues.IsSecExists(section + "modes") {
+		r.Modes = readValues.ReadValuesSlice(section + "modes")
+	}
+	if readValues.IsSecExists(section + "hosts") {
+		r.Hosts = readValues.ReadValuesSlice(section + "hosts")
+	}
+	if readValues.IsSecExists(section + "path") {
+		r.Path = compileRegex(section+"path", readValues.ReadValuesString(section+"path"))
+	}
+	if readValues.IsSecExists(section + "content_types") {
+		r.ContentTypes = readValues.ReadValuesSlice(section + "content_types")
+	}
+	return r
+}
+
+func compileRegex(key, expr string) *regexp.Regexp {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		logging.Logger.Fatal(key + " isn't a valid regex: " + err.Error())
+	}
+	return re
+}
+
+// NewHeadersService returns a new populated instance of the headers service
+func NewHeadersService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Headers {
+	return &Headers{
+		xICAPMetadata: xICAPMetadata,
+		httpMsg:       httpMsg,
+		serviceName:   serviceName,
+		methodName:    methodName,
+		Rules:         headersConfig.Rules,
+		generalFunc:   general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+	}
+}
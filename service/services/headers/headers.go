@@ -0,0 +1,92 @@
+package headers
+
+import (
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (h *Headers) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = h.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	h.IcapHeaders = IcapHeader
+	h.IcapHeaders.Add("X-ICAP-Metadata", h.xICAPMetadata)
+	// the modified message is returned with its whole body, so the rest of the body is needed
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata,
+			h.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//the rules are applied on the headers of the request in REQMOD and of the response in RESPMOD,
+	//the body of the http message isn't copied because it isn't changed
+	var header http.Header
+	var httpMsg interface{}
+	target := Target{Mode: h.methodName}
+	if req := h.httpMsg.Request; req != nil {
+		u := url.URL{Host: req.Host}
+		if req.URL != nil {
+			target.Path = req.URL.Path
+			if req.URL.Host != "" {
+				u.Host = req.URL.Host
+			}
+		}
+		target.Host = u.Hostname()
+	}
+	if h.methodName == utils.ICAPModeReq && h.httpMsg.Request != nil {
+		header, httpMsg = h.httpMsg.Request.Header, h.httpMsg.Request
+	} else if h.methodName == utils.ICAPModeResp && h.httpMsg.Response != nil {
+		header, httpMsg = h.httpMsg.Response.Header, h.httpMsg.Response
+	}
+	if header == nil {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		return utils.NoModificationStatusCodeStr, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	target.ContentType = header.Get("Content-Type")
+
+	vars := map[string]string{
+		PlaceholderUser:     UserName(IcapHeader),
+		PlaceholderClientIP: IcapHeader.Get(utils.ClientIPHeader),
+		PlaceholderHost:     target.Host,
+	}
+	var applied []string
+	for _, rule := range h.Rules {
+		if rule.Matches(target) && rule.Apply(header, vars) {
+			applied = append(applied, rule.Name)
+		}
+	}
+	logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	if len(applied) == 0 {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		return utils.NoModificationStatusCodeStr, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	serviceHeaders["X-ICAPeg-Header-Rules"] = strings.Join(applied, ", ")
+	logging.Logger.Debug(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" applied the rules: "+
+		serviceHeaders["X-ICAPeg-Header-Rules"]))
+	if req, ok := httpMsg.(*http.Request); ok && req.URL.Scheme == "" {
+		req.URL.Opaque = req.URL.Host
+	}
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+	return utils.OkStatusCodeStr, httpMsg, serviceHeaders,
+		msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+func (h *Headers) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
@@ -0,0 +1,186 @@
+package headers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// the actions of the header rules
+const (
+	ActionSet     = "set"
+	ActionAppend  = "append"
+	ActionDelete  = "delete"
+	ActionReplace = "replace"
+)
+
+// the placeholders which are expanded in the values of the rules
+const (
+	PlaceholderUser     = "{user}"
+	PlaceholderClientIP = "{client_ip}"
+	PlaceholderHost     = "{host}"
+)
+
+// Rule is a header rule, it's applied on the headers of the HTTP request in REQMOD and of the HTTP response
+// in RESPMOD if it matches the mode, the host and the path of the request and the content type of the message
+type Rule struct {
+	Name   string
+	Action string
+	Header string
+	// Value is the value of set and append, and the replacement of replace which can have the submatches ($1)
+	Value string
+	// Pattern is the regex of replace, the values of delete are deleted only if they match it
+	Pattern      *regexp.Regexp
+	Modes        []string
+	Hosts        []string
+	Path         *regexp.Regexp
+	ContentTypes []string
+}
+
+// Target is the HTTP message which the rules are matched against
+type Target struct {
+	Mode        string
+	Host        string
+	Path        string
+	ContentType string
+}
+
+// Matches checks if the rule applies on the target, a host matches its subdomains too
+// and a content type matches its parameters (ex: "text/html" matches "text/html; charset=utf-8")
+func (r *Rule) Matches(t Target) bool {
+	if len(r.Modes) > 0 && !containsFold(r.Modes, t.Mode) {
+		return false
+	}
+	if len(r.Hosts) > 0 && !matchesHost(r.Hosts, t.Host) {
+		return false
+	}
+	if r.Path != nil && !r.Path.MatchString(t.Path) {
+		return false
+	}
+	if len(r.ContentTypes) > 0 {
+		mediaType := strings.TrimSpace(strings.ToLower(strings.Split(t.ContentType, ";")[0]))
+		matched := false
+		for _, contentType := range r.ContentTypes {
+			contentType = strings.ToLower(contentType)
+			if mediaType == contentType || (strings.HasSuffix(contentType, "/*") &&
+				strings.HasPrefix(mediaType, strings.TrimSuffix(contentType, "*"))) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply applies the rule on the headers, the placeholders of the value are replaced by the variables,
+// a rule which has a placeholder without a value isn't applied, it returns true if the headers changed
+func (r *Rule) Apply(header http.Header, vars map[string]string) bool {
+	value := r.Value
+	for placeholder, v := range vars {
+		if strings.Contains(value, placeholder) {
+			if v == "" {
+				return false
+			}
+			value = strings.ReplaceAll(value, placeholder, v)
+		}
+	}
+	values := header.Values(r.Header)
+	switch r.Action {
+	case ActionSet:
+		if len(values) == 1 && values[0] == value {
+			return false
+		}
+		header.Set(r.Header, value)
+		return true
+	case ActionAppend:
+		header.Add(r.Header, value)
+		return true
+	case ActionDelete:
+		if len(values) == 0 {
+			return false
+		}
+		if r.Pattern == nil {
+			header.Del(r.Header)
+			return true
+		}
+		var kept []string
+		for _, v := range values {
+			if !r.Pattern.MatchString(v) {
+				kept = append(kept, v)
+			}
+		}
+		return replaceValues(header, r.Header, values, kept)
+	case ActionReplace:
+		replaced := make([]string, len(values))
+		for i, v := range values {
+			replaced[i] = r.Pattern.ReplaceAllString(v, value)
+		}
+		return replaceValues(header, r.Header, values, replaced)
+	}
+	return false
+}
+
+// replaceValues replaces the values of the header if they changed, the header is deleted if it hasn't values
+func replaceValues(header http.Header, name string, values, newValues []string) bool {
+	if len(values) == len(newValues) {
+		changed := false
+		for i := range values {
+			changed = changed || values[i] != newValues[i]
+		}
+		if !changed {
+			return false
+		}
+	}
+	header.Del(name)
+	for _, v := range newValues {
+		header.Add(name, v)
+	}
+	return true
+}
+
+// UserName returns the name of the user of the ICAP request, it's taken from the X-Authenticated-User header
+// which is base64 encoded by the ICAP clients (ex: "WinNT://EXAMPLE/jdoe" or "LDAP://ldap/cn=jdoe") or from
+// the X-Client-Username header
+func UserName(icapHeader textproto.MIMEHeader) string {
+	if user := icapHeader.Get("X-Authenticated-User"); user != "" {
+		// the plain names which are valid base64 are told apart by the scheme of the decoded name
+		if decoded, err := base64.StdEncoding.DecodeString(user); err == nil && strings.Contains(string(decoded), "://") {
+			user = string(decoded)
+		}
+		if i := strings.Index(user, "://"); i >= 0 {
+			user = user[i+3:]
+		}
+		if i := strings.LastIndexAny(user, `/\`); i >= 0 {
+			user = user[i+1:]
+		}
+		if strings.HasPrefix(strings.ToLower(user), "cn=") {
+			user, _, _ = strings.Cut(user[3:], ",")
+		}
+		return user
+	}
+	return icapHeader.Get("X-Client-Username")
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesHost(hosts []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimPrefix(h, "*."))
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
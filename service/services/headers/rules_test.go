@@ -0,0 +1,83 @@
+package headers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRuleMatches(t *testing.T) {
+	r := &Rule{Modes: []string{"RESPMOD"}, Hosts: []string{"example.com"}, Path: regexp.MustCompile("^/app/"),
+		ContentTypes: []string{"text/*"}}
+	target := Target{Mode: "RESPMOD", Host: "www.example.com", Path: "/app/x", ContentType: "text/html; charset=utf-8"}
+	if !r.Matches(target) {
+		t.Error("expected the rule to match")
+	}
+	for _, change := range []func(*Target){
+		func(t *Target) { t.Mode = "REQMOD" },
+		func(t *Target) { t.Host = "notexample.com" },
+		func(t *Target) { t.Path = "/other" },
+		func(t *Target) { t.ContentType = "application/json" },
+	} {
+		other := target
+		change(&other)
+		if r.Matches(other) {
+			t.Errorf("expected the rule not to match %+v", other)
+		}
+	}
+}
+
+func TestRuleApply(t *testing.T) {
+	vars := map[string]string{PlaceholderUser: "jdoe", PlaceholderClientIP: ""}
+	for name, test := range map[string]struct {
+		rule     Rule
+		header   http.Header
+		changed  bool
+		expected http.Header
+	}{
+		"set": {Rule{Action: ActionSet, Header: "X-Forwarded-User", Value: "{user}"}, http.Header{},
+			true, http.Header{"X-Forwarded-User": {"jdoe"}}},
+		"set the same value": {Rule{Action: ActionSet, Header: "X-A", Value: "1"}, http.Header{"X-A": {"1"}},
+			false, http.Header{"X-A": {"1"}}},
+		"placeholder without a value": {Rule{Action: ActionSet, Header: "X-Client", Value: "{client_ip}"},
+			http.Header{}, false, http.Header{}},
+		"append": {Rule{Action: ActionAppend, Header: "Via", Value: "icapeg"}, http.Header{"Via": {"proxy"}},
+			true, http.Header{"Via": {"proxy", "icapeg"}}},
+		"delete": {Rule{Action: ActionDelete, Header: "Server"}, http.Header{"Server": {"nginx"}},
+			true, http.Header{}},
+		"delete missing header": {Rule{Action: ActionDelete, Header: "Server"}, http.Header{}, false, http.Header{}},
+		"delete tracking cookies": {Rule{Action: ActionDelete, Header: "Set-Cookie", Pattern: regexp.MustCompile("^_ga=")},
+			http.Header{"Set-Cookie": {"_ga=1; Path=/", "session=2"}}, true, http.Header{"Set-Cookie": {"session=2"}}},
+		"replace": {Rule{Action: ActionReplace, Header: "Location", Pattern: regexp.MustCompile("^http://(.*)$"),
+			Value: "https://$1"}, http.Header{"Location": {"http://example.com/"}}, true,
+			http.Header{"Location": {"https://example.com/"}}},
+		"replace without a match": {Rule{Action: ActionReplace, Header: "Location", Pattern: regexp.MustCompile("^ftp:"),
+			Value: "https:"}, http.Header{"Location": {"http://example.com/"}}, false,
+			http.Header{"Location": {"http://example.com/"}}},
+	} {
+		if changed := test.rule.Apply(test.header, vars); changed != test.changed {
+			t.Errorf("%s: expected changed %v, got %v", name, test.changed, changed)
+		}
+		if !reflect.DeepEqual(test.header, test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, test.header)
+		}
+	}
+}
+
+func TestUserName(t *testing.T) {
+	for header, expected := range map[string]string{
+		base64.StdEncoding.EncodeToString([]byte("WinNT://EXAMPLE/jdoe")):           "jdoe",
+		base64.StdEncoding.EncodeToString([]byte("LDAP://ldap/cn=jdoe,dc=example")): "jdoe",
+		"jdoe": "jdoe",
+	} {
+		if got := UserName(textproto.MIMEHeader{"X-Authenticated-User": {header}}); got != expected {
+			t.Errorf("%s: expected %q, got %q", header, expected, got)
+		}
+	}
+	if got := UserName(textproto.MIMEHeader{"X-Client-Username": {"alice"}}); got != "alice" {
+		t.Errorf("expected alice, got %q", got)
+	}
+}
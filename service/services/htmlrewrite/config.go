@@ -0,0 +1,78 @@
+package htmlrewrite
+
+import (
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/textproto"
+	"os"
+	"sync"
+)
+
+// the htmlrewrite constants
+const (
+	HtmlrewriteIdentifier = "HTMLREWRITE ID"
+)
+
+var doOnce sync.Once
+var htmlrewriteConfig *Htmlrewrite
+
+// Htmlrewrite represents the information regarding the HTML rewriting service,
+// it rewrites the HTML pages of the responses and the other responses go through untouched
+type Htmlrewrite struct {
+	xICAPMetadata string
+	httpMsg       *http_message.HttpMsg
+	serviceName   string
+	methodName    string
+	maxFileSize   int
+	Rewriter      *Rewriter
+	generalFunc   *general_functions.GeneralFunc
+	IcapHeaders   textproto.MIMEHeader
+}
+
+func InitHtmlrewriteConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		htmlrewriteConfig = &Htmlrewrite{
+			maxFileSize: readValues.ReadValuesInt(serviceName + ".max_filesize"),
+			Rewriter:    &Rewriter{},
+		}
+		r := htmlrewriteConfig.Rewriter
+		if readValues.IsSecExists(serviceName + ".remove_scripts_from") {
+			r.ScriptDomains = readValues.ReadValuesSlice(serviceName + ".remove_scripts_from")
+		}
+		if readValues.IsSecExists(serviceName + ".strip_event_handlers") {
+			r.StripEventHandlers = readValues.ReadValuesBool(serviceName + ".strip_event_handlers")
+		}
+		if readValues.IsSecExists(serviceName + ".banner") {
+			r.Banner = readValues.ReadValuesString(serviceName + ".banner")
+		}
+		if readValues.IsSecExists(serviceName + ".banner_file") {
+			banner, err := os.ReadFile(readValues.ReadValuesString(serviceName + ".banner_file"))
+			if err != nil {
+				logging.Logger.Fatal(serviceName + " couldn't read the banner file: " + err.Error())
+			}
+			r.Banner = string(banner)
+		}
+		if readValues.IsSecExists(serviceName + ".link_redirector") {
+			r.LinkRedirector = readValues.ReadValuesString(serviceName + ".link_redirector")
+		}
+		if readValues.IsSecExists(serviceName + ".link_except_hosts") {
+			r.LinkExceptHosts = readValues.ReadValuesSlice(serviceName + ".link_except_hosts")
+		}
+	})
+}
+
+// NewHtmlrewriteService returns a new populated instance of the htmlrewrite service
+func NewHtmlrewriteService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Htmlrewrite {
+	return &Htmlrewrite{
+		xICAPMetadata: xICAPMetadata,
+		httpMsg:       httpMsg,
+		serviceName:   serviceName,
+		methodName:    methodName,
+		maxFileSize:   htmlrewriteConfig.maxFileSize,
+		Rewriter:      htmlrewriteConfig.Rewriter,
+		generalFunc:   general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+	}
+}
@@ -0,0 +1,203 @@
+package htmlrewrite
+
+import (
+	"bytes"
+	"fmt"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"mime"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// htmlMediaTypes are the media types of the pages which are rewritten
+var htmlMediaTypes = []string{"text/html", "application/xhtml+xml"}
+
+// maxCharsetSniff is the size of the start of the page where the <meta> charset is looked for
+const maxCharsetSniff = 1024
+
+// maxPageSize is the max size of the pages which are rewritten when max_filesize isn't set,
+// the gzip pages are decompressed up to it
+const maxPageSize = 32 * 1024 * 1024
+
+// Processing is a func used for to processing the http message
+func (h *Htmlrewrite) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = h.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	h.IcapHeaders = IcapHeader
+	h.IcapHeaders.Add("X-ICAP-Metadata", h.xICAPMetadata)
+	// no need to rewrite part of the page, this service needs all the page at one time
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata,
+			h.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//the service rewrites the HTML pages of the responses only,
+	//the requests and the other responses go through untouched
+	if h.methodName != utils.ICAPModeResp || h.httpMsg.Response == nil || h.httpMsg.Response.StatusCode == 206 ||
+		!isHTML(h.httpMsg.Response.Header.Get("Content-Type")) {
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		if h.methodName == utils.ICAPModeResp {
+			return utils.NoModificationStatusCodeStr, h.httpMsg.Response, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		return utils.NoModificationStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//extracting the page from http message
+	file, _, err := h.generalFunc.CopyingFileToTheBuffer(h.methodName)
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	original := file.Bytes()
+	contentType := h.httpMsg.Response.Header.Get("Content-Type")
+	logging.Audit(h.xICAPMetadata).SetFile(contentType, "html", file.Len(), "")
+
+	//the gzip pages are decompressed before rewriting and compressed again after it,
+	//the pages which are compressed in another encoding go through untouched,
+	//the decompression stops after the max file size
+	maxSize := h.maxFileSize
+	if maxSize == 0 {
+		maxSize = maxPageSize
+	}
+	isGzip := h.generalFunc.IsBodyGzipCompressed(h.methodName)
+	encoding := h.httpMsg.Response.Header.Get("Content-Encoding")
+	page := original
+	if isGzip {
+		decompressed, err := h.generalFunc.DecompressGzipBodyLimited(bytes.NewBuffer(original), maxSize)
+		if err != nil {
+			logging.Logger.Error(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" error: "+err.Error()))
+			return h.untouched(original, serviceHeaders, msgHeadersBeforeProcessing, vendorMsgs)
+		}
+		page = decompressed.Bytes()
+	} else if encoding != "" && !strings.EqualFold(encoding, "identity") {
+		logging.Logger.Debug(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+": the page is compressed in "+
+			encoding+", it can't be rewritten"))
+		return h.untouched(original, serviceHeaders, msgHeadersBeforeProcessing, vendorMsgs)
+	}
+
+	//check if the page size is greater than max file size of the service
+	//if yes we will return the page as it is without rewriting it
+	if maxSize < len(page) {
+		logging.Logger.Debug(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+": the page size "+
+			strconv.Itoa(len(page))+" is greater than the max file size"))
+		return h.untouched(original, serviceHeaders, msgHeadersBeforeProcessing, vendorMsgs)
+	}
+	if !isASCIICompatible(contentType, page) {
+		logging.Logger.Debug(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+
+			": the charset of the page isn't ASCII compatible, it can't be rewritten"))
+		return h.untouched(original, serviceHeaders, msgHeadersBeforeProcessing, vendorMsgs)
+	}
+
+	rewriteStart := time.Now()
+	rewritten, stats := h.Rewriter.Rewrite(page, h.pageHost())
+	logging.Audit(h.xICAPMetadata).StageDone("rewrite", rewriteStart)
+	if !stats.Changed() {
+		return h.untouched(original, serviceHeaders, msgHeadersBeforeProcessing, vendorMsgs)
+	}
+	serviceHeaders["X-ICAPeg-HTML-Rewrites"] = fmt.Sprintf("scripts=%d; handlers=%d; links=%d; banner=%t",
+		stats.ScriptsRemoved, stats.HandlersStripped, stats.LinksRewritten, stats.BannerInjected)
+	logging.Logger.Debug(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" rewrote the page: "+
+		serviceHeaders["X-ICAPeg-HTML-Rewrites"]))
+	if isGzip {
+		rewritten, err = h.generalFunc.CompressFileGzip(rewritten)
+		if err != nil {
+			logging.Logger.Error(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" error: "+err.Error()))
+			return h.untouched(original, serviceHeaders, msgHeadersBeforeProcessing, vendorMsgs)
+		}
+	}
+	//the validators of the original page don't match the rewritten one
+	h.httpMsg.Response.Header.Del("Content-MD5")
+	h.httpMsg.Response.Header.Del("ETag")
+	logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+	httpMsg := h.generalFunc.ReturningHttpMessageWithFile(h.methodName, rewritten)
+	msgHeadersAfterProcessing = h.generalFunc.LogHTTPMsgHeaders(h.methodName)
+	return utils.OkStatusCodeStr, httpMsg, serviceHeaders,
+		msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// untouched returns the response with its original body and 204 no modifications
+func (h *Htmlrewrite) untouched(original []byte, serviceHeaders map[string]string, msgHeadersBeforeProcessing,
+	vendorMsgs map[string]interface{}) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	logging.Audit(h.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	logging.Logger.Info(utils.PrepareLogMsg(h.xICAPMetadata, h.serviceName+" service has stopped processing"))
+	httpMsg := h.generalFunc.ReturningHttpMessageWithFile(h.methodName, original)
+	return utils.NoModificationStatusCodeStr, httpMsg, serviceHeaders,
+		msgHeadersBeforeProcessing, h.generalFunc.LogHTTPMsgHeaders(h.methodName), vendorMsgs
+}
+
+// pageHost returns the host of the page which the relative sources of the scripts are resolved to
+func (h *Htmlrewrite) pageHost() string {
+	req := h.httpMsg.Request
+	if req == nil {
+		return ""
+	}
+	if req.URL != nil && req.URL.Host != "" {
+		return req.URL.Hostname()
+	}
+	u := url.URL{Host: req.Host}
+	return u.Hostname()
+}
+
+// isHTML checks if the media type of the Content-Type header is an HTML one
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range htmlMediaTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// isASCIICompatible checks if the charset of the page keeps the ASCII bytes of the markup as they are, the charset
+// is taken from the Content-Type header, the byte order mark or the <meta> charset of the start of the page
+func isASCIICompatible(contentType string, page []byte) bool {
+	if bytes.HasPrefix(page, []byte{0xFE, 0xFF}) || bytes.HasPrefix(page, []byte{0xFF, 0xFE}) {
+		return false
+	}
+	charset := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		charset = params["charset"]
+	}
+	if charset == "" {
+		start := page
+		if len(start) > maxCharsetSniff {
+			start = start[:maxCharsetSniff]
+		}
+		if i := bytes.Index(asciiLower(start), []byte("charset=")); i >= 0 {
+			value := strings.TrimLeft(string(start[i+len("charset="):]), "\"' ")
+			if end := strings.IndexAny(value, "\"'; />"); end >= 0 {
+				value = value[:end]
+			}
+			charset = value
+		}
+	}
+	charset = strings.ToLower(charset)
+	return !strings.HasPrefix(charset, "utf-16") && !strings.HasPrefix(charset, "utf-32") &&
+		!strings.HasPrefix(charset, "iso-2022") && !strings.HasPrefix(charset, "utf-7")
+}
+
+func (h *Htmlrewrite) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
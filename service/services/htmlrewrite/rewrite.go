@@ -0,0 +1,339 @@
+package htmlrewrite
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// rawTextElements are the elements which have text content which isn't parsed for tags until their end tag
+var rawTextElements = map[string]bool{"script": true, "style": true, "textarea": true, "title": true, "xmp": true,
+	"iframe": true, "noembed": true, "noframes": true}
+
+// Rewriter applies the transforms of the service on the HTML pages, the page is tokenized on its bytes so
+// the pages which are encoded in an ASCII compatible charset (ex: UTF-8, ISO-8859-1, windows-1252) keep
+// their charset and the tags which aren't transformed keep their original bytes
+type Rewriter struct {
+	// ScriptDomains are the domains (and their subdomains) which the <script> elements are removed from
+	ScriptDomains []string
+	// StripEventHandlers removes the inline event handlers attributes (ex: onclick, onload)
+	StripEventHandlers bool
+	// Banner is the snippet which is injected after the <body> start tag
+	Banner string
+	// LinkRedirector is the URL which the escaped absolute links are appended to (ex: "https://redirector/go?url=")
+	LinkRedirector string
+	// LinkExceptHosts are the hosts (and their subdomains) which the links to aren't rewritten
+	LinkExceptHosts []string
+}
+
+// Stats are the counts of the changes which were made to a page
+type Stats struct {
+	ScriptsRemoved   int
+	HandlersStripped int
+	LinksRewritten   int
+	BannerInjected   bool
+}
+
+// Changed checks if the page was changed
+func (s Stats) Changed() bool {
+	return s.ScriptsRemoved > 0 || s.HandlersStripped > 0 || s.LinksRewritten > 0 || s.BannerInjected
+}
+
+// attribute is an attribute of a start tag, the value is unescaped, raw is the attribute as it is in the page
+// and it's written back when the attribute isn't changed so the entities and the charset of the page are kept
+type attribute struct {
+	name     string
+	value    string
+	hasValue bool
+	raw      string
+	changed  bool
+}
+
+// tag is a parsed start tag
+type tag struct {
+	name        string
+	rawName     string
+	attrs       []attribute
+	selfClosing bool
+}
+
+// Rewrite applies the transforms on the page, host is the host of the page which the relative
+// sources of the scripts are resolved to
+func (r *Rewriter) Rewrite(page []byte, host string) ([]byte, Stats) {
+	var out bytes.Buffer
+	var stats Stats
+	out.Grow(len(page) + len(r.Banner))
+	lower := asciiLower(page)
+	i := 0
+	for i < len(page) {
+		lt := bytes.IndexByte(page[i:], '<')
+		if lt < 0 {
+			out.Write(page[i:])
+			break
+		}
+		out.Write(page[i : i+lt])
+		i += lt
+		rest := page[i:]
+		switch {
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			end := bytes.Index(rest[4:], []byte("-->"))
+			if end < 0 {
+				out.Write(rest)
+				return out.Bytes(), stats
+			}
+			out.Write(rest[:4+end+3])
+			i += 4 + end + 3
+			continue
+		case len(rest) > 1 && (rest[1] == '!' || rest[1] == '?' || rest[1] == '/'):
+			end := bytes.IndexByte(rest, '>')
+			if end < 0 {
+				out.Write(rest)
+				return out.Bytes(), stats
+			}
+			out.Write(rest[:end+1])
+			i += end + 1
+			continue
+		case len(rest) < 2 || !isASCIILetter(rest[1]):
+			out.WriteByte('<')
+			i++
+			continue
+		}
+
+		t, n := parseTag(rest)
+		if n < 0 {
+			out.Write(rest)
+			break
+		}
+		raw := rest[:n]
+		i += n
+		content, end := []byte(nil), []byte(nil)
+		if rawTextElements[t.name] && !t.selfClosing {
+			// the content of the raw text elements is copied as it is until the end tag
+			contentLen, endLen := rawTextEnd(page[i:], lower[i:], t.name)
+			content, end = page[i:i+contentLen], page[i+contentLen:i+contentLen+endLen]
+			i += contentLen + endLen
+		}
+		if t.name == "script" && r.isBlockedScript(t, host) {
+			stats.ScriptsRemoved++
+			continue
+		}
+		if r.transform(&t, &stats) {
+			out.WriteString(t.String())
+		} else {
+			out.Write(raw)
+		}
+		out.Write(content)
+		out.Write(end)
+		if t.name == "body" && r.Banner != "" && !stats.BannerInjected {
+			out.WriteString(r.Banner)
+			stats.BannerInjected = true
+		}
+	}
+	return out.Bytes(), stats
+}
+
+// isBlockedScript checks if the source of the script is in one of the script domains
+func (r *Rewriter) isBlockedScript(t tag, host string) bool {
+	if len(r.ScriptDomains) == 0 {
+		return false
+	}
+	src, ok := t.attr("src")
+	if !ok {
+		return false
+	}
+	u, err := url.Parse(strings.TrimSpace(src))
+	if err != nil {
+		return false
+	}
+	if u.Host != "" {
+		host = u.Hostname()
+	}
+	return matchesDomain(r.ScriptDomains, host)
+}
+
+// transform strips the event handlers of the tag and rewrites its link, it returns true if the tag was changed
+func (r *Rewriter) transform(t *tag, stats *Stats) bool {
+	changed := false
+	if r.StripEventHandlers {
+		attrs := t.attrs[:0]
+		for _, a := range t.attrs {
+			if len(a.name) > 2 && strings.HasPrefix(a.name, "on") {
+				stats.HandlersStripped++
+				changed = true
+				continue
+			}
+			attrs = append(attrs, a)
+		}
+		t.attrs = attrs
+	}
+	if r.LinkRedirector != "" && (t.name == "a" || t.name == "area") {
+		for j, a := range t.attrs {
+			if a.name == "href" && r.isRedirectedLink(a.value) {
+				t.attrs[j].value = r.LinkRedirector + url.QueryEscape(strings.TrimSpace(a.value))
+				t.attrs[j].changed = true
+				stats.LinksRewritten++
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// isRedirectedLink checks if the link is an absolute http(s) link which isn't to the redirector
+// nor to one of the except hosts, the relative links are links to the site of the page
+func (r *Rewriter) isRedirectedLink(link string) bool {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if redirector, err := url.Parse(r.LinkRedirector); err == nil && strings.EqualFold(redirector.Hostname(), u.Hostname()) {
+		return false
+	}
+	return !matchesDomain(r.LinkExceptHosts, u.Hostname())
+}
+
+// String serializes the tag, the changed attributes are written with their values escaped and quoted
+// and the other attributes are written as they're in the page
+func (t tag) String() string {
+	var b strings.Builder
+	b.WriteString("<" + t.rawName)
+	for _, a := range t.attrs {
+		if !a.changed {
+			b.WriteString(" " + a.raw)
+			continue
+		}
+		b.WriteString(" " + a.name)
+		if a.hasValue {
+			b.WriteString(`="` + html.EscapeString(a.value) + `"`)
+		}
+	}
+	if t.selfClosing {
+		b.WriteString(" /")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+func (t tag) attr(name string) (string, bool) {
+	for _, a := range t.attrs {
+		if a.name == name {
+			return a.value, true
+		}
+	}
+	return "", false
+}
+
+// parseTag parses the start tag at the start of data, it returns the tag and its length,
+// the length is -1 if the tag isn't closed
+func parseTag(data []byte) (tag, int) {
+	var t tag
+	i := 1
+	for i < len(data) && !isSpace(data[i]) && data[i] != '/' && data[i] != '>' {
+		i++
+	}
+	t.rawName = string(data[1:i])
+	t.name = strings.ToLower(t.rawName)
+	for {
+		for i < len(data) && (isSpace(data[i]) || data[i] == '/') {
+			t.selfClosing = data[i] == '/'
+			i++
+		}
+		if i >= len(data) {
+			return t, -1
+		}
+		if data[i] == '>' {
+			return t, i + 1
+		}
+		t.selfClosing = false
+		start := i
+		for i < len(data) && !isSpace(data[i]) && data[i] != '/' && data[i] != '>' && (data[i] != '=' || i == start) {
+			i++
+		}
+		a := attribute{name: strings.ToLower(string(data[start:i]))}
+		j := i
+		for j < len(data) && isSpace(data[j]) {
+			j++
+		}
+		if j < len(data) && data[j] == '=' {
+			a.hasValue = true
+			i = j + 1
+			for i < len(data) && isSpace(data[i]) {
+				i++
+			}
+			if i < len(data) && (data[i] == '"' || data[i] == '\'') {
+				end := bytes.IndexByte(data[i+1:], data[i])
+				if end < 0 {
+					return t, -1
+				}
+				a.value = html.UnescapeString(string(data[i+1 : i+1+end]))
+				i += end + 2
+			} else {
+				start := i
+				for i < len(data) && !isSpace(data[i]) && data[i] != '>' {
+					i++
+				}
+				a.value = html.UnescapeString(string(data[start:i]))
+			}
+		}
+		a.raw = string(data[start:i])
+		t.attrs = append(t.attrs, a)
+	}
+}
+
+// rawTextEnd returns the length of the content of a raw text element and the length of its end tag,
+// the content is the rest of the data if the element isn't closed, lower is the data in lower case
+func rawTextEnd(data, lower []byte, name string) (int, int) {
+	endTag := []byte("</" + name)
+	offset := 0
+	for {
+		j := bytes.Index(lower[offset:], endTag)
+		if j < 0 {
+			return len(data), 0
+		}
+		j += offset
+		k := j + len(endTag)
+		if k < len(data) && data[k] != '>' && data[k] != '/' && !isSpace(data[k]) {
+			offset = k
+			continue
+		}
+		end := bytes.IndexByte(data[k:], '>')
+		if end < 0 {
+			return len(data), 0
+		}
+		return j, k + end + 1 - j
+	}
+}
+
+// matchesDomain checks if the host is one of the domains or one of their subdomains
+func matchesDomain(domains []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "*."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// asciiLower returns a copy of the data which has the ASCII letters in lower case, the other bytes
+// aren't changed so the offsets of the copy are the offsets of the data
+func asciiLower(data []byte) []byte {
+	lower := make([]byte, len(data))
+	for i, c := range data {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return lower
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
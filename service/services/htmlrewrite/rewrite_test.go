@@ -0,0 +1,84 @@
+package htmlrewrite
+
+import "testing"
+
+func TestRewrite(t *testing.T) {
+	r := &Rewriter{
+		ScriptDomains:      []string{"ads.example.net"},
+		StripEventHandlers: true,
+		Banner:             "<div>filtered</div>",
+		LinkRedirector:     "https://go.example.org/?u=",
+		LinkExceptHosts:    []string{"example.com"},
+	}
+	for name, test := range map[string]struct {
+		host     string
+		page     string
+		expected string
+		stats    Stats
+	}{
+		"remote script": {
+			"www.example.com",
+			`<head><script src="https://cdn.ads.example.net/a.js"></script><SCRIPT>var a = "</div>";</SCRIPT></head>`,
+			`<head><SCRIPT>var a = "</div>";</SCRIPT></head>`,
+			Stats{ScriptsRemoved: 1},
+		},
+		"relative script of the page host": {
+			"ads.example.net",
+			`<script src="/x.js" ></script ><p>`,
+			`<p>`,
+			Stats{ScriptsRemoved: 1},
+		},
+		"event handlers": {
+			"www.example.com",
+			`<img src=a.png onerror="alert(1)" ONLOAD=x alt='a "b"'><br/>`,
+			`<img src=a.png alt='a "b"'><br/>`,
+			Stats{HandlersStripped: 2},
+		},
+		"attributes in another charset": {
+			"www.example.com",
+			"<p title=\"caf&eacute; caf\xe9\" onclick=x><a href=\"http://evil.test/caf\xe9\" title=&eacute;>",
+			"<p title=\"caf&eacute; caf\xe9\"><a href=\"https://go.example.org/?u=http%3A%2F%2Fevil.test%2Fcaf%E9\" title=&eacute;>",
+			Stats{HandlersStripped: 1, LinksRewritten: 1},
+		},
+		"banner and links": {
+			"www.example.com",
+			"<!-- <body> --><body class=x>\n<a href=\"https://evil.test/p?a=1&amp;b=2\">x</a><a href=\"/local\">" +
+				`<a href="http://www.example.com/">`,
+			"<!-- <body> --><body class=x><div>filtered</div>\n<a href=\"https://go.example.org/?u=https%3A%2F%2Fevil.test" +
+				"%2Fp%3Fa%3D1%26b%3D2\">x</a><a href=\"/local\"><a href=\"http://www.example.com/\">",
+			Stats{LinksRewritten: 1, BannerInjected: true},
+		},
+		"text and raw text": {
+			"www.example.com",
+			"a < b <textarea><a href=\"http://evil.test\"></textarea> caf\xe9",
+			"a < b <textarea><a href=\"http://evil.test\"></textarea> caf\xe9",
+			Stats{},
+		},
+	} {
+		page, stats := r.Rewrite([]byte(test.page), test.host)
+		if string(page) != test.expected {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, page)
+		}
+		if stats != test.stats {
+			t.Errorf("%s: expected %+v, got %+v", name, test.stats, stats)
+		}
+	}
+}
+
+func TestIsASCIICompatible(t *testing.T) {
+	for _, test := range []struct {
+		contentType string
+		page        string
+		expected    bool
+	}{
+		{"text/html; charset=windows-1252", "<html>", true},
+		{"text/html; charset=UTF-16LE", "<html>", false},
+		{"text/html", `<meta charset="utf-16"><html>`, false},
+		{"text/html", `<meta http-equiv="Content-Type" content="text/html; charset=Shift_JIS">`, true},
+		{"text/html", "\xff\xfe<\x00", false},
+	} {
+		if got := isASCIICompatible(test.contentType, []byte(test.page)); got != test.expected {
+			t.Errorf("%q %q: expected %v, got %v", test.contentType, test.page, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package icap_upstream
+
+import (
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	services_utilities "icapeg/service/services-utilities"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// the icap_upstream constants
+const (
+	// defaultOptionsTTL is how long the OPTIONS response of the upstream is cached
+	// if it doesn't have an Options-TTL header
+	defaultOptionsTTL = time.Hour
+	// optionsRetryInterval is the wait before sending OPTIONS again after it failed
+	optionsRetryInterval = 30 * time.Second
+)
+
+var doOnce sync.Once
+var icapUpstreamConfig *IcapUpstream
+
+// IcapUpstream represents the information regarding the upstream ICAP server service
+type IcapUpstream struct {
+	xICAPMetadata              string
+	httpMsg                    *http_message.HttpMsg
+	serviceName                string
+	methodName                 string
+	maxFileSize                int
+	bypassExts                 []string
+	processExts                []string
+	rejectExts                 []string
+	warnExts                   []string
+	extArrs                    []services_utilities.Extension
+	UpstreamUrl                string
+	OptionsTTL                 time.Duration
+	Timeout                    time.Duration
+	returnOrigIfMaxSizeExc     bool
+	return400IfFileExtRejected bool
+	generalFunc                *general_functions.GeneralFunc
+	BypassOnApiError           bool
+	ExceptionPage              string
+	IcapHeaders                textproto.MIMEHeader
+}
+
+func InitIcapUpstreamConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		icapUpstreamConfig = &IcapUpstream{
+			maxFileSize:                readValues.ReadValuesInt(serviceName + ".max_filesize"),
+			bypassExts:                 readValues.ReadValuesSlice(serviceName + ".bypass_extensions"),
+			processExts:                readValues.ReadValuesSlice(serviceName + ".process_extensions"),
+			rejectExts:                 readValues.ReadValuesSlice(serviceName + ".reject_extensions"),
+			UpstreamUrl:                readValues.ReadValuesString(serviceName + ".upstream_url"),
+			OptionsTTL:                 defaultOptionsTTL,
+			Timeout:                    readValues.ReadValuesDuration(serviceName+".timeout") * time.Second,
+			returnOrigIfMaxSizeExc:     readValues.ReadValuesBool(serviceName + ".return_original_if_max_file_size_exceeded"),
+			return400IfFileExtRejected: readValues.ReadValuesBool(serviceName + ".return_400_if_file_ext_rejected"),
+			BypassOnApiError:           readValues.ReadValuesBool(serviceName + ".bypass_on_api_error"),
+			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
+		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			icapUpstreamConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		if readValues.IsSecExists(serviceName + ".options_ttl") {
+			icapUpstreamConfig.OptionsTTL = readValues.ReadValuesDuration(serviceName+".options_ttl") * time.Second
+		}
+		icapUpstreamConfig.extArrs = services_utilities.InitExtsArr(icapUpstreamConfig.processExts, icapUpstreamConfig.rejectExts, icapUpstreamConfig.bypassExts)
+	})
+}
+
+// NewIcapUpstreamService returns a new populated instance of the icap_upstream service
+func NewIcapUpstreamService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *IcapUpstream {
+	return &IcapUpstream{
+		xICAPMetadata:              xICAPMetadata,
+		httpMsg:                    httpMsg,
+		serviceName:                serviceName,
+		methodName:                 methodName,
+		maxFileSize:                icapUpstreamConfig.maxFileSize,
+		bypassExts:                 icapUpstreamConfig.bypassExts,
+		processExts:                icapUpstreamConfig.processExts,
+		rejectExts:                 icapUpstreamConfig.rejectExts,
+		warnExts:                   icapUpstreamConfig.warnExts,
+		extArrs:                    icapUpstreamConfig.extArrs,
+		UpstreamUrl:                icapUpstreamConfig.UpstreamUrl,
+		OptionsTTL:                 icapUpstreamConfig.OptionsTTL,
+		Timeout:                    icapUpstreamConfig.Timeout,
+		returnOrigIfMaxSizeExc:     icapUpstreamConfig.returnOrigIfMaxSizeExc,
+		return400IfFileExtRejected: icapUpstreamConfig.return400IfFileExtRejected,
+		generalFunc:                general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+		BypassOnApiError:           icapUpstreamConfig.BypassOnApiError,
+		ExceptionPage:              icapUpstreamConfig.ExceptionPage,
+	}
+}
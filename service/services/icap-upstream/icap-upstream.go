@@ -0,0 +1,381 @@
+package icap_upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	utils "icapeg/consts"
+	icapclient "icapeg/icap-client"
+	"icapeg/logging"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (u *IcapUpstream) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = u.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	u.IcapHeaders = IcapHeader
+	u.IcapHeaders.Add("X-ICAP-Metadata", u.xICAPMetadata)
+	// no need to scan part of the file, this service needs all the file at ine time
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata,
+			u.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	if u.methodName == utils.ICAPModeResp {
+		if u.httpMsg.Response != nil {
+			if u.httpMsg.Response.StatusCode == 206 {
+				logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing byte range received"))
+				return utils.NoModificationStatusCodeStr, u.httpMsg, serviceHeaders,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+		}
+	}
+	isGzip := false
+	ExceptionPagePath := utils.BlockPagePath
+
+	if u.ExceptionPage != "" {
+		ExceptionPagePath = u.ExceptionPage
+	}
+	//extracting the file from http message
+
+	file, reqContentType, err := u.generalFunc.CopyingFileToTheBuffer(u.methodName)
+
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//if the http method is Connect, return the request as it is because it has no body
+	if u.methodName == utils.ICAPModeReq {
+		if u.httpMsg.Request.Method == http.MethodConnect {
+			return utils.OkStatusCodeStr, u.generalFunc.ReturningHttpMessageWithFile(u.methodName, file.Bytes()),
+				serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//getting the extension of the file
+	var contentType []string
+
+	var fileName string
+	if u.methodName == utils.ICAPModeReq {
+		contentType = u.httpMsg.Request.Header["Content-Type"]
+		fileName = u.generalFunc.GetFileName()
+	} else {
+		contentType = u.httpMsg.Response.Header["Content-Type"]
+		fileName = u.generalFunc.GetFileName()
+	}
+	if len(contentType) == 0 {
+		contentType = append(contentType, "")
+	}
+
+	logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" file name : "+fileName))
+
+	fileExtension := u.generalFunc.GetMimeExtension(file.Bytes(), contentType[0], fileName)
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+
+	hash := sha256.New()
+	f := file
+	_, err = hash.Write(f.Bytes())
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" error: "+err.Error()))
+	}
+	fileSize := fmt.Sprintf("%v", file.Len())
+	fileHash := hex.EncodeToString(hash.Sum([]byte(nil)))
+	logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" file hash : "+fileHash))
+	logging.Audit(u.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := u.generalFunc.CheckTheWarnPolicy(u.generalFunc.IsWarnExtension(fileExtension, u.warnExts),
+		u.IcapHeaders.Get(utils.ClientIPHeader), u.serviceName, u.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+	isProcess, icapStatus, httpMsg = u.generalFunc.CheckTheExtension(fileExtension, u.extArrs,
+		u.processExts, u.rejectExts, u.bypassExts, u.return400IfFileExtRejected, isGzip,
+		u.serviceName, u.methodName, fileHash, u.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	//check if the file size is greater than max file size of the service
+	//if yes we will return 200 ok or 204 no modification, it depends on the configuration of the service
+	if u.maxFileSize != 0 && u.maxFileSize < file.Len() {
+		status, file, httpMsg := u.generalFunc.IfMaxFileSizeExc(u.returnOrigIfMaxSizeExc, u.serviceName, u.methodName, file, u.maxFileSize, ExceptionPagePath, fileSize)
+		fileAfterPrep, httpMsg := u.generalFunc.IfStatusIs204WithFile(u.methodName, status, file, isGzip, reqContentType, httpMsg, true)
+		if fileAfterPrep == nil && httpMsg == nil {
+			logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+			return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+			logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+		return status, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = u.generalFunc.CheckTheContentPolicy(u.serviceName, u.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	scannedFile := file.Bytes()
+	scanStart := time.Now()
+	resp, err := u.sendToUpstream(u.generalFunc.PreparingFileAfterScanning(file.Bytes(), reqContentType, u.methodName))
+	logging.Audit(u.xICAPMetadata).StageDone("scan", scanStart)
+	if err != nil && !u.BypassOnApiError {
+		logging.Logger.Error(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" error: "+err.Error()))
+		if strings.Contains(err.Error(), "context deadline exceeded") || strings.Contains(err.Error(), "i/o timeout") {
+			logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+			return utils.RequestTimeOutStatusCodeStr, nil, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		// its suppose to be InternalServerErrStatusCodeStr but need to be handled
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+		return utils.BadRequestStatusCodeStr, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	if err != nil {
+		logging.Logger.Warn(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" error is bypassed: "+err.Error()))
+	}
+
+	//the upstream modified the HTTP message, so the modified message is returned instead of the original one
+	if err == nil && resp.StatusCode == http.StatusOK {
+		if threatName := upstreamThreatName(resp.Header); threatName != "" {
+			logging.Audit(u.xICAPMetadata).SetVerdict(logging.VerdictMalicious, threatName)
+			serviceHeaders["X-Virus-ID"] = threatName
+			u.generalFunc.QuarantineFile(scannedFile, u.serviceName, threatName, u.IcapHeaders.Get(utils.ClientIPHeader))
+		}
+		if httpMsg := u.modifiedHttpMsg(resp); httpMsg != nil {
+			logging.Logger.Debug(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+": the upstream modified the HTTP message"))
+			logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+			return utils.OkStatusCodeStr, httpMsg, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//the file is allowed without being scanned if the scanner error is bypassed
+	if err != nil {
+		logging.Audit(u.xICAPMetadata).SetVerdict(logging.VerdictUnscanned, "")
+	} else {
+		logging.Audit(u.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	}
+	//returning the scanned file if everything is ok
+	logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+	scannedFile = u.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, u.methodName)
+
+	return utils.NoModificationStatusCodeStr, u.generalFunc.ReturningHttpMessageWithFile(u.methodName, scannedFile),
+		serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// upstreamOptions caches the OPTIONS response of the upstream for its Options-TTL
+var upstreamOptions struct {
+	sync.Mutex
+	previewBytes int
+	isTag        string
+	expires      time.Time
+}
+
+// options returns the preview size and the ISTag of the upstream, it sends OPTIONS to the upstream
+// when the cached response expires, the last known values are returned if OPTIONS fails, the lock
+// isn't held while OPTIONS is sent, so the other transactions get the last known values meanwhile
+func (u *IcapUpstream) options() (int, string) {
+	upstreamOptions.Lock()
+	if time.Now().Before(upstreamOptions.expires) {
+		defer upstreamOptions.Unlock()
+		return upstreamOptions.previewBytes, upstreamOptions.isTag
+	}
+	//only one transaction refreshes the cache until the retry interval passes
+	upstreamOptions.expires = time.Now().Add(optionsRetryInterval)
+	previewBytes, isTag := upstreamOptions.previewBytes, upstreamOptions.isTag
+	upstreamOptions.Unlock()
+
+	req, err := icapclient.NewRequest(icapclient.MethodOPTIONS, u.UpstreamUrl, nil, nil)
+	var resp *icapclient.Response
+	if err == nil {
+		client := &icapclient.Client{Timeout: u.Timeout}
+		resp, err = client.Do(req)
+	}
+	if err == nil && resp.StatusCode != http.StatusOK {
+		err = errors.New("the upstream responded to OPTIONS with status code " + strconv.Itoa(resp.StatusCode))
+	}
+	if err != nil {
+		logging.Logger.Warn(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+
+			": OPTIONS of the upstream failed, the last known preview size and ISTag are used: "+err.Error()))
+		return previewBytes, isTag
+	}
+	ttl := u.OptionsTTL
+	if seconds, err := strconv.Atoi(resp.Header.Get(icapclient.OptionsTTLHeader)); err == nil && seconds > 0 {
+		ttl = time.Duration(seconds) * time.Second
+	}
+	upstreamOptions.Lock()
+	defer upstreamOptions.Unlock()
+	upstreamOptions.previewBytes = resp.PreviewBytes
+	upstreamOptions.isTag = resp.Header.Get(icapclient.ISTagHeader)
+	upstreamOptions.expires = time.Now().Add(ttl)
+	return upstreamOptions.previewBytes, upstreamOptions.isTag
+}
+
+// sendToUpstream re-issues the ICAP transaction to the upstream with the body of the HTTP message,
+// the preview size which the upstream asked for in its OPTIONS response is used
+func (u *IcapUpstream) sendToUpstream(body []byte) (*icapclient.Response, error) {
+	var httpReq *http.Request
+	var httpResp *http.Response
+	if u.httpMsg.Request != nil && u.httpMsg.Request.URL != nil {
+		httpReq = u.httpMsg.Request.Clone(context.Background())
+		httpReq.RequestURI = ""
+		if httpReq.URL.Host == "" {
+			httpReq.URL.Host = httpReq.Host
+		}
+		if httpReq.URL.Scheme == "" {
+			httpReq.URL.Scheme = "http"
+		}
+		httpReq.TransferEncoding = nil
+		httpReq.Header.Del("Transfer-Encoding")
+		httpReq.Body, httpReq.ContentLength = nil, 0
+		if u.methodName == utils.ICAPModeReq && len(body) > 0 {
+			httpReq.Body = io.NopCloser(bytes.NewReader(body))
+			httpReq.ContentLength = int64(len(body))
+		}
+	}
+	method := icapclient.MethodREQMOD
+	if u.methodName == utils.ICAPModeResp {
+		method = icapclient.MethodRESPMOD
+		if u.httpMsg.Response != nil {
+			response := *u.httpMsg.Response
+			response.Header = u.httpMsg.Response.Header.Clone()
+			response.Header.Del("Transfer-Encoding")
+			response.Header.Set(utils.ContentLength, strconv.Itoa(len(body)))
+			response.TransferEncoding = nil
+			response.ContentLength = int64(len(body))
+			response.Body = io.NopCloser(bytes.NewReader(body))
+			httpResp = &response
+		}
+	}
+	req, err := icapclient.NewRequest(method, u.UpstreamUrl, httpReq, httpResp)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), u.Timeout)
+	defer cancel()
+	req.SetContext(ctx)
+	if previewBytes, _ := u.options(); previewBytes > 0 {
+		if err = req.SetPreview(previewBytes); err != nil {
+			return nil, err
+		}
+	}
+	client := &icapclient.Client{Timeout: u.Timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return nil, errors.New("the upstream responded with status code " + strconv.Itoa(resp.StatusCode))
+	}
+	logging.Logger.Debug(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+
+		": the upstream responded with status code "+strconv.Itoa(resp.StatusCode)))
+	return resp, nil
+}
+
+// modifiedHttpMsg returns the HTTP message which the upstream returned in its 200 response with the decoded
+// body, in REQMOD the upstream may return an HTTP response instead of the request to block it
+func (u *IcapUpstream) modifiedHttpMsg(resp *icapclient.Response) interface{} {
+	if resp.ContentResponse != nil {
+		msg := resp.ContentResponse
+		msg.Header.Del("Transfer-Encoding")
+		msg.Header.Set(utils.ContentLength, strconv.Itoa(len(resp.Body)))
+		msg.TransferEncoding = nil
+		msg.ContentLength = int64(len(resp.Body))
+		msg.Body = io.NopCloser(bytes.NewBuffer(resp.Body))
+		if u.methodName == utils.ICAPModeReq || msg.StatusCode >= http.StatusBadRequest {
+			record := logging.Audit(u.xICAPMetadata)
+			if record.Verdict != logging.VerdictMalicious {
+				record.SetVerdict(logging.VerdictBlocked, "")
+			}
+		}
+		return msg
+	}
+	if resp.ContentRequest != nil && u.methodName == utils.ICAPModeReq {
+		msg := resp.ContentRequest
+		msg.Header.Del("Transfer-Encoding")
+		msg.Header.Set(utils.ContentLength, strconv.Itoa(len(resp.Body)))
+		msg.TransferEncoding = nil
+		msg.ContentLength = int64(len(resp.Body))
+		msg.Body = io.NopCloser(bytes.NewBuffer(resp.Body))
+		return msg
+	}
+	return nil
+}
+
+// upstreamThreatName returns the threat name which the upstream reported in
+// the X-Virus-ID or the X-Infection-Found ICAP headers
+func upstreamThreatName(header http.Header) string {
+	if threatName := header.Get("X-Virus-ID"); threatName != "" {
+		return threatName
+	}
+	for _, field := range strings.Split(header.Get("X-Infection-Found"), ";") {
+		if name, value, found := strings.Cut(strings.TrimSpace(field), "="); found && name == "Threat" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ISTagValue returns the ISTag of the upstream, so the ICAP clients invalidate their
+// cached responses when the upstream changes
+func (u *IcapUpstream) ISTagValue() string {
+	if _, isTag := u.options(); isTag != "" {
+		return isTag
+	}
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
@@ -0,0 +1,150 @@
+package icap_upstream
+
+import (
+	"bufio"
+	"bytes"
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const blockPage = "Blocked by upstream"
+
+// serveUpstream is a minimal upstream ICAP server which detects "EICAR" in the bodies
+func serveUpstream(l net.Listener, previews *int) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		reader := bufio.NewReader(conn)
+		var msg string
+		readUntil := func(end string) {
+			for part := ""; !strings.HasSuffix(part, end); {
+				b, err := reader.ReadByte()
+				if err != nil {
+					return
+				}
+				part += string(b)
+				msg += string(b)
+			}
+		}
+		readUntil("\r\n\r\n")
+		switch {
+		case strings.HasPrefix(msg, "OPTIONS"):
+			io.WriteString(conn, "ICAP/1.0 200 OK\r\nISTag: \"UP-1\"\r\nPreview: 4\r\nOptions-TTL: 60\r\n"+
+				"Encapsulated: null-body=0\r\n\r\n")
+		default:
+			readUntil("0\r\n\r\n")
+			if strings.Contains(msg, "Preview: 4") && !strings.HasSuffix(msg, "0; ieof\r\n\r\n") {
+				*previews++
+				io.WriteString(conn, "ICAP/1.0 100 Continue\r\n\r\n")
+				readUntil("0\r\n\r\n")
+			}
+			if !strings.Contains(msg, "EICAR") {
+				io.WriteString(conn, "ICAP/1.0 204 No modifications\r\nISTag: \"UP-1\"\r\n\r\n")
+				break
+			}
+			httpResp := "HTTP/1.1 403 Forbidden\r\nContent-Type: text/plain\r\n\r\n"
+			io.WriteString(conn, "ICAP/1.0 200 OK\r\nISTag: \"UP-1\"\r\n"+
+				"X-Infection-Found: Type=0; Resolution=2; Threat=EICAR-Test;\r\n"+
+				"Encapsulated: res-hdr=0, res-body="+strconv.Itoa(len(httpResp))+"\r\n\r\n"+httpResp+
+				strconv.FormatInt(int64(len(blockPage)), 16)+"\r\n"+blockPage+"\r\n0\r\n\r\n")
+		}
+		conn.Close()
+	}
+}
+
+func TestSendToUpstream(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	previews := 0
+	go serveUpstream(l, &previews)
+
+	httpReq, _ := http.NewRequest(http.MethodGet, "http://example.com/file", nil)
+	u := &IcapUpstream{
+		httpMsg: &http_message.HttpMsg{Request: httpReq, Response: &http.Response{
+			StatusCode: http.StatusOK, ProtoMajor: 1, ProtoMinor: 1, Header: http.Header{}}},
+		methodName:  "RESPMOD",
+		UpstreamUrl: "icap://" + l.Addr().String() + "/respmod",
+		OptionsTTL:  time.Minute,
+		Timeout:     2 * time.Second,
+	}
+
+	if isTag := u.ISTagValue(); isTag != `"UP-1"` {
+		t.Errorf("expected the ISTag of the upstream, got %q", isTag)
+	}
+
+	resp, err := u.sendToUpstream([]byte("a clean body"))
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 for a clean body, got %v %v", resp, err)
+	}
+	if previews != 1 {
+		t.Errorf("expected the body to be sent in a preview of the upstream size, got %d previews", previews)
+	}
+
+	resp, err = u.sendToUpstream([]byte("body with EICAR"))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for an infected body, got %v %v", resp, err)
+	}
+	if threatName := upstreamThreatName(resp.Header); threatName != "EICAR-Test" {
+		t.Errorf("expected the threat name of the upstream, got %q", threatName)
+	}
+	msg, ok := u.modifiedHttpMsg(resp).(*http.Response)
+	if !ok || msg.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the modified HTTP response, got %v", msg)
+	}
+	if body, _ := io.ReadAll(msg.Body); !bytes.Equal(body, []byte(blockPage)) {
+		t.Errorf("expected the modified body %q, got %q", blockPage, body)
+	}
+}
+
+func TestOptionsDoesNotWaitForTheRefresh(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	//the upstream accepts the connection but never responds
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	upstreamOptions.Lock()
+	upstreamOptions.previewBytes, upstreamOptions.isTag, upstreamOptions.expires = 10, `"STALE"`, time.Time{}
+	upstreamOptions.Unlock()
+	u := &IcapUpstream{UpstreamUrl: "icap://" + l.Addr().String() + "/respmod", Timeout: time.Second}
+
+	done := make(chan struct{})
+	go func() {
+		u.options()
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	if previewBytes, isTag := u.options(); previewBytes != 10 || isTag != `"STALE"` {
+		t.Errorf("expected the last known values, got %d %q", previewBytes, isTag)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("expected the last known values without waiting for OPTIONS")
+	}
+	<-done
+}
@@ -0,0 +1,180 @@
+package rest
+
+import (
+	"crypto/tls"
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	services_utilities "icapeg/service/services-utilities"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/http"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// the ways of submitting the file to the scanner
+const (
+	SubmitHashLookup = "hash_lookup"
+	SubmitRawPost    = "raw_post"
+	SubmitMultipart  = "multipart"
+)
+
+// the rest constants
+const (
+	RestIdentifier         = "REST ID"
+	defaultMultipartField  = "file"
+	defaultPollInterval    = 2 * time.Second
+	defaultPollMaxAttempts = 10
+)
+
+var doOnce sync.Once
+var restConfig *Rest
+
+// Rest represents the information regarding the generic REST scanner service,
+// the way of submitting the file and extracting the verdict is configured in config.toml
+type Rest struct {
+	xICAPMetadata              string
+	httpMsg                    *http_message.HttpMsg
+	serviceName                string
+	methodName                 string
+	maxFileSize                int
+	bypassExts                 []string
+	processExts                []string
+	rejectExts                 []string
+	warnExts                   []string
+	extArrs                    []services_utilities.Extension
+	SubmitMode                 string
+	ScanUrl                    string
+	Headers                    []string
+	MultipartField             string
+	VerdictPath                string
+	MaliciousValues            []string
+	ThreatPath                 string
+	NotFoundIsClean            bool
+	PollUrl                    string
+	PollIdPath                 string
+	PollDonePath               string
+	PollDoneValues             []string
+	PollInterval               time.Duration
+	PollMaxAttempts            int
+	Timeout                    time.Duration
+	returnOrigIfMaxSizeExc     bool
+	return400IfFileExtRejected bool
+	generalFunc                *general_functions.GeneralFunc
+	BypassOnApiError           bool
+	verifyServerCert           bool
+	client                     *http.Client
+	FileHash                   string
+	CaseBlockHttpResponseCode  int
+	CaseBlockHttpBody          bool
+	ExceptionPage              string
+	IcapHeaders                textproto.MIMEHeader
+}
+
+func InitRestConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		restConfig = &Rest{
+			maxFileSize:                readValues.ReadValuesInt(serviceName + ".max_filesize"),
+			bypassExts:                 readValues.ReadValuesSlice(serviceName + ".bypass_extensions"),
+			processExts:                readValues.ReadValuesSlice(serviceName + ".process_extensions"),
+			rejectExts:                 readValues.ReadValuesSlice(serviceName + ".reject_extensions"),
+			SubmitMode:                 readValues.ReadValuesString(serviceName + ".submit_mode"),
+			ScanUrl:                    readValues.ReadValuesString(serviceName + ".scan_url"),
+			VerdictPath:                readValues.ReadValuesString(serviceName + ".verdict_path"),
+			MultipartField:             defaultMultipartField,
+			NotFoundIsClean:            true,
+			PollInterval:               defaultPollInterval,
+			PollMaxAttempts:            defaultPollMaxAttempts,
+			Timeout:                    readValues.ReadValuesDuration(serviceName+".timeout") * time.Second,
+			returnOrigIfMaxSizeExc:     readValues.ReadValuesBool(serviceName + ".return_original_if_max_file_size_exceeded"),
+			return400IfFileExtRejected: readValues.ReadValuesBool(serviceName + ".return_400_if_file_ext_rejected"),
+			BypassOnApiError:           readValues.ReadValuesBool(serviceName + ".bypass_on_api_error"),
+			verifyServerCert:           readValues.ReadValuesBool(serviceName + ".verify_server_cert"),
+			CaseBlockHttpResponseCode:  readValues.ReadValuesInt(serviceName + ".http_exception_response_code"),
+			CaseBlockHttpBody:          readValues.ReadValuesBool(serviceName + ".http_exception_has_body"),
+			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
+		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			restConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		if readValues.IsSecExists(serviceName + ".headers") {
+			restConfig.Headers = readValues.ReadValuesSlice(serviceName + ".headers")
+		}
+		if readValues.IsSecExists(serviceName + ".multipart_field") {
+			restConfig.MultipartField = readValues.ReadValuesString(serviceName + ".multipart_field")
+		}
+		if readValues.IsSecExists(serviceName + ".malicious_values") {
+			restConfig.MaliciousValues = readValues.ReadValuesSlice(serviceName + ".malicious_values")
+		}
+		if readValues.IsSecExists(serviceName + ".threat_path") {
+			restConfig.ThreatPath = readValues.ReadValuesString(serviceName + ".threat_path")
+		}
+		if readValues.IsSecExists(serviceName + ".not_found_is_clean") {
+			restConfig.NotFoundIsClean = readValues.ReadValuesBool(serviceName + ".not_found_is_clean")
+		}
+		if readValues.IsSecExists(serviceName + ".poll_url") {
+			restConfig.PollUrl = readValues.ReadValuesString(serviceName + ".poll_url")
+			restConfig.PollIdPath = readValues.ReadValuesString(serviceName + ".poll_id_path")
+			restConfig.PollDonePath = readValues.ReadValuesString(serviceName + ".poll_done_path")
+			restConfig.PollDoneValues = readValues.ReadValuesSlice(serviceName + ".poll_done_values")
+		}
+		if readValues.IsSecExists(serviceName + ".poll_interval") {
+			restConfig.PollInterval = readValues.ReadValuesDuration(serviceName+".poll_interval") * time.Second
+		}
+		if readValues.IsSecExists(serviceName + ".poll_max_attempts") {
+			restConfig.PollMaxAttempts = readValues.ReadValuesInt(serviceName + ".poll_max_attempts")
+		}
+		if restConfig.SubmitMode != SubmitHashLookup && restConfig.SubmitMode != SubmitRawPost &&
+			restConfig.SubmitMode != SubmitMultipart {
+			logging.Logger.Fatal(serviceName + ".submit_mode should be " + SubmitHashLookup + ", " +
+				SubmitRawPost + " or " + SubmitMultipart)
+		}
+		//the client is shared by the requests of the service to reuse its connections
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: !restConfig.verifyServerCert}
+		restConfig.client = &http.Client{Transport: transport}
+		restConfig.extArrs = services_utilities.InitExtsArr(restConfig.processExts, restConfig.rejectExts, restConfig.bypassExts)
+	})
+}
+
+// NewRestService returns a new populated instance of the rest service
+func NewRestService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Rest {
+	return &Rest{
+		xICAPMetadata:              xICAPMetadata,
+		httpMsg:                    httpMsg,
+		serviceName:                serviceName,
+		methodName:                 methodName,
+		maxFileSize:                restConfig.maxFileSize,
+		bypassExts:                 restConfig.bypassExts,
+		processExts:                restConfig.processExts,
+		rejectExts:                 restConfig.rejectExts,
+		warnExts:                   restConfig.warnExts,
+		extArrs:                    restConfig.extArrs,
+		SubmitMode:                 restConfig.SubmitMode,
+		ScanUrl:                    restConfig.ScanUrl,
+		Headers:                    restConfig.Headers,
+		MultipartField:             restConfig.MultipartField,
+		VerdictPath:                restConfig.VerdictPath,
+		MaliciousValues:            restConfig.MaliciousValues,
+		ThreatPath:                 restConfig.ThreatPath,
+		NotFoundIsClean:            restConfig.NotFoundIsClean,
+		PollUrl:                    restConfig.PollUrl,
+		PollIdPath:                 restConfig.PollIdPath,
+		PollDonePath:               restConfig.PollDonePath,
+		PollDoneValues:             restConfig.PollDoneValues,
+		PollInterval:               restConfig.PollInterval,
+		PollMaxAttempts:            restConfig.PollMaxAttempts,
+		Timeout:                    restConfig.Timeout,
+		returnOrigIfMaxSizeExc:     restConfig.returnOrigIfMaxSizeExc,
+		return400IfFileExtRejected: restConfig.return400IfFileExtRejected,
+		generalFunc:                general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+		BypassOnApiError:           restConfig.BypassOnApiError,
+		verifyServerCert:           restConfig.verifyServerCert,
+		client:                     restConfig.client,
+		CaseBlockHttpResponseCode:  restConfig.CaseBlockHttpResponseCode,
+		CaseBlockHttpBody:          restConfig.CaseBlockHttpBody,
+		ExceptionPage:              restConfig.ExceptionPage,
+	}
+}
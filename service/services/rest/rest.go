@@ -0,0 +1,449 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	json_path "icapeg/service/services-utilities/json-path"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (r *Rest) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = r.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	r.IcapHeaders = IcapHeader
+	r.IcapHeaders.Add("X-ICAP-Metadata", r.xICAPMetadata)
+	// no need to scan part of the file, this service needs all the file at ine time
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata,
+			r.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	if r.methodName == utils.ICAPModeResp {
+		if r.httpMsg.Response != nil {
+			if r.httpMsg.Response.StatusCode == 206 {
+				logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing byte range received"))
+				return utils.NoModificationStatusCodeStr, r.httpMsg, serviceHeaders,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+		}
+	}
+	isGzip := false
+	ExceptionPagePath := utils.BlockPagePath
+
+	if r.ExceptionPage != "" {
+		ExceptionPagePath = r.ExceptionPage
+	}
+	//extracting the file from http message
+
+	file, reqContentType, err := r.generalFunc.CopyingFileToTheBuffer(r.methodName)
+
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//if the http method is Connect, return the request as it is because it has no body
+	if r.methodName == utils.ICAPModeReq {
+		if r.httpMsg.Request.Method == http.MethodConnect {
+			return utils.OkStatusCodeStr, r.generalFunc.ReturningHttpMessageWithFile(r.methodName, file.Bytes()),
+				serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//getting the extension of the file
+	var contentType []string
+
+	var fileName string
+	if r.methodName == utils.ICAPModeReq {
+		contentType = r.httpMsg.Request.Header["Content-Type"]
+		fileName = r.generalFunc.GetFileName()
+	} else {
+		contentType = r.httpMsg.Response.Header["Content-Type"]
+		fileName = r.generalFunc.GetFileName()
+	}
+	if len(contentType) == 0 {
+		contentType = append(contentType, "")
+	}
+
+	logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" file name : "+fileName))
+
+	fileExtension := r.generalFunc.GetMimeExtension(file.Bytes(), contentType[0], fileName)
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+
+	hash := sha256.New()
+	f := file
+	_, err = hash.Write(f.Bytes())
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" error: "+err.Error()))
+	}
+	fileSize := fmt.Sprintf("%v", file.Len())
+	fileHash := hex.EncodeToString(hash.Sum([]byte(nil)))
+	logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" file hash : "+fileHash))
+	logging.Audit(r.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := r.generalFunc.CheckTheWarnPolicy(r.generalFunc.IsWarnExtension(fileExtension, r.warnExts),
+		r.IcapHeaders.Get(utils.ClientIPHeader), r.serviceName, r.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+	isProcess, icapStatus, httpMsg = r.generalFunc.CheckTheExtension(fileExtension, r.extArrs,
+		r.processExts, r.rejectExts, r.bypassExts, r.return400IfFileExtRejected, isGzip,
+		r.serviceName, r.methodName, fileHash, r.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	//check if the file size is greater than max file size of the service
+	//if yes we will return 200 ok or 204 no modification, it depends on the configuration of the service
+	if r.maxFileSize != 0 && r.maxFileSize < file.Len() {
+		status, file, httpMsg := r.generalFunc.IfMaxFileSizeExc(r.returnOrigIfMaxSizeExc, r.serviceName, r.methodName, file, r.maxFileSize, ExceptionPagePath, fileSize)
+		fileAfterPrep, httpMsg := r.generalFunc.IfStatusIs204WithFile(r.methodName, status, file, isGzip, reqContentType, httpMsg, true)
+		if fileAfterPrep == nil && httpMsg == nil {
+			logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+			return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+			logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+		return status, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = r.generalFunc.CheckTheContentPolicy(r.serviceName, r.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	scannedFile := file.Bytes()
+	scanStart := time.Now()
+	isMal, threatName, err := r.sendFileToScan(file.Bytes(), fileHash, fileName, contentType[0])
+	logging.Audit(r.xICAPMetadata).StageDone("scan", scanStart)
+	if err != nil && !r.BypassOnApiError {
+		logging.Logger.Error(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" error: "+err.Error()))
+		if strings.Contains(err.Error(), "context deadline exceeded") {
+			logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+			return utils.RequestTimeOutStatusCodeStr, nil, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		// its suppose to be InternalServerErrStatusCodeStr but need to be handled
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		return utils.BadRequestStatusCodeStr, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	if err != nil {
+		logging.Logger.Warn(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" error is bypassed: "+err.Error()))
+	}
+
+	if isMal {
+		logging.Audit(r.xICAPMetadata).SetVerdict(logging.VerdictMalicious, threatName)
+		if threatName != "" {
+			serviceHeaders["X-Virus-ID"] = threatName
+		}
+		logging.Logger.Debug(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+": file is not safe"))
+		r.generalFunc.QuarantineFile(scannedFile, r.serviceName, threatName, r.IcapHeaders.Get(utils.ClientIPHeader))
+		if r.methodName == utils.ICAPModeResp {
+
+			errPage, contentType := r.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, r.serviceName, fileHash, r.httpMsg.Request.RequestURI, fileSize, r.xICAPMetadata)
+
+			r.httpMsg.Response = r.generalFunc.ErrPageResp(r.CaseBlockHttpResponseCode, errPage.Len(), contentType)
+			if r.CaseBlockHttpBody {
+				r.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+			} else {
+				var body []byte
+				r.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(body))
+				delete(r.httpMsg.Response.Header, "Content-Type")
+				delete(r.httpMsg.Response.Header, "Content-Length")
+			}
+			logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+			return utils.OkStatusCodeStr, r.httpMsg.Response, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		} else {
+			htmlPage, req, err := r.generalFunc.ReqModErrPage(utils.ErrPageReasonFileIsNotSafe, r.serviceName, fileHash, fileSize)
+			if err != nil {
+				logging.Logger.Error(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" error: "+err.Error()))
+
+				return utils.InternalServerErrStatusCodeStr, nil, nil,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+			req.Body = io.NopCloser(htmlPage)
+			msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+			return utils.OkStatusCodeStr, req, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//the file is allowed without being scanned if the scanner error is bypassed
+	if err != nil {
+		logging.Audit(r.xICAPMetadata).SetVerdict(logging.VerdictUnscanned, "")
+	} else {
+		logging.Audit(r.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	}
+	//returning the scanned file if everything is ok
+	logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+	scannedFile = r.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, r.methodName)
+
+	return utils.NoModificationStatusCodeStr, r.generalFunc.ReturningHttpMessageWithFile(r.methodName, scannedFile),
+		serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// templateData is the data which the scan URL, the poll URL and the header templates are executed with
+type templateData struct {
+	SHA256      string
+	FileName    string
+	ContentType string
+	ID          string
+}
+
+var templateFuncs = template.FuncMap{"env": os.Getenv}
+
+// render executes a template of the configuration, ex: https://scanner/lookup/{{.SHA256}} or {{env "API_KEY"}}
+func render(text string, data templateData) (string, error) {
+	tmpl, err := template.New("rest").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// newRequest creates a request to the scanner with the configured headers
+func (r *Rest) newRequest(ctx context.Context, method, urlTemplate string, body io.Reader, data templateData) (*http.Request, error) {
+	url, err := render(urlTemplate, data)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range r.Headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("invalid header \"" + header + "\", it should be \"Name: value\"")
+		}
+		value, err := render(strings.TrimSpace(parts[1]), data)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(strings.TrimSpace(parts[0]), value)
+	}
+	return req, nil
+}
+
+// submitRequest creates the request which submits the file to the scanner upon the submit mode
+func (r *Rest) submitRequest(ctx context.Context, file []byte, data templateData) (*http.Request, error) {
+	switch r.SubmitMode {
+	case SubmitHashLookup:
+		return r.newRequest(ctx, http.MethodGet, r.ScanUrl, nil, data)
+	case SubmitRawPost:
+		req, err := r.newRequest(ctx, http.MethodPost, r.ScanUrl, bytes.NewReader(file), data)
+		if err == nil && req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", "application/octet-stream")
+		}
+		return req, err
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fileName := data.FileName
+	if fileName == "" {
+		fileName = data.SHA256
+	}
+	part, err := writer.CreateFormFile(r.MultipartField, fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = part.Write(file); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+	req, err := r.newRequest(ctx, http.MethodPost, r.ScanUrl, &body, data)
+	if err == nil {
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+	}
+	return req, err
+}
+
+// do sends the request and decodes the JSON response, found is false if the scanner responded with 404
+func (r *Rest) do(client *http.Client, req *http.Request) (interface{}, bool, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode >= 300 {
+		return nil, false, errors.New("the scanner responded with status code " + strconv.Itoa(resp.StatusCode))
+	}
+	var doc interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, false, err
+	}
+	return doc, true, nil
+}
+
+// inValues checks if the string form of the value is one of the values, case-insensitively
+func inValues(value interface{}, values []string) bool {
+	s := json_path.String(value)
+	for _, v := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// poll gets the result URL until the result is done
+func (r *Rest) poll(ctx context.Context, client *http.Client, doc interface{}, data templateData) (interface{}, error) {
+	if r.PollIdPath != "" {
+		id, _ := json_path.Lookup(doc, r.PollIdPath)
+		data.ID = json_path.String(id)
+	}
+	for attempt := 0; attempt < r.PollMaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(r.PollInterval):
+		}
+		req, err := r.newRequest(ctx, http.MethodGet, r.PollUrl, nil, data)
+		if err != nil {
+			return nil, err
+		}
+		result, found, err := r.do(client, req)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		if r.PollDonePath == "" {
+			return result, nil
+		}
+		if status, ok := json_path.Lookup(result, r.PollDonePath); ok && inValues(status, r.PollDoneValues) {
+			return result, nil
+		}
+		logging.Logger.Debug(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+": the scan result isn't ready yet"))
+	}
+	return nil, errors.New("the scan result isn't ready after " + strconv.Itoa(r.PollMaxAttempts) + " attempts")
+}
+
+// verdict extracts the verdict and the threat name from the scan result, the results which don't have
+// the verdict (ex: the quota and the authentication errors of some scanners) are errors
+func (r *Rest) verdict(doc interface{}) (bool, string, error) {
+	value, ok := json_path.Lookup(doc, r.VerdictPath)
+	if !ok {
+		return false, "", errors.New("the scan result doesn't have " + r.VerdictPath)
+	}
+	isMal := json_path.Truthy(value)
+	if len(r.MaliciousValues) != 0 {
+		isMal = inValues(value, r.MaliciousValues)
+	}
+	if !isMal {
+		return false, "", nil
+	}
+	threatName := ""
+	if r.ThreatPath != "" {
+		threatName = json_path.String(json_path.Find(doc, r.ThreatPath))
+	}
+	return true, threatName, nil
+}
+
+// sendFileToScan submits the file to the scanner, polls the result URL if it's configured
+// and returns the verdict and the threat name
+func (r *Rest) sendFileToScan(file []byte, fileHash, fileName, contentType string) (bool, string, error) {
+	if fileHash == "" {
+		hash := sha256.Sum256(file)
+		fileHash = hex.EncodeToString(hash[:])
+	}
+	data := templateData{SHA256: fileHash, FileName: fileName, ContentType: contentType}
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	defer cancel()
+	req, err := r.submitRequest(ctx, file, data)
+	if err != nil {
+		return false, "", err
+	}
+	doc, found, err := r.do(r.client, req)
+	if err != nil {
+		return false, "", err
+	}
+	if !found {
+		if r.SubmitMode == SubmitHashLookup && r.NotFoundIsClean {
+			return false, "", nil
+		}
+		return false, "", errors.New("the scanner responded with status code " + strconv.Itoa(http.StatusNotFound))
+	}
+	if r.PollUrl != "" {
+		if doc, err = r.poll(ctx, r.client, doc, data); err != nil {
+			return false, "", err
+		}
+	}
+	return r.verdict(doc)
+}
+
+func (r *Rest) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
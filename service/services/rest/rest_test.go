@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"encoding/json"
+	"icapeg/logging"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func testRest(mode, url string) *Rest {
+	logging.Logger = zap.NewNop()
+	return &Rest{
+		SubmitMode:      mode,
+		ScanUrl:         url,
+		Headers:         []string{`X-Api-Key: {{env "REST_TEST_KEY"}}`},
+		MultipartField:  "file",
+		VerdictPath:     "data.attributes.malicious",
+		ThreatPath:      "data.attributes.names[*]",
+		NotFoundIsClean: true,
+		PollInterval:    time.Millisecond,
+		PollMaxAttempts: 3,
+		Timeout:         time.Second,
+		generalFunc:     general_functions.NewGeneralFunc(nil, ""),
+		client:          &http.Client{},
+	}
+}
+
+func TestHashLookup(t *testing.T) {
+	os.Setenv("REST_TEST_KEY", "secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/lookup/quota" {
+			w.Write([]byte(`{"error":{"code":"QuotaExceededError"}}`))
+			return
+		}
+		if r.URL.Path != "/lookup/abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"attributes":{"malicious":3,"names":["Eicar","Test"]}}}`))
+	}))
+	defer server.Close()
+	r := testRest(SubmitHashLookup, server.URL+"/lookup/{{.SHA256}}")
+
+	isMal, threatName, err := r.sendFileToScan([]byte("x"), "abc", "", "")
+	if err != nil || !isMal || threatName != "Eicar, Test" {
+		t.Errorf("expected a malicious verdict, got %v %q %v", isMal, threatName, err)
+	}
+	isMal, _, err = r.sendFileToScan([]byte("x"), "unknown", "", "")
+	if err != nil || isMal {
+		t.Errorf("expected an unknown hash to be clean, got %v %v", isMal, err)
+	}
+	if _, _, err = r.sendFileToScan([]byte("x"), "quota", "", ""); err == nil {
+		t.Error("expected an error for a result without the verdict")
+	}
+}
+
+func TestMultipartWithPolling(t *testing.T) {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scan", func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		if string(content) != "body" {
+			t.Errorf("unexpected uploaded content %q", content)
+		}
+		w.Write([]byte(`{"id":"42"}`))
+	})
+	mux.HandleFunc("/results/42", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "queued"
+		if polls > 1 {
+			status = "completed"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": status,
+			"data": map[string]interface{}{"attributes": map[string]interface{}{"malicious": "clean"}}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	r := testRest(SubmitMultipart, server.URL+"/scan")
+	r.PollUrl, r.PollIdPath = server.URL+"/results/{{.ID}}", "id"
+	r.PollDonePath, r.PollDoneValues = "status", []string{"completed"}
+
+	isMal, _, err := r.sendFileToScan([]byte("body"), "", "a.pdf", "")
+	if err != nil || isMal || polls != 2 {
+		t.Errorf("expected a clean verdict after 2 polls, got %v %v after %d polls", isMal, err, polls)
+	}
+}
@@ -0,0 +1,115 @@
+package rewrite
+
+import (
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the rewrite constants
+const (
+	RewriteIdentifier = "REWRITE ID"
+)
+
+var doOnce sync.Once
+var rewriteConfig *Rewrite
+
+// Rewrite represents the information regarding the URL rewriting service, the rules are the presets
+// followed by the rules of the config in their order and the first rule which matches the request is applied
+type Rewrite struct {
+	xICAPMetadata string
+	httpMsg       *http_message.HttpMsg
+	serviceName   string
+	methodName    string
+	Rules         []*Rule
+	generalFunc   *general_functions.GeneralFunc
+	IcapHeaders   textproto.MIMEHeader
+}
+
+func InitRewriteConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		rewriteConfig = &Rewrite{}
+		if readValues.IsSecExists(serviceName + ".presets") {
+			for _, name := range readValues.ReadValuesSlice(serviceName + ".presets") {
+				preset := Preset(name)
+				if preset == nil {
+					logging.Logger.Fatal(serviceName + " doesn't have a preset named " + name)
+				}
+				rewriteConfig.Rules = append(rewriteConfig.Rules, preset)
+			}
+		}
+		if readValues.IsSecExists(serviceName + ".rules") {
+			for _, name := range readValues.ReadValuesSlice(serviceName + ".rules") {
+				rewriteConfig.Rules = append(rewriteConfig.Rules, readRule(serviceName, name))
+			}
+		}
+		if len(rewriteConfig.Rules) == 0 {
+			logging.Logger.Fatal(serviceName + " should have at least one preset or rule")
+		}
+	})
+}
+
+// readRule reads the [<service>.<rule>] section of a rule
+func readRule(serviceName, name string) *Rule {
+	section := serviceName + "." + name + "."
+	r := &Rule{Name: name, Hosts: readValues.ReadValuesSlice(section + "hosts"), RedirectCode: http.StatusFound}
+	if len(r.Hosts) == 0 {
+		logging.Logger.Fatal(section + "hosts is required")
+	}
+	if readValues.IsSecExists(section + "path") {
+		path, err := regexp.Compile(readValues.ReadValuesString(section + "path"))
+		if err != nil {
+			logging.Logger.Fatal(section + "path isn't a valid regex: " + err.Error())
+		}
+		r.Path = path
+	}
+	if readValues.IsSecExists(section + "query") {
+		r.Query = readValues.ReadValuesSlice(section + "query")
+		for _, param := range r.Query {
+			if !strings.Contains(param, "=") {
+				logging.Logger.Fatal(section + "query should have key=value parameters")
+			}
+		}
+	}
+	if readValues.IsSecExists(section + "headers") {
+		r.Headers = readValues.ReadValuesSlice(section + "headers")
+		for _, header := range r.Headers {
+			if !strings.Contains(header, ":") {
+				logging.Logger.Fatal(section + "headers should have \"Name: value\" headers")
+			}
+		}
+	}
+	if readValues.IsSecExists(section + "redirect") {
+		r.Redirect = readValues.ReadValuesString(section + "redirect")
+	}
+	if readValues.IsSecExists(section + "redirect_code") {
+		r.RedirectCode = readValues.ReadValuesInt(section + "redirect_code")
+		if r.RedirectCode < 300 || r.RedirectCode > 399 {
+			logging.Logger.Fatal(section + "redirect_code should be a 3xx status code, not " + strconv.Itoa(r.RedirectCode))
+		}
+	}
+	if r.Redirect == "" && len(r.Query) == 0 && len(r.Headers) == 0 {
+		logging.Logger.Fatal(serviceName + "." + name + " should have query, headers or redirect")
+	}
+	return r
+}
+
+// NewRewriteService returns a new populated instance of the rewrite service
+func NewRewriteService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Rewrite {
+	return &Rewrite{
+		xICAPMetadata: xICAPMetadata,
+		httpMsg:       httpMsg,
+		serviceName:   serviceName,
+		methodName:    methodName,
+		Rules:         rewriteConfig.Rules,
+		generalFunc:   general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+	}
+}
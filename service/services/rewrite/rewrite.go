@@ -0,0 +1,102 @@
+package rewrite
+
+import (
+	"bytes"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (r *Rewrite) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = r.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	r.IcapHeaders = IcapHeader
+	r.IcapHeaders.Add("X-ICAP-Metadata", r.xICAPMetadata)
+	// the modified request is returned with its whole body, so the rest of the body is needed
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata,
+			r.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//the service rewrites the requests only, the encrypted CONNECT tunnels can't be rewritten
+	req := r.httpMsg.Request
+	if r.methodName != utils.ICAPModeReq || req == nil || req.URL == nil || req.Method == http.MethodConnect {
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		return utils.NoModificationStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	requestURL := r.requestURL()
+	var rule *Rule
+	for _, candidate := range r.Rules {
+		if candidate.Matches(requestURL) {
+			rule = candidate
+			break
+		}
+	}
+	logging.Audit(r.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	if rule == nil {
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		return utils.NoModificationStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	serviceHeaders["X-ICAPeg-Rewrite-Rule"] = rule.Name
+
+	//the redirect is returned as the response of the request
+	if rule.Redirect != "" {
+		location := rule.RedirectURL(requestURL)
+		logging.Logger.Debug(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+": "+requestURL.String()+
+			" is redirected to "+location+" by "+rule.Name+" rule"))
+		resp := r.generalFunc.ErrPageResp(rule.RedirectCode, 0, "text/html")
+		resp.Header.Set("Location", location)
+		resp.Body = io.NopCloser(bytes.NewBuffer(nil))
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+		return utils.OkStatusCodeStr, resp, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	if !rule.Apply(req) {
+		logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+		return utils.NoModificationStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	logging.Logger.Debug(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+": "+requestURL.String()+
+		" is rewritten to "+req.URL.String()+" by "+rule.Name+" rule"))
+	logging.Logger.Info(utils.PrepareLogMsg(r.xICAPMetadata, r.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = r.generalFunc.LogHTTPMsgHeaders(r.methodName)
+	return utils.OkStatusCodeStr, req, serviceHeaders,
+		msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// requestURL returns the absolute URL of the http request, the host is taken
+// from the Host header if the request line doesn't have it
+func (r *Rewrite) requestURL() *url.URL {
+	req := r.httpMsg.Request
+	requestURL := *req.URL
+	if requestURL.Host == "" {
+		requestURL.Host = req.Host
+	}
+	if requestURL.Scheme == "" && requestURL.Host != "" {
+		requestURL.Scheme = "http"
+	}
+	return &requestURL
+}
+
+func (r *Rewrite) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
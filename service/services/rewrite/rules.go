@@ -0,0 +1,122 @@
+package rewrite
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Rule is a rewrite rule of the requests which match its hosts and its path, it sets the parameters of the query
+// and the headers of the request, or redirects the request if it has a redirect URL
+type Rule struct {
+	Name string
+	// Hosts match their subdomains too, a host which ends with ".*" matches the host with any top level
+	// domain but not its subdomains (ex: "www.google.*" matches "www.google.co.uk")
+	Hosts []string
+	Path  *regexp.Regexp
+	// Query are the "key=value" parameters which are set in the query
+	Query []string
+	// Headers are the "Name: value" headers which are set in the request
+	Headers []string
+	// Redirect is the URL which the request is redirected to, {url} is replaced by the escaped URL of the request
+	Redirect     string
+	RedirectCode int
+}
+
+// presets are the built-in rules which enforce the safe search of the common search engines and YouTube restricted mode
+var presets = map[string]*Rule{
+	"google": {Name: "google", Hosts: []string{"google.*", "www.google.*"}, Path: regexp.MustCompile(`^/(search|images|videosearch)?$`),
+		Query: []string{"safe=active"}},
+	"bing": {Name: "bing", Hosts: []string{"bing.com"}, Path: regexp.MustCompile(`^/(search|images|videos)`),
+		Query: []string{"adlt=strict"}},
+	"duckduckgo": {Name: "duckduckgo", Hosts: []string{"duckduckgo.com"}, Query: []string{"kp=1"}},
+	"yahoo": {Name: "yahoo", Hosts: []string{"search.yahoo.com"}, Path: regexp.MustCompile(`^/search`),
+		Query: []string{"vm=r"}},
+	"yandex": {Name: "yandex", Hosts: []string{"yandex.*", "www.yandex.*"}, Path: regexp.MustCompile(`^/(search|images)`),
+		Query: []string{"family=yes"}},
+	"youtube": {Name: "youtube", Hosts: []string{"youtube.com", "youtube-nocookie.com", "youtubei.googleapis.com",
+		"youtube.googleapis.com"}, Headers: []string{"YouTube-Restrict: Strict"}},
+}
+
+// Preset returns the built-in rule of the name, nil is returned if there isn't one
+func Preset(name string) *Rule {
+	return presets[strings.ToLower(name)]
+}
+
+// Matches checks if the rule applies on the URL of the request
+func (r *Rule) Matches(u *url.URL) bool {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	matched := false
+	for _, h := range r.Hosts {
+		h = strings.ToLower(strings.TrimPrefix(h, "*."))
+		if strings.HasSuffix(h, ".*") {
+			matched = strings.HasPrefix(host, strings.TrimSuffix(h, "*"))
+		} else {
+			matched = host == h || strings.HasSuffix(host, "."+h)
+		}
+		if matched {
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	return r.Path == nil || r.Path.MatchString(u.Path)
+}
+
+// RedirectURL returns the URL which the request is redirected to
+func (r *Rule) RedirectURL(u *url.URL) string {
+	return strings.ReplaceAll(r.Redirect, "{url}", url.QueryEscape(u.String()))
+}
+
+// Apply sets the query parameters and the headers of the rule in the request, it returns true if the request changed
+func (r *Rule) Apply(req *http.Request) bool {
+	changed := false
+	if len(r.Query) > 0 {
+		query := req.URL.RawQuery
+		for _, param := range r.Query {
+			key, value, _ := strings.Cut(param, "=")
+			query = setQueryParam(query, key, value)
+		}
+		if query != req.URL.RawQuery {
+			req.URL.RawQuery = query
+			changed = true
+		}
+	}
+	for _, header := range r.Headers {
+		name, value, _ := strings.Cut(header, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if values := req.Header.Values(name); len(values) != 1 || values[0] != value {
+			req.Header.Set(name, value)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// setQueryParam sets the parameter in the raw query, the other parameters keep their order and their encoding,
+// the duplicates of the parameter are removed (ex: "safe=off&safe=images" becomes "safe=active")
+func setQueryParam(rawQuery, key, value string) string {
+	param := url.QueryEscape(key) + "=" + url.QueryEscape(value)
+	var params []string
+	set := false
+	for _, p := range strings.Split(rawQuery, "&") {
+		if p == "" {
+			continue
+		}
+		k, _, _ := strings.Cut(p, "=")
+		if unescaped, err := url.QueryUnescape(k); err == nil && unescaped == key {
+			if !set {
+				params = append(params, param)
+				set = true
+			}
+			continue
+		}
+		params = append(params, p)
+	}
+	if !set {
+		params = append(params, param)
+	}
+	return strings.Join(params, "&")
+}
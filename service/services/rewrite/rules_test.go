@@ -0,0 +1,57 @@
+package rewrite
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRuleMatches(t *testing.T) {
+	for rawURL, expected := range map[string]string{
+		"https://www.google.co.uk/search?q=x":   "google",
+		"https://google.com/":                   "google",
+		"https://mail.google.com/search":        "",
+		"https://www.bing.com/images/search":    "bing",
+		"https://m.youtube.com/watch?v=1":       "youtube",
+		"https://youtubei.googleapis.com/v1/":   "youtube",
+		"https://notyoutube.com/":               "",
+		"https://html.duckduckgo.com/html?q=x":  "duckduckgo",
+		"https://www.google.com/maps/search?q=": "",
+	} {
+		u, _ := url.Parse(rawURL)
+		matched := ""
+		for _, name := range []string{"google", "bing", "duckduckgo", "yahoo", "yandex", "youtube"} {
+			if Preset(name).Matches(u) {
+				matched = name
+				break
+			}
+		}
+		if matched != expected {
+			t.Errorf("%s: expected %q, got %q", rawURL, expected, matched)
+		}
+	}
+}
+
+func TestRuleApply(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://www.google.com/search?q=a+b&safe=off&hl=en&safe=images", nil)
+	if !Preset("google").Apply(req) {
+		t.Fatal("expected the request to change")
+	}
+	if expected := "q=a+b&safe=active&hl=en"; req.URL.RawQuery != expected {
+		t.Errorf("expected %q, got %q", expected, req.URL.RawQuery)
+	}
+	if Preset("google").Apply(req) {
+		t.Error("expected the rewritten request not to change")
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://www.youtube.com/", nil)
+	if !Preset("youtube").Apply(req) || req.Header.Get("YouTube-Restrict") != "Strict" {
+		t.Errorf("expected the YouTube-Restrict header, got %v", req.Header)
+	}
+
+	r := &Rule{Redirect: "https://intranet.example.com/moved?from={url}"}
+	u, _ := url.Parse("http://portal.example.com/a?b=c")
+	if expected := "https://intranet.example.com/moved?from=http%3A%2F%2Fportal.example.com%2Fa%3Fb%3Dc"; r.RedirectURL(u) != expected {
+		t.Errorf("expected %q, got %q", expected, r.RedirectURL(u))
+	}
+}
@@ -0,0 +1,83 @@
+package urlfilter
+
+import (
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/textproto"
+	"sync"
+)
+
+// the urlfilter constants
+const (
+	UrlfilterIdentifier = "URLFILTER ID"
+)
+
+var doOnce sync.Once
+var urlfilterConfig *Urlfilter
+
+// Urlfilter represents the information regarding the URL filtering service,
+// the URL of the request is evaluated against the categories in their order
+type Urlfilter struct {
+	xICAPMetadata             string
+	httpMsg                   *http_message.HttpMsg
+	serviceName               string
+	methodName                string
+	Categories                []*Category
+	generalFunc               *general_functions.GeneralFunc
+	CaseBlockHttpResponseCode int
+	CaseBlockHttpBody         bool
+	ExceptionPage             string
+	IcapHeaders               textproto.MIMEHeader
+}
+
+func InitUrlfilterConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		urlfilterConfig = &Urlfilter{
+			CaseBlockHttpResponseCode: readValues.ReadValuesInt(serviceName + ".http_exception_response_code"),
+			CaseBlockHttpBody:         readValues.ReadValuesBool(serviceName + ".http_exception_has_body"),
+			ExceptionPage:             readValues.ReadValuesString(serviceName + ".exception_page"),
+		}
+		for _, name := range readValues.ReadValuesSlice(serviceName + ".categories") {
+			urlfilterConfig.Categories = append(urlfilterConfig.Categories, readCategory(serviceName, name))
+		}
+		if len(urlfilterConfig.Categories) == 0 {
+			logging.Logger.Fatal(serviceName + " should have at least one category")
+		}
+	})
+}
+
+// readCategory reads the [<service>.<category>] section of a category and loads its files
+func readCategory(serviceName, name string) *Category {
+	section := serviceName + "." + name + "."
+	action := readValues.ReadValuesString(section + "action")
+	if action != ActionAllow && action != ActionBlock && action != ActionWarn && action != ActionLog {
+		logging.Logger.Fatal(section + "action should be " + ActionAllow + ", " + ActionBlock + ", " +
+			ActionWarn + " or " + ActionLog)
+	}
+	var files, regexFiles []string
+	if readValues.IsSecExists(section + "files") {
+		files = readValues.ReadValuesSlice(section + "files")
+	}
+	if readValues.IsSecExists(section + "regex_files") {
+		regexFiles = readValues.ReadValuesSlice(section + "regex_files")
+	}
+	return NewCategory(name, action, files, regexFiles)
+}
+
+// NewUrlfilterService returns a new populated instance of the urlfilter service
+func NewUrlfilterService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *Urlfilter {
+	return &Urlfilter{
+		xICAPMetadata:             xICAPMetadata,
+		httpMsg:                   httpMsg,
+		serviceName:               serviceName,
+		methodName:                methodName,
+		Categories:                urlfilterConfig.Categories,
+		generalFunc:               general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+		CaseBlockHttpResponseCode: urlfilterConfig.CaseBlockHttpResponseCode,
+		CaseBlockHttpBody:         urlfilterConfig.CaseBlockHttpBody,
+		ExceptionPage:             urlfilterConfig.ExceptionPage,
+	}
+}
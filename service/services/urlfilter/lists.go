@@ -0,0 +1,216 @@
+package urlfilter
+
+import (
+	"bufio"
+	"icapeg/logging"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the actions of the categories
+const (
+	ActionAllow = "allow"
+	ActionBlock = "block"
+	ActionWarn  = "warn"
+	ActionLog   = "log"
+)
+
+// hostsFileIPs are the addresses which the hosts file format uses to sink the domains
+var hostsFileIPs = map[string]bool{"0.0.0.0": true, "127.0.0.1": true, "::": true, "::1": true}
+
+// Category is a named list of domains, exact URLs, regexes and CIDRs with the action
+// which is taken when the URL of a request matches it
+type Category struct {
+	Name    string
+	Action  string
+	domains map[string]struct{}
+	urls    map[string]struct{}
+	regexes []*regexp.Regexp
+	cidrs   []*net.IPNet
+}
+
+// NewCategory loads the entries of the files of a category, a file which can't be loaded is logged and skipped
+func NewCategory(name, action string, files, regexFiles []string) *Category {
+	c := &Category{
+		Name:    name,
+		Action:  action,
+		domains: make(map[string]struct{}),
+		urls:    make(map[string]struct{}),
+	}
+	for _, file := range files {
+		if err := c.loadFile(file); err != nil {
+			logging.Logger.Error("the " + name + " category file " + file + " couldn't be loaded: " + err.Error())
+		}
+	}
+	for _, file := range regexFiles {
+		if err := c.loadRegexFile(file); err != nil {
+			logging.Logger.Error("the " + name + " category file " + file + " couldn't be loaded: " + err.Error())
+		}
+	}
+	logging.Logger.Info("the " + name + " category is loaded, domains: " + strconv.Itoa(len(c.domains)) +
+		", urls: " + strconv.Itoa(len(c.urls)) + ", regexes: " + strconv.Itoa(len(c.regexes)) +
+		", cidrs: " + strconv.Itoa(len(c.cidrs)))
+	return c
+}
+
+// Match returns the entry of the category which matches the URL, a domain matches
+// the host and all of its subdomains, so only one lookup is done for every label of the host
+func (c *Category) Match(u *url.URL) (string, bool) {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, cidr := range c.cidrs {
+			if cidr.Contains(ip) {
+				return cidr.String(), true
+			}
+		}
+	} else {
+		for domain := host; ; {
+			if _, ok := c.domains[domain]; ok {
+				return domain, true
+			}
+			dot := strings.IndexByte(domain, '.')
+			if dot < 0 {
+				break
+			}
+			domain = domain[dot+1:]
+		}
+	}
+	if len(c.urls) > 0 {
+		if normalized := normalizeURL(u); normalized != "" {
+			if _, ok := c.urls[normalized]; ok {
+				return normalized, true
+			}
+		}
+	}
+	rawURL := u.String()
+	for _, re := range c.regexes {
+		if re.MatchString(rawURL) {
+			return re.String(), true
+		}
+	}
+	return "", false
+}
+
+// loadFile adds the entries of a list file, the format of every line is detected on its own so
+// plain domain lists, hosts files ("0.0.0.0 example.com"), Adblock domain rules ("||example.com^"),
+// URL lists and IP/CIDR lists are supported, # and ! start a comment
+func (c *Category) loadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '!' || strings.HasPrefix(line, "@@") {
+			continue
+		}
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 1 && hostsFileIPs[fields[0]] {
+			for _, domain := range fields[1:] {
+				c.addDomain(domain)
+			}
+			continue
+		}
+		c.addEntry(fields[0])
+	}
+	return scanner.Err()
+}
+
+// addEntry adds one entry of a list file to the matching set of the category
+func (c *Category) addEntry(entry string) {
+	if strings.HasPrefix(entry, "||") {
+		entry, _, _ = strings.Cut(entry[2:], "$")
+		if strings.HasSuffix(entry, "^") && !strings.ContainsAny(entry, "/*") {
+			c.addDomain(strings.TrimSuffix(entry, "^"))
+		}
+		return
+	}
+	if _, cidr, err := net.ParseCIDR(entry); err == nil {
+		c.cidrs = append(c.cidrs, cidr)
+		return
+	}
+	if ip := net.ParseIP(entry); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		c.cidrs = append(c.cidrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		return
+	}
+	if strings.Contains(entry, "/") {
+		if !strings.Contains(entry, "://") {
+			entry = "http://" + entry
+		}
+		if u, err := url.Parse(entry); err == nil {
+			if normalized := normalizeURL(u); normalized != "" {
+				c.urls[normalized] = struct{}{}
+			}
+		}
+		return
+	}
+	c.addDomain(entry)
+}
+
+// addDomain adds a domain, a leading "*." or "." is removed because every domain matches its subdomains
+func (c *Category) addDomain(domain string) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*"), ".")
+	if domain == "" || hostsFileIPs[domain] || domain == "localhost" || strings.ContainsAny(domain, "/:*^") {
+		return
+	}
+	c.domains[domain] = struct{}{}
+}
+
+// loadRegexFile adds the regexes of a file, one regex per line which is matched against the whole URL
+func (c *Category) loadRegexFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		re, err := regexp.Compile(line)
+		if err != nil {
+			logging.Logger.Error("the " + c.Name + " category regex " + line + " is invalid: " + err.Error())
+			continue
+		}
+		c.regexes = append(c.regexes, re)
+	}
+	return scanner.Err()
+}
+
+// normalizeURL returns the host, the path and the query of the URL without the scheme,
+// the default ports, the fragment and the trailing slash to compare the exact URLs
+func normalizeURL(u *url.URL) string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return ""
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	normalized := host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		normalized += "?" + u.RawQuery
+	}
+	return normalized
+}
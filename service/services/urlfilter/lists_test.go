@@ -0,0 +1,77 @@
+package urlfilter
+
+import (
+	"icapeg/logging"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCategoryMatch(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.txt")
+	os.WriteFile(list, []byte("# hosts, adblock, domains, URLs and CIDRs\n"+
+		"0.0.0.0 ads.example.com tracker.example.net\n"+
+		"! adblock comment\n||evil.org^$third-party\n"+
+		"*.bad.io\n"+
+		"example.com/downloads/setup.exe\n"+
+		"10.0.0.0/8\n192.168.1.5\n"), 0600)
+	regexes := filepath.Join(dir, "regexes.txt")
+	os.WriteFile(regexes, []byte("# comment\n\\.zip$\n(invalid\n"), 0600)
+	c := NewCategory("test", ActionBlock, []string{list, filepath.Join(dir, "missing.txt")}, []string{regexes})
+
+	for rawURL, want := range map[string]string{
+		"http://ads.example.com/banner":                "ads.example.com",
+		"https://cdn.ads.example.com/":                 "ads.example.com",
+		"http://www.evil.org/":                         "evil.org",
+		"http://BAD.io./x":                             "bad.io",
+		"https://example.com:443/downloads/setup.exe/": "example.com/downloads/setup.exe",
+		"http://10.1.2.3:8080/":                        "10.0.0.0/8",
+		"http://192.168.1.5/":                          "192.168.1.5/32",
+		"http://files.example.org/archive.zip":         `\.zip$`,
+		"http://example.com/":                          "",
+		"http://notevil.org/":                          "",
+		"http://example.com/downloads/setup.exe?v=1":   "",
+		"http://192.168.1.6/":                          "",
+	} {
+		u, _ := url.Parse(rawURL)
+		got, matched := c.Match(u)
+		if matched != (want != "") || got != want {
+			t.Errorf("%s: expected %q, got %q (matched: %v)", rawURL, want, got, matched)
+		}
+	}
+}
+
+func TestEvaluateOrder(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.txt")
+	os.WriteFile(list, []byte("example.com\n"), 0600)
+	allowed := filepath.Join(dir, "allowed.txt")
+	os.WriteFile(allowed, []byte("www.example.com\n"), 0600)
+	f := &Urlfilter{Categories: []*Category{
+		NewCategory("audit", ActionLog, []string{list}, nil),
+		NewCategory("trusted", ActionAllow, []string{allowed}, nil),
+		NewCategory("blocked", ActionBlock, []string{list}, nil),
+	}}
+
+	for rawURL, want := range map[string]string{
+		"http://www.example.com/": "trusted",
+		"http://api.example.com/": "blocked",
+		"http://example.net/":     "",
+	} {
+		u, _ := url.Parse(rawURL)
+		category, _ := f.evaluate(u)
+		if (category == nil && want != "") || (category != nil && category.Name != want) {
+			t.Errorf("%s: expected %q category, got %v", rawURL, want, category)
+		}
+	}
+	f.Categories = f.Categories[:1]
+	if category, _ := f.evaluate(&url.URL{Scheme: "http", Host: "example.com"}); category == nil || category.Name != "audit" {
+		t.Errorf("expected the log category when no other category matches, got %v", category)
+	}
+}
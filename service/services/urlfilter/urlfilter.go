@@ -0,0 +1,153 @@
+package urlfilter
+
+import (
+	"bytes"
+	"fmt"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (u *Urlfilter) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = u.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	u.IcapHeaders = IcapHeader
+	u.IcapHeaders.Add("X-ICAP-Metadata", u.xICAPMetadata)
+	isGzip := false
+	ExceptionPagePath := utils.BlockPagePath
+
+	if u.ExceptionPage != "" {
+		ExceptionPagePath = u.ExceptionPage
+	}
+
+	//evaluating the URL of the request against the categories,
+	//the body of the http message isn't scanned by this service
+	requestURL := u.requestURL()
+	category, entry := u.evaluate(requestURL)
+	if category != nil {
+		serviceHeaders["X-ICAPeg-URL-Category"] = category.Name
+	}
+	if category != nil && category.Action == ActionBlock {
+		threatName := "category: " + category.Name
+		logging.Logger.Debug(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+": "+requestURL.String()+
+			" is blocked by "+entry+" of "+category.Name+" category"))
+		logging.Audit(u.xICAPMetadata).SetVerdict(logging.VerdictBlocked, threatName)
+		errPage, contentType := u.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonURLBlocked, u.serviceName,
+			"", requestURL.String(), "", u.xICAPMetadata)
+		u.httpMsg.Response = u.generalFunc.ErrPageResp(u.CaseBlockHttpResponseCode, errPage.Len(), contentType)
+		if u.CaseBlockHttpBody {
+			u.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+		} else {
+			var body []byte
+			u.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(body))
+			delete(u.httpMsg.Response.Header, "Content-Type")
+			delete(u.httpMsg.Response.Header, "Content-Length")
+		}
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+		return utils.OkStatusCodeStr, u.httpMsg.Response, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//the blocked URLs are blocked during the preview, the other actions
+	//need the whole body because the http message is returned with it
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata,
+			u.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//extracting the file from http message
+	file, reqContentType, err := u.generalFunc.CopyingFileToTheBuffer(u.methodName)
+
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the client proceeded to the URL after a warning or if the URL is in a warn category
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	if category != nil && category.Action == ActionWarn {
+		isProcess, icapStatus, httpMsg := u.generalFunc.CheckTheWarnPolicy(true, u.IcapHeaders.Get(utils.ClientIPHeader),
+			u.serviceName, u.methodName, "", fmt.Sprintf("%v", file.Len()), isGzip, reqContentType, file)
+		if !isProcess {
+			logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+			return icapStatus, httpMsg, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	if category != nil && category.Action == ActionAllow {
+		logging.Audit(u.xICAPMetadata).SetVerdict(logging.VerdictAllowed, "")
+	} else {
+		logging.Audit(u.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	}
+	//returning the http message as it is because the URL isn't blocked
+	logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = u.generalFunc.LogHTTPMsgHeaders(u.methodName)
+	fileAfterPrep := u.generalFunc.PreparingFileAfterScanning(file.Bytes(), reqContentType, u.methodName)
+	return utils.NoModificationStatusCodeStr, u.generalFunc.ReturningHttpMessageWithFile(u.methodName, fileAfterPrep),
+		serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// requestURL returns the absolute URL of the http request, the host is taken
+// from the Host header if the request line doesn't have it
+func (u *Urlfilter) requestURL() *url.URL {
+	req := u.httpMsg.Request
+	if req == nil || req.URL == nil {
+		return &url.URL{}
+	}
+	requestURL := *req.URL
+	if requestURL.Host == "" {
+		requestURL.Host = req.Host
+	}
+	if requestURL.Scheme == "" && requestURL.Host != "" {
+		requestURL.Scheme = "http"
+		if req.Method == http.MethodConnect {
+			requestURL.Scheme = "https"
+		}
+	}
+	return &requestURL
+}
+
+// evaluate checks the URL against the categories in their order, the first matched category
+// which isn't a log category decides the action, the matches of the log categories are only logged
+func (u *Urlfilter) evaluate(requestURL *url.URL) (*Category, string) {
+	var logCategory *Category
+	var logEntry string
+	for _, category := range u.Categories {
+		entry, matched := category.Match(requestURL)
+		if !matched {
+			continue
+		}
+		if category.Action != ActionLog {
+			return category, entry
+		}
+		logging.Logger.Info(utils.PrepareLogMsg(u.xICAPMetadata, u.serviceName+": "+requestURL.String()+
+			" matched "+entry+" of "+category.Name+" category"))
+		if logCategory == nil {
+			logCategory, logEntry = category, entry
+		}
+	}
+	return logCategory, logEntry
+}
+
+func (u *Urlfilter) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
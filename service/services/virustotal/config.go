@@ -0,0 +1,144 @@
+package virustotal
+
+import (
+	"crypto/tls"
+	http_message "icapeg/http-message"
+	"icapeg/logging"
+	"icapeg/readValues"
+	services_utilities "icapeg/service/services-utilities"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"net/http"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+// the virustotal constants
+const (
+	VirusTotalIdentifier   = "VIRUSTOTAL ID"
+	defaultBaseUrl         = "https://www.virustotal.com/api/v3"
+	defaultRatioThreshold  = 0.1
+	defaultPollInterval    = 15 * time.Second
+	defaultPollMaxAttempts = 8
+	// maxUploadSize is the max size of the files endpoint, bigger files need an upload URL
+	maxUploadSize = 32 * 1024 * 1024
+)
+
+var doOnce sync.Once
+var virusTotalConfig *VirusTotal
+
+// VirusTotal represents the information regarding the VirusTotal service
+type VirusTotal struct {
+	xICAPMetadata              string
+	httpMsg                    *http_message.HttpMsg
+	serviceName                string
+	methodName                 string
+	maxFileSize                int
+	bypassExts                 []string
+	processExts                []string
+	rejectExts                 []string
+	warnExts                   []string
+	extArrs                    []services_utilities.Extension
+	BaseUrl                    string
+	ApiKey                     string
+	RatioThreshold             float64
+	UploadUnknown              bool
+	PollInterval               time.Duration
+	PollMaxAttempts            int
+	RequestsPerMinute          int
+	Timeout                    time.Duration
+	returnOrigIfMaxSizeExc     bool
+	return400IfFileExtRejected bool
+	generalFunc                *general_functions.GeneralFunc
+	BypassOnApiError           bool
+	verifyServerCert           bool
+	client                     *http.Client
+	CaseBlockHttpResponseCode  int
+	CaseBlockHttpBody          bool
+	ExceptionPage              string
+	IcapHeaders                textproto.MIMEHeader
+}
+
+func InitVirusTotalConfig(serviceName string) {
+	logging.Logger.Debug("loading " + serviceName + " service configurations")
+	doOnce.Do(func() {
+		virusTotalConfig = &VirusTotal{
+			maxFileSize:                readValues.ReadValuesInt(serviceName + ".max_filesize"),
+			bypassExts:                 readValues.ReadValuesSlice(serviceName + ".bypass_extensions"),
+			processExts:                readValues.ReadValuesSlice(serviceName + ".process_extensions"),
+			rejectExts:                 readValues.ReadValuesSlice(serviceName + ".reject_extensions"),
+			BaseUrl:                    defaultBaseUrl,
+			ApiKey:                     readValues.ReadValuesString(serviceName + ".api_key"),
+			RatioThreshold:             defaultRatioThreshold,
+			PollInterval:               defaultPollInterval,
+			PollMaxAttempts:            defaultPollMaxAttempts,
+			Timeout:                    readValues.ReadValuesDuration(serviceName+".timeout") * time.Second,
+			returnOrigIfMaxSizeExc:     readValues.ReadValuesBool(serviceName + ".return_original_if_max_file_size_exceeded"),
+			return400IfFileExtRejected: readValues.ReadValuesBool(serviceName + ".return_400_if_file_ext_rejected"),
+			BypassOnApiError:           readValues.ReadValuesBool(serviceName + ".bypass_on_api_error"),
+			verifyServerCert:           readValues.ReadValuesBool(serviceName + ".verify_server_cert"),
+			CaseBlockHttpResponseCode:  readValues.ReadValuesInt(serviceName + ".http_exception_response_code"),
+			CaseBlockHttpBody:          readValues.ReadValuesBool(serviceName + ".http_exception_has_body"),
+			ExceptionPage:              readValues.ReadValuesString(serviceName + ".exception_page"),
+		}
+		if readValues.IsSecExists(serviceName + ".warn_extensions") {
+			virusTotalConfig.warnExts = readValues.ReadValuesSlice(serviceName + ".warn_extensions")
+		}
+		if readValues.IsSecExists(serviceName + ".base_url") {
+			virusTotalConfig.BaseUrl = readValues.ReadValuesString(serviceName + ".base_url")
+		}
+		if readValues.IsSecExists(serviceName + ".detection_ratio_threshold") {
+			virusTotalConfig.RatioThreshold = readValues.ReadValuesFloat(serviceName + ".detection_ratio_threshold")
+		}
+		if readValues.IsSecExists(serviceName + ".upload_unknown") {
+			virusTotalConfig.UploadUnknown = readValues.ReadValuesBool(serviceName + ".upload_unknown")
+		}
+		if readValues.IsSecExists(serviceName + ".poll_interval") {
+			virusTotalConfig.PollInterval = readValues.ReadValuesDuration(serviceName+".poll_interval") * time.Second
+		}
+		if readValues.IsSecExists(serviceName + ".poll_max_attempts") {
+			virusTotalConfig.PollMaxAttempts = readValues.ReadValuesInt(serviceName + ".poll_max_attempts")
+		}
+		if readValues.IsSecExists(serviceName + ".requests_per_minute") {
+			virusTotalConfig.RequestsPerMinute = readValues.ReadValuesInt(serviceName + ".requests_per_minute")
+		}
+		//the client is shared by the requests of the service to reuse its connections
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: !virusTotalConfig.verifyServerCert}
+		virusTotalConfig.client = &http.Client{Transport: transport}
+		virusTotalConfig.extArrs = services_utilities.InitExtsArr(virusTotalConfig.processExts, virusTotalConfig.rejectExts, virusTotalConfig.bypassExts)
+	})
+}
+
+// NewVirusTotalService returns a new populated instance of the virustotal service
+func NewVirusTotalService(serviceName, methodName string, httpMsg *http_message.HttpMsg, xICAPMetadata string) *VirusTotal {
+	return &VirusTotal{
+		xICAPMetadata:              xICAPMetadata,
+		httpMsg:                    httpMsg,
+		serviceName:                serviceName,
+		methodName:                 methodName,
+		maxFileSize:                virusTotalConfig.maxFileSize,
+		bypassExts:                 virusTotalConfig.bypassExts,
+		processExts:                virusTotalConfig.processExts,
+		rejectExts:                 virusTotalConfig.rejectExts,
+		warnExts:                   virusTotalConfig.warnExts,
+		extArrs:                    virusTotalConfig.extArrs,
+		BaseUrl:                    virusTotalConfig.BaseUrl,
+		ApiKey:                     virusTotalConfig.ApiKey,
+		RatioThreshold:             virusTotalConfig.RatioThreshold,
+		UploadUnknown:              virusTotalConfig.UploadUnknown,
+		PollInterval:               virusTotalConfig.PollInterval,
+		PollMaxAttempts:            virusTotalConfig.PollMaxAttempts,
+		RequestsPerMinute:          virusTotalConfig.RequestsPerMinute,
+		Timeout:                    virusTotalConfig.Timeout,
+		returnOrigIfMaxSizeExc:     virusTotalConfig.returnOrigIfMaxSizeExc,
+		return400IfFileExtRejected: virusTotalConfig.return400IfFileExtRejected,
+		generalFunc:                general_functions.NewGeneralFunc(httpMsg, xICAPMetadata),
+		BypassOnApiError:           virusTotalConfig.BypassOnApiError,
+		verifyServerCert:           virusTotalConfig.verifyServerCert,
+		client:                     virusTotalConfig.client,
+		CaseBlockHttpResponseCode:  virusTotalConfig.CaseBlockHttpResponseCode,
+		CaseBlockHttpBody:          virusTotalConfig.CaseBlockHttpBody,
+		ExceptionPage:              virusTotalConfig.ExceptionPage,
+	}
+}
@@ -0,0 +1,487 @@
+package virustotal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	utils "icapeg/consts"
+	"icapeg/logging"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Processing is a func used for to processing the http message
+func (v *VirusTotal) Processing(partial bool, IcapHeader textproto.MIMEHeader) (int, interface{}, map[string]string, map[string]interface{},
+	map[string]interface{}, map[string]interface{}) {
+	serviceHeaders := make(map[string]string)
+	serviceHeaders["X-ICAP-Metadata"] = v.xICAPMetadata
+	logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has started processing"))
+	msgHeadersBeforeProcessing := v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+	msgHeadersAfterProcessing := make(map[string]interface{})
+	vendorMsgs := make(map[string]interface{})
+	v.IcapHeaders = IcapHeader
+	v.IcapHeaders.Add("X-ICAP-Metadata", v.xICAPMetadata)
+	// no need to scan part of the file, this service needs all the file at ine time
+	if partial {
+		logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata,
+			v.serviceName+" service has stopped processing partially"))
+		return utils.Continue, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	if v.methodName == utils.ICAPModeResp {
+		if v.httpMsg.Response != nil {
+			if v.httpMsg.Response.StatusCode == 206 {
+				logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing byte range received"))
+				return utils.NoModificationStatusCodeStr, v.httpMsg, serviceHeaders,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+		}
+	}
+	isGzip := false
+	ExceptionPagePath := utils.BlockPagePath
+
+	if v.ExceptionPage != "" {
+		ExceptionPagePath = v.ExceptionPage
+	}
+	//extracting the file from http message
+
+	file, reqContentType, err := v.generalFunc.CopyingFileToTheBuffer(v.methodName)
+
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" error: "+err.Error()))
+		logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+		return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//if the http method is Connect, return the request as it is because it has no body
+	if v.methodName == utils.ICAPModeReq {
+		if v.httpMsg.Request.Method == http.MethodConnect {
+			return utils.OkStatusCodeStr, v.generalFunc.ReturningHttpMessageWithFile(v.methodName, file.Bytes()),
+				serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//getting the extension of the file
+	var contentType []string
+
+	var fileName string
+	if v.methodName == utils.ICAPModeReq {
+		contentType = v.httpMsg.Request.Header["Content-Type"]
+		fileName = v.generalFunc.GetFileName()
+	} else {
+		contentType = v.httpMsg.Response.Header["Content-Type"]
+		fileName = v.generalFunc.GetFileName()
+	}
+	if len(contentType) == 0 {
+		contentType = append(contentType, "")
+	}
+
+	logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" file name : "+fileName))
+
+	fileExtension := v.generalFunc.GetMimeExtension(file.Bytes(), contentType[0], fileName)
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+
+	hash := sha256.New()
+	f := file
+	_, err = hash.Write(f.Bytes())
+	if err != nil {
+		logging.Logger.Error(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" error: "+err.Error()))
+	}
+	fileSize := fmt.Sprintf("%v", file.Len())
+	fileHash := hex.EncodeToString(hash.Sum([]byte(nil)))
+	logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" file hash : "+fileHash))
+	logging.Audit(v.xICAPMetadata).SetFile(contentType[0], fileExtension, file.Len(), fileHash)
+
+	//check if the client proceeded to the URL after a warning or if the file extension is a warn extension
+	//if yes we will return 204 No modifications or the warn page which has a "proceed anyway" link
+	isProcess, icapStatus, httpMsg := v.generalFunc.CheckTheWarnPolicy(v.generalFunc.IsWarnExtension(fileExtension, v.warnExts),
+		v.IcapHeaders.Get(utils.ClientIPHeader), v.serviceName, v.methodName, fileHash, fileSize, isGzip, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check if the file extension is a bypass extension
+	//if yes we will not modify the file, and we will return 204 No modifications
+	isProcess, icapStatus, httpMsg = v.generalFunc.CheckTheExtension(fileExtension, v.extArrs,
+		v.processExts, v.rejectExts, v.bypassExts, v.return400IfFileExtRejected, isGzip,
+		v.serviceName, v.methodName, fileHash, v.httpMsg.Request.RequestURI, reqContentType, file, ExceptionPagePath, fileSize)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+	//check if the file size is greater than max file size of the service
+	//if yes we will return 200 ok or 204 no modification, it depends on the configuration of the service
+	if v.maxFileSize != 0 && v.maxFileSize < file.Len() {
+		status, file, httpMsg := v.generalFunc.IfMaxFileSizeExc(v.returnOrigIfMaxSizeExc, v.serviceName, v.methodName, file, v.maxFileSize, ExceptionPagePath, fileSize)
+		fileAfterPrep, httpMsg := v.generalFunc.IfStatusIs204WithFile(v.methodName, status, file, isGzip, reqContentType, httpMsg, true)
+		if fileAfterPrep == nil && httpMsg == nil {
+			logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+			return utils.InternalServerErrStatusCodeStr, nil, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		switch msg := httpMsg.(type) {
+		case *http.Request:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		case *http.Response:
+			msg.Body = io.NopCloser(bytes.NewBuffer(fileAfterPrep))
+			msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+			logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+			return status, msg, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+		return status, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	//check the fields of the forms and the text bodies against the content policy of the service
+	//if a field or the text matches, it's redacted or the request is rejected
+	isProcess, icapStatus, httpMsg = v.generalFunc.CheckTheContentPolicy(v.serviceName, v.methodName,
+		fileHash, fileSize, reqContentType, file)
+	if !isProcess {
+		logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+		msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+		return icapStatus, httpMsg, serviceHeaders,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	scannedFile := file.Bytes()
+	scanStart := time.Now()
+	isMal, threatName, err := v.sendFileToScan(file.Bytes(), fileHash, fileName)
+	logging.Audit(v.xICAPMetadata).StageDone("scan", scanStart)
+	if err != nil && !v.BypassOnApiError {
+		logging.Logger.Error(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" error: "+err.Error()))
+		if strings.Contains(err.Error(), "context deadline exceeded") {
+			logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+			return utils.RequestTimeOutStatusCodeStr, nil, nil,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+		// its suppose to be InternalServerErrStatusCodeStr but need to be handled
+		logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+		return utils.BadRequestStatusCodeStr, nil, nil,
+			msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+	}
+
+	if err != nil {
+		logging.Logger.Warn(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" error is bypassed: "+err.Error()))
+	}
+
+	if isMal {
+		logging.Audit(v.xICAPMetadata).SetVerdict(logging.VerdictMalicious, threatName)
+		if threatName != "" {
+			serviceHeaders["X-Virus-ID"] = threatName
+		}
+		logging.Logger.Debug(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+": file is not safe"))
+		v.generalFunc.QuarantineFile(scannedFile, v.serviceName, threatName, v.IcapHeaders.Get(utils.ClientIPHeader))
+		if v.methodName == utils.ICAPModeResp {
+
+			errPage, contentType := v.generalFunc.GenBlockPage(ExceptionPagePath, utils.ErrPageReasonFileIsNotSafe, v.serviceName, fileHash, v.httpMsg.Request.RequestURI, fileSize, v.xICAPMetadata)
+
+			v.httpMsg.Response = v.generalFunc.ErrPageResp(v.CaseBlockHttpResponseCode, errPage.Len(), contentType)
+			if v.CaseBlockHttpBody {
+				v.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(errPage.Bytes()))
+			} else {
+				var body []byte
+				v.httpMsg.Response.Body = io.NopCloser(bytes.NewBuffer(body))
+				delete(v.httpMsg.Response.Header, "Content-Type")
+				delete(v.httpMsg.Response.Header, "Content-Length")
+			}
+			logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+			msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+			return utils.OkStatusCodeStr, v.httpMsg.Response, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		} else {
+			htmlPage, req, err := v.generalFunc.ReqModErrPage(utils.ErrPageReasonFileIsNotSafe, v.serviceName, fileHash, fileSize)
+			if err != nil {
+				logging.Logger.Error(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" error: "+err.Error()))
+
+				return utils.InternalServerErrStatusCodeStr, nil, nil,
+					msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+			}
+			req.Body = io.NopCloser(htmlPage)
+			msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+			return utils.OkStatusCodeStr, req, serviceHeaders,
+				msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+		}
+	}
+
+	//the file is allowed without being scanned if the scanner error is bypassed
+	if err != nil {
+		logging.Audit(v.xICAPMetadata).SetVerdict(logging.VerdictUnscanned, "")
+	} else {
+		logging.Audit(v.xICAPMetadata).SetVerdict(logging.VerdictClean, "")
+	}
+	//returning the scanned file if everything is ok
+	logging.Logger.Info(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" service has stopped processing"))
+	msgHeadersAfterProcessing = v.generalFunc.LogHTTPMsgHeaders(v.methodName)
+	scannedFile = v.generalFunc.PreparingFileAfterScanning(scannedFile, reqContentType, v.methodName)
+
+	return utils.NoModificationStatusCodeStr, v.generalFunc.ReturningHttpMessageWithFile(v.methodName, scannedFile),
+		serviceHeaders, msgHeadersBeforeProcessing, msgHeadersAfterProcessing, vendorMsgs
+}
+
+// analysisStats is the number of engines per category of a VirusTotal analysis
+type analysisStats struct {
+	Malicious  int `json:"malicious"`
+	Suspicious int `json:"suspicious"`
+	Undetected int `json:"undetected"`
+	Harmless   int `json:"harmless"`
+}
+
+// engineResult is the result of an engine of a VirusTotal analysis
+type engineResult struct {
+	Category string `json:"category"`
+	Result   string `json:"result"`
+}
+
+// vtResponse is the response of the files and the analyses endpoints of VirusTotal API v3
+type vtResponse struct {
+	Data struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			LastAnalysisStats   analysisStats           `json:"last_analysis_stats"`
+			LastAnalysisResults map[string]engineResult `json:"last_analysis_results"`
+			Status              string                  `json:"status"`
+			Stats               analysisStats           `json:"stats"`
+			Results             map[string]engineResult `json:"results"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// rateLimitBackoff is the wait after the first 429 response if it has no Retry-After header,
+// it's doubled after every 429 response of the same request
+var rateLimitBackoff = 15 * time.Second
+
+// maxRateLimitRetries is the number of the retries of a request which VirusTotal responded to with 429,
+// then the quota error is returned, so bypass_on_api_error decides instead of waiting until the timeout
+const maxRateLimitRetries = 2
+
+// errQuotaExceeded is returned when VirusTotal still responds with 429 after the retries
+var errQuotaExceeded = errors.New("VirusTotal quota is exceeded")
+
+// limiter spaces the requests of all the transactions out to respect requests_per_minute,
+// the public API quota is per API key, so it's shared by all the requests
+var limiter struct {
+	sync.Mutex
+	next time.Time
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// waitForQuota waits until the request can be sent without exceeding requests_per_minute
+func (v *VirusTotal) waitForQuota(ctx context.Context) error {
+	if v.RequestsPerMinute <= 0 {
+		return nil
+	}
+	limiter.Lock()
+	now := time.Now()
+	at := limiter.next
+	if at.Before(now) {
+		at = now
+	}
+	//the slot isn't reserved when the transaction times out before it
+	if deadline, ok := ctx.Deadline(); ok && at.After(deadline) {
+		limiter.Unlock()
+		return errQuotaExceeded
+	}
+	limiter.next = at.Add(time.Minute / time.Duration(v.RequestsPerMinute))
+	limiter.Unlock()
+	return sleep(ctx, time.Until(at))
+}
+
+// do sends the request which newReq creates and decodes the response, it retries with backoff when the quota
+// is exceeded (429) up to maxRateLimitRetries times, found is false if VirusTotal responded with 404
+func (v *VirusTotal) do(ctx context.Context, newReq func() (*http.Request, error)) (*vtResponse, bool, error) {
+	backoff := rateLimitBackoff
+	for retries := 0; ; retries++ {
+		if err := v.waitForQuota(ctx); err != nil {
+			return nil, false, err
+		}
+		req, err := newReq()
+		if err != nil {
+			return nil, false, err
+		}
+		req.Header.Set("x-apikey", v.ApiKey)
+		resp, err := v.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, false, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			if retries == maxRateLimitRetries {
+				return nil, false, errQuotaExceeded
+			}
+			wait := backoff
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+			//there is no retry if the quota isn't reset before the timeout
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				return nil, false, errQuotaExceeded
+			}
+			logging.Logger.Debug(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+
+				": VirusTotal quota is exceeded, retrying after "+wait.String()))
+			if err = sleep(ctx, wait); err != nil {
+				return nil, false, err
+			}
+			backoff *= 2
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, false, nil
+		}
+		if resp.StatusCode >= 300 {
+			return nil, false, errors.New("VirusTotal responded with status code " + strconv.Itoa(resp.StatusCode))
+		}
+		result := &vtResponse{}
+		if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return nil, false, err
+		}
+		return result, true, nil
+	}
+}
+
+// verdict applies the detection ratio threshold on the stats of an analysis, the threat name
+// is the result which most of the engines which detected the file agree on
+func (v *VirusTotal) verdict(stats analysisStats, results map[string]engineResult) (bool, string) {
+	total := stats.Malicious + stats.Suspicious + stats.Undetected + stats.Harmless
+	if total == 0 || stats.Malicious == 0 {
+		return false, ""
+	}
+	ratio := float64(stats.Malicious) / float64(total)
+	logging.Logger.Debug(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+" detection ratio : "+
+		strconv.Itoa(stats.Malicious)+"/"+strconv.Itoa(total)))
+	if ratio < v.RatioThreshold {
+		return false, ""
+	}
+	counts := make(map[string]int)
+	for _, result := range results {
+		if result.Category == "malicious" && result.Result != "" {
+			counts[result.Result]++
+		}
+	}
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	threatName := strconv.Itoa(stats.Malicious) + "/" + strconv.Itoa(total) + " engines"
+	if len(names) > 0 {
+		threatName = names[0] + " (" + threatName + ")"
+	}
+	return true, threatName
+}
+
+// upload uploads an unknown file and polls its analysis until it's completed
+func (v *VirusTotal) upload(ctx context.Context, file []byte, fileName string) (bool, string, error) {
+	if fileName == "" {
+		fileName = "file"
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		return false, "", err
+	}
+	if _, err = part.Write(file); err != nil {
+		return false, "", err
+	}
+	if err = writer.Close(); err != nil {
+		return false, "", err
+	}
+	uploaded, _, err := v.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, v.BaseUrl+"/files", bytes.NewReader(body.Bytes()))
+		if err == nil {
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+		}
+		return req, err
+	})
+	if err != nil {
+		return false, "", err
+	}
+	if uploaded == nil || uploaded.Data.ID == "" {
+		return false, "", errors.New("VirusTotal didn't return the id of the analysis")
+	}
+	for attempt := 0; attempt < v.PollMaxAttempts; attempt++ {
+		if err = sleep(ctx, v.PollInterval); err != nil {
+			return false, "", err
+		}
+		analysis, found, err := v.do(ctx, func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, v.BaseUrl+"/analyses/"+uploaded.Data.ID, nil)
+		})
+		if err != nil {
+			return false, "", err
+		}
+		if found && analysis.Data.Attributes.Status == "completed" {
+			isMal, threatName := v.verdict(analysis.Data.Attributes.Stats, analysis.Data.Attributes.Results)
+			return isMal, threatName, nil
+		}
+	}
+	return false, "", errors.New("the VirusTotal analysis isn't completed after " + strconv.Itoa(v.PollMaxAttempts) + " attempts")
+}
+
+// sendFileToScan looks the SHA-256 of the file up, if VirusTotal doesn't know the file
+// and upload_unknown is enabled, the file is uploaded for analysis
+func (v *VirusTotal) sendFileToScan(file []byte, fileHash, fileName string) (bool, string, error) {
+	if fileHash == "" {
+		hash := sha256.Sum256(file)
+		fileHash = hex.EncodeToString(hash[:])
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), v.Timeout)
+	defer cancel()
+	report, found, err := v.do(ctx, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, v.BaseUrl+"/files/"+fileHash, nil)
+	})
+	if err != nil {
+		return false, "", err
+	}
+	if found {
+		isMal, threatName := v.verdict(report.Data.Attributes.LastAnalysisStats, report.Data.Attributes.LastAnalysisResults)
+		return isMal, threatName, nil
+	}
+	if !v.UploadUnknown || len(file) > maxUploadSize {
+		logging.Logger.Debug(utils.PrepareLogMsg(v.xICAPMetadata, v.serviceName+": the file is unknown to VirusTotal"))
+		return false, "", nil
+	}
+	return v.upload(ctx, file, fileName)
+}
+
+func (v *VirusTotal) ISTagValue() string {
+	epochTime := strconv.FormatInt(time.Now().Unix(), 10)
+	return "epoch-" + epochTime
+}
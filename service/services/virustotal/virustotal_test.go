@@ -0,0 +1,159 @@
+package virustotal
+
+import (
+	"context"
+	"fmt"
+	"icapeg/logging"
+	general_functions "icapeg/service/services-utilities/general-functions"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const testReport = `{"data":{"attributes":{
+	"last_analysis_stats":{"malicious":%d,"suspicious":0,"undetected":%d,"harmless":0},
+	"last_analysis_results":{"a":{"category":"malicious","result":"EICAR-Test"},
+		"b":{"category":"malicious","result":"EICAR-Test"},"c":{"category":"malicious","result":"Other"}}}}}`
+
+func testVirusTotal(url string) *VirusTotal {
+	logging.Logger = zap.NewNop()
+	return &VirusTotal{
+		BaseUrl:         url,
+		ApiKey:          "secret",
+		RatioThreshold:  0.1,
+		PollInterval:    time.Millisecond,
+		PollMaxAttempts: 3,
+		Timeout:         5 * time.Second,
+		generalFunc:     general_functions.NewGeneralFunc(nil, ""),
+		client:          &http.Client{},
+	}
+}
+
+func TestLookupThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-apikey") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/files/high":
+			io.WriteString(w, fmt.Sprintf(testReport, 3, 7))
+		case "/files/low":
+			io.WriteString(w, fmt.Sprintf(testReport, 3, 67))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	v := testVirusTotal(server.URL)
+
+	isMal, threatName, err := v.sendFileToScan([]byte("x"), "high", "")
+	if err != nil || !isMal || threatName != "EICAR-Test (3/10 engines)" {
+		t.Errorf("expected a malicious verdict, got %v %q %v", isMal, threatName, err)
+	}
+	isMal, _, err = v.sendFileToScan([]byte("x"), "low", "")
+	if err != nil || isMal {
+		t.Errorf("expected a ratio below the threshold to be clean, got %v %v", isMal, err)
+	}
+	isMal, _, err = v.sendFileToScan([]byte("x"), "unknown", "")
+	if err != nil || isMal {
+		t.Errorf("expected an unknown file to be clean, got %v %v", isMal, err)
+	}
+}
+
+func TestUploadUnknownWithRateLimit(t *testing.T) {
+	rateLimitBackoff = time.Millisecond
+	limited, polls := false, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/files/", func(w http.ResponseWriter, r *http.Request) {
+		if !limited {
+			limited = true
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/files", func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		if string(content) != "body" {
+			t.Errorf("unexpected uploaded content %q", content)
+		}
+		io.WriteString(w, `{"data":{"id":"42"}}`)
+	})
+	mux.HandleFunc("/analyses/42", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "queued"
+		if polls > 1 {
+			status = "completed"
+		}
+		io.WriteString(w, `{"data":{"attributes":{"status":"`+status+`",
+			"stats":{"malicious":2,"undetected":2},"results":{"a":{"category":"malicious","result":"Trojan"}}}}}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	v := testVirusTotal(server.URL)
+	v.UploadUnknown = true
+
+	isMal, threatName, err := v.sendFileToScan([]byte("body"), "", "body.exe")
+	if err != nil || !isMal || threatName != "Trojan (2/4 engines)" {
+		t.Errorf("expected a malicious verdict, got %v %q %v", isMal, threatName, err)
+	}
+	if !limited || polls != 2 {
+		t.Errorf("expected a retry after 429 and 2 polls, got %v %d", limited, polls)
+	}
+}
+
+func TestRateLimitRetriesAreCapped(t *testing.T) {
+	rateLimitBackoff = time.Millisecond
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	v := testVirusTotal(server.URL)
+
+	start := time.Now()
+	_, _, err := v.sendFileToScan([]byte("x"), "limited", "")
+	if err != errQuotaExceeded || requests != maxRateLimitRetries+1 {
+		t.Errorf("expected the quota error after %d requests, got %v after %d", maxRateLimitRetries+1, err, requests)
+	}
+	if time.Since(start) >= v.Timeout {
+		t.Error("expected the quota error before the timeout")
+	}
+}
+
+func TestQuotaSlotAfterTheDeadline(t *testing.T) {
+	v := testVirusTotal("")
+	v.RequestsPerMinute = 1
+	next := time.Now().Add(time.Minute)
+	limiter.Lock()
+	limiter.next = next
+	limiter.Unlock()
+	defer func() {
+		limiter.Lock()
+		limiter.next = time.Time{}
+		limiter.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := v.waitForQuota(ctx); err != errQuotaExceeded {
+		t.Errorf("expected the quota error, got %v", err)
+	}
+	limiter.Lock()
+	defer limiter.Unlock()
+	if !limiter.next.Equal(next) {
+		t.Error("expected the slot after the deadline not to be reserved")
+	}
+}
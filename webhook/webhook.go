@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"icapeg/logging"
+	"icapeg/readValues"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SignatureHeader is the header of the HMAC-SHA256 signature of the payload, its value is sha256=<hex>
+const SignatureHeader = "X-ICAPeg-Signature"
+
+// the default values of the webhooks configuration
+const (
+	defaultQueueSize  = 1000
+	defaultWorkers    = 2
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 3
+)
+
+// retryBackoff is the wait before the first retry, it's doubled after every retry
+var retryBackoff = time.Second
+
+// Webhook is an endpoint which is notified when a service blocks an HTTP message, Services and Reasons
+// restrict the notifications, an empty list means all services or all reasons
+type Webhook struct {
+	Name       string
+	URL        string
+	Secret     string
+	Services   []string
+	Reasons    []string
+	Timeout    time.Duration
+	MaxRetries int
+	client     *http.Client
+}
+
+// notification is a payload which is queued for delivery to a webhook
+type notification struct {
+	webhook *Webhook
+	body    []byte
+}
+
+var doOnce sync.Once
+var webhooks []*Webhook
+var queue chan notification
+
+// Init reads the optional [webhooks] section of config.toml file and starts the delivery workers,
+// the names of the webhooks are listed in webhooks.names and every webhook has its own section
+// (ex: [webhooks.soc])
+func Init() {
+	doOnce.Do(func() {
+		if !readValues.IsSecExists("webhooks.names") {
+			return
+		}
+		queueSize, workers := defaultQueueSize, defaultWorkers
+		if readValues.IsSecExists("webhooks.queue_size") {
+			queueSize = readValues.ReadValuesInt("webhooks.queue_size")
+		}
+		if readValues.IsSecExists("webhooks.workers") {
+			workers = readValues.ReadValuesInt("webhooks.workers")
+		}
+		for _, name := range readValues.ReadValuesSlice("webhooks.names") {
+			webhooks = append(webhooks, readWebhook(name))
+		}
+		start(queueSize, workers)
+	})
+}
+
+func readWebhook(name string) *Webhook {
+	section := "webhooks." + name + "."
+	w := &Webhook{
+		Name:       name,
+		URL:        readValues.ReadValuesString(section + "url"),
+		Timeout:    defaultTimeout,
+		MaxRetries: defaultMaxRetries,
+	}
+	if readValues.IsSecExists(section + "secret") {
+		w.Secret = readValues.ReadValuesString(section + "secret")
+	}
+	if readValues.IsSecExists(section + "services") {
+		w.Services = readValues.ReadValuesSlice(section + "services")
+	}
+	if readValues.IsSecExists(section + "reasons") {
+		w.Reasons = readValues.ReadValuesSlice(section + "reasons")
+	}
+	if readValues.IsSecExists(section + "timeout") {
+		w.Timeout = readValues.ReadValuesDuration(section+"timeout") * time.Second
+	}
+	if readValues.IsSecExists(section + "max_retries") {
+		w.MaxRetries = readValues.ReadValuesInt(section + "max_retries")
+	}
+	w.client = &http.Client{Timeout: w.Timeout}
+	return w
+}
+
+func start(queueSize, workers int) {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	queue = make(chan notification, queueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for n := range queue {
+				n.webhook.deliver(n.body)
+			}
+		}()
+	}
+}
+
+func matches(value string, filter []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, v := range filter {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify queues the payload for the webhooks whose filters match the service and the reason,
+// it never blocks, if the queue is full, the notification is dropped
+func Notify(serviceName, reason string, payload interface{}) {
+	Init()
+	if len(webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logging.Logger.Error("couldn't marshal the webhook payload: " + err.Error())
+		return
+	}
+	for _, w := range webhooks {
+		if !matches(serviceName, w.Services) || !matches(reason, w.Reasons) {
+			continue
+		}
+		select {
+		case queue <- notification{webhook: w, body: body}:
+		default:
+			logging.Logger.Error("the webhooks queue is full, the notification of " + w.Name + " webhook is dropped")
+		}
+	}
+}
+
+// Sign returns the value of the signature header of the payload
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// errPermanent is returned when retrying the delivery is useless
+var errPermanent = errors.New("the webhook rejected the notification")
+
+func (w *Webhook) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return errPermanent
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return errors.New("the webhook responded with status code " + strconv.Itoa(resp.StatusCode))
+	}
+	return errPermanent
+}
+
+// deliver sends the payload to the webhook and retries with exponential backoff if it fails
+func (w *Webhook) deliver(body []byte) {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := w.send(body)
+		if err == nil {
+			return
+		}
+		if err == errPermanent || attempt >= w.MaxRetries {
+			logging.Logger.Error("couldn't notify " + w.Name + " webhook: " + err.Error())
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"icapeg/logging"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestNotify(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	retryBackoff = time.Millisecond
+	var attempts int32
+	received := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt fails to make sure that the notification is retried
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("secret", body) {
+			t.Error("invalid signature")
+		}
+		received <- r
+	}))
+	defer server.Close()
+
+	doOnce.Do(func() {})
+	webhooks = []*Webhook{{Name: "soc", URL: server.URL, Secret: "secret", Services: []string{"clamav"},
+		Reasons: []string{"fileIsNotSafe"}, MaxRetries: 2, client: server.Client()}}
+	start(10, 1)
+
+	Notify("echo", "fileIsNotSafe", map[string]string{"service_name": "echo"})
+	Notify("clamav", "fileRejected", map[string]string{"service_name": "clamav"})
+	Notify("clamav", "fileIsNotSafe", map[string]string{"service_name": "clamav"})
+
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the webhook wasn't notified")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("expected 2 attempts for the matching notification only, got %d", n)
+	}
+}